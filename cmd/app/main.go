@@ -1,40 +1,236 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/asymptoter/tonx-take-home-test/internal/api/handler"
+	"github.com/asymptoter/tonx-take-home-test/internal/app"
+	"github.com/asymptoter/tonx-take-home-test/internal/config"
+	"github.com/asymptoter/tonx-take-home-test/internal/job"
 	"github.com/asymptoter/tonx-take-home-test/internal/repository"
 	"github.com/asymptoter/tonx-take-home-test/internal/service"
 	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/idempotency"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func main() {
+	// Load config from the file in CONFIG_FILE or -config, overridden by environment variables
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	flag.Parse()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		ctx.Background().Fatal(err)
+	}
+
+	// Every CTX shares the logger built from the config
+	logger, err := ctx.NewLogger(cfg.Log.LoggerConfig())
+	if err != nil {
+		ctx.Background().Fatal(err)
+	}
+	ctx.SetLogger(logger)
+	defer ctx.Sync()
+
+	// Export the spans of requests and jobs if a trace file is set
+	if cfg.Trace.File != "" {
+		exporter, err := ctx.NewFileExporter(cfg.Trace.File)
+		if err != nil {
+			ctx.Background().Fatal(err)
+		}
+		ctx.SetSpanExporter(exporter, semconv.ServiceName(cfg.Trace.ServiceName))
+		defer exporter.Close()
+	}
+
 	ctx := ctx.Background()
+	shutdownTimeout := time.Duration(cfg.HTTP.ShutdownTimeout)
+
 	// Connect to database
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(cfg.Database.DSN), &gorm.Config{
+		Logger: repository.NewLogger(app.DBLoggerConfig(cfg.Database)),
+	})
 	if err != nil {
 		ctx.Fatal(err)
 	}
+	// Record query latencies for /metrics, and queries as spans
+	if err := db.Use(repository.MetricsPlugin{}); err != nil {
+		ctx.Fatal(err)
+	}
+	if err := db.Use(repository.TracingPlugin{}); err != nil {
+		ctx.Fatal(err)
+	}
 
-	campaignRepository := repository.NewCampaignRepository(ctx, db)
-	campaignService := service.NewCampaignService(ctx, campaignRepository)
+	repositoryConfig := repository.Config{
+		AutoMigrate: cfg.Database.AutoMigrate,
+	}
+	campaignRepository := repository.NewCampaignRepository(ctx, db, repositoryConfig)
+	campaignService := service.NewCampaignService(ctx, campaignRepository, app.ServiceConfig(cfg.Campaign))
 
-	// Cron job create campaign every day
+	// Only the replica holding the scheduler lease runs the cron jobs
+	hostname, _ := os.Hostname()
+	leaseRepository, err := repository.NewLeaseRepository(ctx, db, repositoryConfig)
+	if err != nil {
+		ctx.Fatal(err)
+	}
+	leader := job.NewLeader(ctx, leaseRepository, job.SchedulerLease, hostname+"-"+uuid.NewString())
+	leaderCTX, stopLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		leader.Run(ctx.WithContext(leaderCTX))
+	}()
+
+	// Cron job create campaign every day, the running jobs stop retrying when shutting down
+	cronContext, stopCron := context.WithCancel(context.Background())
+	cronCTX := ctx.WithContext(cronContext).WithActor("system:cron")
 	cronJob := cron.New(cron.WithSeconds())
-	if _, err = cronJob.AddFunc("0 30 22 * * *", func() {
-		if _, err := campaignService.Create(ctx, service.CreateCampaignInput{}); err != nil {
+	createCampaignJob := job.NewCreateCampaignJob(cronCTX, campaignService, job.CreateCampaignJobConfig{
+		Slot:                cfg.Campaign.Slot(),
+		ReallocateUnclaimed: cfg.Campaign.ReallocateUnclaimed,
+	})
+	if _, err = cronJob.AddJob(cfg.Scheduler.CreateCampaignSpec, leader.Wrap(cronCTX, createCampaignJob)); err != nil {
+		ctx.Fatal(err)
+	}
+	// Reallocate unclaimed coupons after the grab window
+	reallocateCouponsJob := job.NewReallocateCouponsJob(cronCTX, campaignService)
+	if _, err = cronJob.AddJob(cfg.Scheduler.ReallocateSpec, leader.Wrap(cronCTX, reallocateCouponsJob)); err != nil {
+		ctx.Fatal(err)
+	}
+	cronJob.Start()
+
+	adminTokens, err := parseAdminTokens(cfg.Admin.Tokens)
+	if err != nil {
+		ctx.Fatal(err)
+	}
+
+	// Limit the public API per user and client IP, the database store is shared by the replicas
+	// and deletes the refilled buckets in the background until shutting down
+	storeContext, stopStores := context.WithCancel(context.Background())
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "database" {
+		if rateLimitStore, err = repository.NewRateLimitStore(ctx.WithContext(storeContext), db, repositoryConfig); err != nil {
+			ctx.Fatal(err)
+		}
+	}
+	// Replay the responses of the requests retried with an Idempotency-Key
+	var idempotencyStore idempotency.Store = idempotency.NewMemoryStore()
+	if cfg.Idempotency.Store == "database" {
+		if idempotencyStore, err = repository.NewIdempotencyStore(ctx, db, repositoryConfig); err != nil {
 			ctx.Fatal(err)
 		}
-	}); err != nil {
+	}
+	idempotent := handler.NewIdempotency(idempotencyStore, time.Duration(cfg.Idempotency.TTL))
+	adminConfig := handler.Config{
+		DefaultPageLimit: cfg.HTTP.DefaultPageLimit,
+		MaxPageLimit:     cfg.HTTP.MaxPageLimit,
+		Idempotency:      idempotent,
+	}
+	handlerConfig := adminConfig
+	handlerConfig.RateLimiter = handler.NewRateLimiter(rateLimitStore, rateLimitRules(cfg.RateLimit)...)
+
+	router := gin.New()
+	// 只有設定的 proxy 送來的 X-Forwarded-For 才當作 client IP，否則用連線的位址
+	if err := router.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
 		ctx.Fatal(err)
 	}
-	cronJob.Start()
+	// Build the request context with X-Request-ID before any handler runs,
+	// then log and count every request and turn panics into 500 through our logger
+	router.Use(handler.Middlewares()...)
+	handler.RegisterMetricsHTTPHandler(router)
+	handler.RegisterHTTPHandler(router, campaignService, handlerConfig)
+	handler.RegisterAdminHTTPHandler(router, campaignService, adminTokens, adminConfig)
+	// Liveness and readiness probes, add a check here for each new dependency
+	handler.RegisterHealthHTTPHandler(router,
+		handler.ReadinessCheck{Name: "database", Check: campaignRepository.Ping},
+		handler.ReadinessCheck{Name: "migrations", Check: campaignRepository.CheckMigrations},
+	)
+
+	server := &http.Server{
+		Addr:    cfg.HTTP.Addr,
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctx.Fatal(err)
+		}
+	}()
+
+	signalCTX, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-signalCTX.Done()
+	ctx.With("timeout", shutdownTimeout.String()).Info("shutting down")
+
+	shutdownCTX, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	router := gin.Default()
-	handler.RegisterHTTPHandler(router, campaignService)
-	router.Run(":8080")
+	// 依序停止：不再接受新請求並等待處理中的請求、等待執行中的排程、釋放 lease、關閉資料庫
+	if err := server.Shutdown(shutdownCTX); err != nil {
+		ctx.Error(err)
+	}
+	stopCron()
+	select {
+	case <-cronJob.Stop().Done():
+	case <-shutdownCTX.Done():
+		ctx.Error("timeout waiting for running cron jobs")
+	}
+	stopLeader()
+	select {
+	case <-leaderDone:
+	case <-shutdownCTX.Done():
+		ctx.Error("timeout waiting for releasing the scheduler lease")
+	}
+	stopStores()
+	if sqlDB, err := db.DB(); err != nil {
+		ctx.Error(err)
+	} else if err := sqlDB.Close(); err != nil {
+		ctx.Error(err)
+	}
+	ctx.Info("shut down")
+}
+
+// parseAdminTokens parses "name:role:token" entries separated by commas
+func parseAdminTokens(s string) (map[string]handler.AdminUser, error) {
+	res := map[string]handler.AdminUser{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, ":", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid admin token entry %q", entry)
+		}
+		role := handler.Role(fields[1])
+		if role != handler.RoleAdmin && role != handler.RoleSupport {
+			return nil, fmt.Errorf("invalid admin role %q", fields[1])
+		}
+		res[fields[2]] = handler.AdminUser{
+			Name: fields[0],
+			Role: role,
+		}
+	}
+	return res, nil
+}
+
+// rateLimitRules converts the rate limit config to the rules of the handler rate limiter
+func rateLimitRules(c config.RateLimit) []handler.RateLimitRule {
+	return []handler.RateLimitRule{
+		{Route: "POST /campaigns/:id/reservations", User: ratelimit.Limit(c.ReservationUser), IP: ratelimit.Limit(c.ReservationIP)},
+		{Route: "POST /campaigns/:id/reservations/claim", User: ratelimit.Limit(c.ClaimUser), IP: ratelimit.Limit(c.ClaimIP)},
+		{User: ratelimit.Limit(c.DefaultUser), IP: ratelimit.Limit(c.DefaultIP)},
+	}
 }
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/app"
+	"github.com/asymptoter/tonx-take-home-test/internal/config"
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const usage = `couponctl manages coupon campaigns.
+
+Usage:
+  couponctl [-config FILE] [-dsn DSN] <command> [flags]
+
+The database DSN is required, from -dsn, $DB_DSN or the config, except by verify -proof.
+
+Commands:
+  migrate   create or update the database tables
+  create    create a campaign with custom windows
+  list      list campaigns from the newest one
+  stats     show statistics of a campaign
+  draw      reallocate unclaimed coupons of a campaign
+  export    export winners of a campaign to stdout
+  fairness  check the draw result of a campaign against the win ratio
+  verify    recompute the commit-reveal draw of a campaign from its revealed seed
+
+Run "couponctl <command> -h" for the flags of a command.
+`
+
+var (
+	errUsage      = errors.New("invalid usage")
+	errNoDatabase = errors.New("couponctl needs a database, set -dsn, DB_DSN or database.dsn in the config")
+)
+
+func main() {
+	fs := flag.NewFlagSet("couponctl", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file, defaults to $CONFIG_FILE")
+	dsn := fs.String("dsn", "", "sqlite database DSN, overrides the DSN in the config")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := ctx.NewLogger(cfg.Log.LoggerConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctx.SetLogger(logger)
+
+	// 透過 CLI 的操作在稽核紀錄中記為 cli:<os user>
+	ctx := ctx.Background().WithActor("cli:" + os.Getenv("USER"))
+	if *dsn != "" {
+		cfg.Database.DSN = *dsn
+	}
+
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "verify":
+		// verify -proof 只需要公開的 proof，不會開啟資料庫
+		err = verify(ctx, func() (service.CampaignService, error) {
+			return newCampaignService(ctx, cfg)
+		}, args, os.Stdin, os.Stdout)
+	case "migrate":
+		var db *gorm.DB
+		if db, err = openDB(cfg); err == nil {
+			err = migrate(db)
+		}
+	default:
+		var campaignService service.CampaignService
+		if campaignService, err = newCampaignService(ctx, cfg); err == nil {
+			err = run(ctx, campaignService, cmd, args)
+		}
+	}
+	if err == errUsage {
+		fs.Usage()
+		os.Exit(2)
+	} else if err == errNoDatabase {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the commands calling the campaign service
+func run(c ctx.CTX, campaignService service.CampaignService, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		return create(c, campaignService, args)
+	case "list":
+		return list(c, campaignService, args)
+	case "stats":
+		return stats(c, campaignService, args)
+	case "draw":
+		return draw(c, campaignService, args)
+	case "export":
+		return export(c, campaignService, args)
+	case "fairness":
+		return fairness(c, campaignService, args)
+	default:
+		return errUsage
+	}
+}
+
+// openDB opens the database in the config, the default :memory: is rejected since it's gone when
+// couponctl exits, the commands would seem to succeed without writing to any database.
+func openDB(cfg *config.Config) (*gorm.DB, error) {
+	if inMemoryDSN(cfg.Database.DSN) {
+		return nil, errNoDatabase
+	}
+	return gorm.Open(sqlite.Open(cfg.Database.DSN), &gorm.Config{
+		Logger: repository.NewLogger(app.DBLoggerConfig(cfg.Database)),
+	})
+}
+
+func newCampaignService(c ctx.CTX, cfg *config.Config) (service.CampaignService, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	campaignRepository := repository.NewCampaignRepository(c, db, repository.Config{
+		AutoMigrate: cfg.Database.AutoMigrate,
+	})
+	return service.NewCampaignService(c, campaignRepository, app.ServiceConfig(cfg.Campaign)), nil
+}
+
+func migrate(db *gorm.DB) error {
+	if err := repository.Migrate(db); err != nil {
+		return err
+	}
+	fmt.Println("migrated")
+	return nil
+}
+
+func create(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	reservationStart := fs.String("reservation-start", "", "reservation window start in RFC3339, defaults to today's window in the config")
+	reservationEnd := fs.String("reservation-end", "", "reservation window end in RFC3339")
+	grabStart := fs.String("grab-start", "", "grab window start in RFC3339")
+	grabEnd := fs.String("grab-end", "", "grab window end in RFC3339")
+	reallocate := fs.Bool("reallocate", true, "reallocate unclaimed coupons after the grab window")
+	fs.Parse(args)
+
+	input := service.CreateCampaignInput{
+		ReallocateUnclaimed: *reallocate,
+	}
+	var err error
+	for _, w := range []struct {
+		value string
+		dst   *int64
+	}{
+		{*reservationStart, &input.ReservationStartAt},
+		{*reservationEnd, &input.ReservationEndAt},
+		{*grabStart, &input.GrabStartAt},
+		{*grabEnd, &input.GrabEndAt},
+	} {
+		if w.value == "" {
+			continue
+		}
+		if *w.dst, err = parseTime(w.value); err != nil {
+			return err
+		}
+	}
+
+	campaign, err := campaignService.Create(c, input)
+	if err != nil {
+		return err
+	}
+	printCampaigns(os.Stdout, []service.Campaign{*campaign})
+	return nil
+}
+
+func list(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	cursor := fs.Uint("cursor", 0, "list campaigns before this campaign id")
+	limit := fs.Int("limit", 20, "number of campaigns to list")
+	fs.Parse(args)
+
+	page, err := campaignService.List(c, service.ListCampaignsInput{
+		Cursor: *cursor,
+		Limit:  *limit,
+	})
+	if err != nil {
+		return err
+	}
+	printCampaigns(os.Stdout, page.Campaigns)
+	if page.NextCursor != 0 {
+		fmt.Printf("next cursor: %d\n", page.NextCursor)
+	}
+	return nil
+}
+
+func stats(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	id := fs.Uint("id", 0, "campaign id")
+	fs.Parse(args)
+	if *id == 0 {
+		return errUsage
+	}
+
+	res, err := campaignService.GetStats(c, service.GetCampaignStatsInput{CampaignID: *id})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "campaign\t%d\n", res.CampaignID)
+	fmt.Fprintf(w, "reservations\t%d\n", res.Reservations)
+	fmt.Fprintf(w, "winners\t%d\n", res.Winners)
+	fmt.Fprintf(w, "win ratio\t%.4f (target %.4f)\n", res.WinRatio, res.TargetWinRatio)
+	fmt.Fprintf(w, "claimed\t%d\n", res.Claimed)
+	fmt.Fprintf(w, "redeemed\t%d\n", res.Redeemed)
+	for _, m := range res.ReservationsPerMinute {
+		fmt.Fprintf(w, "%s\t%d\n", formatTime(m.Minute), m.Count)
+	}
+	return w.Flush()
+}
+
+func draw(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("draw", flag.ExitOnError)
+	id := fs.Uint("id", 0, "campaign id")
+	force := fs.Bool("force", false, "run outside of the reallocation window, or re-run an already reallocated campaign")
+	fs.Parse(args)
+	if *id == 0 {
+		return errUsage
+	}
+
+	res, err := campaignService.ReallocateCoupons(c, service.ReallocateCouponsInput{
+		CampaignID: *id,
+		Force:      *force,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("campaign %d: %d unclaimed, %d reallocated\n", res.CampaignID, res.Unclaimed, res.Reallocated)
+	return nil
+}
+
+func export(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	id := fs.Uint("id", 0, "campaign id")
+	format := fs.String("format", "csv", "csv or ndjson")
+	all := fs.Bool("all", false, "export all reservations instead of winners only")
+	fs.Parse(args)
+	if *id == 0 || (*format != "csv" && *format != "ndjson") {
+		return errUsage
+	}
+
+	input := service.ExportCouponReservationsInput{
+		CampaignID:  *id,
+		WinnersOnly: !*all,
+	}
+	if *format == "ndjson" {
+		enc := json.NewEncoder(os.Stdout)
+		return campaignService.ExportCouponReservations(c, input, func(r service.CouponReservation) error {
+			return enc.Encode(map[string]any{
+				"user_id":     r.UserID,
+				"coupon_code": r.CouponCode,
+				"reserved_at": r.Created,
+				"claimed_at":  r.ClaimedAt,
+			})
+		})
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write([]string{"user_id", "coupon_code", "reserved_at", "claimed_at"}); err != nil {
+		return err
+	}
+	if err := campaignService.ExportCouponReservations(c, input, func(r service.CouponReservation) error {
+		return w.Write([]string{
+			r.UserID,
+			r.CouponCode,
+			strconv.FormatInt(r.Created, 10),
+			strconv.FormatInt(r.ClaimedAt, 10),
+		})
+	}); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func fairness(c ctx.CTX, campaignService service.CampaignService, args []string) error {
+	fs := flag.NewFlagSet("fairness", flag.ExitOnError)
+	id := fs.Uint("id", 0, "campaign id")
+	prefixLength := fs.Int("prefix-length", 1, "group user ids by this many leading characters")
+	fs.Parse(args)
+	if *id == 0 || *prefixLength <= 0 {
+		return errUsage
+	}
+
+	res, err := campaignService.GetFairnessReport(c, service.GetFairnessReportInput{
+		CampaignID:   *id,
+		PrefixLength: *prefixLength,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "campaign\t%d\n", res.CampaignID)
+	fmt.Fprintf(w, "reservations\t%d\n", res.Reservations)
+	fmt.Fprintf(w, "winners\t%d (expected %.1f)\n", res.Winners, res.ExpectedWinners)
+	fmt.Fprintf(w, "win ratio\t%.4f (target %.4f, 99%% interval %.4f - %.4f)\n", res.WinRatio, res.TargetWinRatio, res.WinRatioLow, res.WinRatioHigh)
+	fmt.Fprintf(w, "result\t%s\n", fairnessResult(res.Flagged))
+	for _, check := range res.Checks {
+		fmt.Fprintf(w, "\n%s: chi-square %.2f, df %d, p-value %.4f, %s\n",
+			check.Name, check.ChiSquare, check.DegreesOfFreedom, check.PValue, fairnessResult(check.Flagged))
+		fmt.Fprintln(w, "GROUP\tRESERVATIONS\tWINNERS\tEXPECTED\tZ\t")
+		for _, g := range check.Groups {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%.2f\t%s\n",
+				g.Key, g.Reservations, g.Winners, g.Expected, g.ZScore, fairnessResult(g.Flagged))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if res.Flagged {
+		return errors.New("unfair draw detected")
+	}
+	return nil
+}
+
+func fairnessResult(flagged bool) string {
+	if flagged {
+		return "FLAGGED"
+	}
+	return "ok"
+}
+
+// proof is the response of GET /campaigns/:id/proof
+type proof struct {
+	CampaignID uint   `json:"campaign_id"`
+	SeedHash   string `json:"seed_hash"`
+	Seed       string `json:"seed"`
+	Threshold  string `json:"threshold"`
+}
+
+// verify checks the revealed seed against its commitment, then either prints the result of
+// the user ids read from in, or compares the recomputed result with the stored reservations.
+// The database is only opened by newCampaignService without a proof file.
+func verify(c ctx.CTX, newCampaignService func() (service.CampaignService, error), args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	id := fs.Uint("id", 0, "campaign id, compares the draw with the reservations in the database")
+	proofFile := fs.String("proof", "", "proof JSON from GET /campaigns/:id/proof, reads user ids from stdin, one per line or the first CSV column")
+	fs.Parse(args)
+	if (*id == 0) == (*proofFile == "") {
+		return errUsage
+	}
+
+	var (
+		p               proof
+		campaignService service.CampaignService
+	)
+	if *proofFile != "" {
+		b, err := os.ReadFile(*proofFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &p); err != nil {
+			return fmt.Errorf("invalid proof: %w", err)
+		}
+	} else {
+		var err error
+		if campaignService, err = newCampaignService(); err != nil {
+			return err
+		}
+		res, err := campaignService.GetProof(c, service.GetCampaignProofInput{CampaignID: *id})
+		if err != nil {
+			return err
+		}
+		p = proof{
+			CampaignID: res.CampaignID,
+			SeedHash:   res.SeedHash,
+			Seed:       res.Seed,
+			Threshold:  strconv.FormatUint(res.Threshold, 10),
+		}
+	}
+
+	if p.Seed == "" {
+		return errors.New("seed isn't revealed yet")
+	}
+	seed := lottery.Seed(p.Seed)
+	if !lottery.Verify(seed, p.SeedHash) {
+		return errors.New("seed doesn't match the seed hash")
+	}
+	threshold, err := strconv.ParseUint(p.Threshold, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid threshold: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "campaign %d: seed matches the seed hash\n", p.CampaignID)
+
+	if *proofFile != "" {
+		r := csv.NewReader(in)
+		r.FieldsPerRecord = -1
+		w := csv.NewWriter(out)
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			userID := record[0]
+			if userID == "user_id" {
+				continue
+			}
+			won, err := lottery.Won(seed, p.CampaignID, userID, threshold)
+			if err != nil {
+				return err
+			}
+			if err := w.Write([]string{userID, strconv.FormatBool(won)}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	// 重新計算每個預約的結果，和資料庫中的抽獎結果比對
+	var reservations, mismatches int
+	input := service.ExportCouponReservationsInput{CampaignID: p.CampaignID}
+	if err := campaignService.ExportCouponReservations(c, input, func(r service.CouponReservation) error {
+		won, err := lottery.Won(seed, p.CampaignID, r.UserID, threshold)
+		if err != nil {
+			return err
+		}
+		reservations++
+		if won != r.WonDraw {
+			mismatches++
+			fmt.Fprintf(out, "%s: recomputed %t, drawn %t\n", r.UserID, won, r.WonDraw)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "campaign %d: %d reservations, %d mismatches\n", p.CampaignID, reservations, mismatches)
+	if mismatches != 0 {
+		return errors.New("draw doesn't match the proof")
+	}
+	return nil
+}
+
+func printCampaigns(out io.Writer, campaigns []service.Campaign) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRESERVATION\tGRAB\tREALLOCATE\tCANCELLED")
+	for _, c := range campaigns {
+		fmt.Fprintf(w, "%d\t%s - %s\t%s - %s\t%t\t%t\n",
+			c.ID,
+			formatTime(c.ReservationStartAt), formatTime(c.ReservationEndAt),
+			formatTime(c.GrabStartAt), formatTime(c.GrabEndAt),
+			c.ReallocateUnclaimed, c.CancelledAt != 0)
+	}
+	w.Flush()
+}
+
+// inMemoryDSN reports whether dsn is a sqlite in-memory database
+func inMemoryDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+func parseTime(s string) (int64, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).Format(time.RFC3339)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/config"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
+	"github.com/stretchr/testify/suite"
+)
+
+type couponctlSuite struct {
+	suite.Suite
+	ctx ctx.CTX
+	cfg *config.Config
+}
+
+func (s *couponctlSuite) SetupTest() {
+	s.ctx = ctx.Background()
+	// 預設的設定沒有資料庫
+	cfg := config.Default()
+	s.cfg = &cfg
+}
+
+// writeProof writes the proof of a commit-reveal campaign revealing seed
+func (s *couponctlSuite) writeProof(seed lottery.Seed, threshold uint64) string {
+	seedHash, err := lottery.Commit(seed)
+	s.Require().NoError(err)
+	b, err := json.Marshal(proof{
+		CampaignID: 1,
+		SeedHash:   seedHash,
+		Seed:       string(seed),
+		Threshold:  strconv.FormatUint(threshold, 10),
+	})
+	s.Require().NoError(err)
+	path := filepath.Join(s.T().TempDir(), "proof.json")
+	s.Require().NoError(os.WriteFile(path, b, 0o600))
+	return path
+}
+
+func (s *couponctlSuite) newCampaignService() (service.CampaignService, error) {
+	return newCampaignService(s.ctx, s.cfg)
+}
+
+func (s *couponctlSuite) TestVerifyProofWithoutDatabase() {
+	seed, err := lottery.NewSeed()
+	s.Require().NoError(err)
+	threshold := lottery.Threshold(0.2)
+	path := s.writeProof(seed, threshold)
+
+	// verify -proof 不需要資料庫，任何人都可以用公開的 proof 重算
+	var out bytes.Buffer
+	err = verify(s.ctx, func() (service.CampaignService, error) {
+		s.Fail("database opened")
+		return s.newCampaignService()
+	}, []string{"-proof", path}, strings.NewReader("user_id\nuser_id_1\nuser_id_2,2024-08-26\n"), &out)
+	s.NoError(err)
+
+	var expected strings.Builder
+	for _, userID := range []string{"user_id_1", "user_id_2"} {
+		won, err := lottery.Won(seed, 1, userID, threshold)
+		s.Require().NoError(err)
+		expected.WriteString(userID + "," + strconv.FormatBool(won) + "\n")
+	}
+	s.Equal(expected.String(), out.String())
+}
+
+func (s *couponctlSuite) TestVerifyProofWithMismatchedSeed() {
+	seed, err := lottery.NewSeed()
+	s.Require().NoError(err)
+	path := s.writeProof(seed, lottery.Threshold(0.2))
+	b, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	another, err := lottery.NewSeed()
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(path, bytes.Replace(b, []byte(seed), []byte(another), 1), 0o600))
+
+	err = verify(s.ctx, s.newCampaignService, []string{"-proof", path}, strings.NewReader(""), &bytes.Buffer{})
+	s.EqualError(err, "seed doesn't match the seed hash")
+}
+
+func (s *couponctlSuite) TestVerifyCampaignWithoutDatabase() {
+	// 和資料庫比對時一樣需要指定資料庫
+	err := verify(s.ctx, s.newCampaignService, []string{"-id", "1"}, strings.NewReader(""), &bytes.Buffer{})
+	s.Equal(errNoDatabase, err)
+
+	_, err = openDB(s.cfg)
+	s.Equal(errNoDatabase, err)
+}
+
+func TestCouponctlSuite(t *testing.T) {
+	suite.Run(t, new(couponctlSuite))
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middlewares is the chain every request goes through, in order: RequestContext builds the
+// request context, AccessLog logs and Metrics counts the request, and Recovery turns a panic
+// into a 500 inside both so the 500 is logged and counted.
+func Middlewares() []gin.HandlerFunc {
+	return []gin.HandlerFunc{RequestContext(), AccessLog(), Metrics(), Recovery()}
+}
+
+// AccessLog is a middleware logging each request as one entry after it's served,
+// it must be registered after RequestContext to carry the request id and trace.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		fields := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"status", status,
+			"latency", time.Since(start),
+			"bytes", max(c.Writer.Size(), 0),
+			"user", c.GetString(actorKey),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, "errors", c.Errors.String())
+		}
+
+		// 5xx 已經由發生錯誤的地方記錄過，這裡不再重複記錄成 error
+		reqCTX := requestContext(c)
+		if status >= http.StatusBadRequest {
+			reqCTX.Warnw("request served", fields...)
+		} else {
+			reqCTX.Infow("request served", fields...)
+		}
+	}
+}
+
+// Recovery is a middleware turning a panic into a 500 JSON response and an error log with the stack,
+// it must be registered after AccessLog and Metrics so the 500 is logged and counted.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// net/http aborts the response on ErrAbortHandler without logging, keep that behavior
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(r)
+			}
+
+			requestContext(c).Errorw("panic recovered", "panic", r, "stack", string(debug.Stack()))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+		}()
+		c.Next()
+	}
+}
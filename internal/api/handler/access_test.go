@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type accessLogSuite struct {
+	suite.Suite
+	router        *gin.Engine
+	logs          *observer.ObservedLogs
+	restoreLogger func()
+}
+
+func (s *accessLogSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	s.router = gin.New()
+	s.router.Use(Middlewares()...)
+	s.router.GET("/campaigns/:id", func(c *gin.Context) {
+		userContext(c, "user_id_1")
+		c.String(http.StatusOK, "ok")
+	})
+	s.router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+}
+
+func (s *accessLogSuite) SetupTest() {
+	var core zapcore.Core
+	core, s.logs = observer.New(zapcore.InfoLevel)
+	s.restoreLogger = ctx.SetLogger(zap.New(core))
+}
+
+func (s *accessLogSuite) TearDownTest() {
+	s.restoreLogger()
+}
+
+func (s *accessLogSuite) request(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(requestIDHeader, "request_id")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *accessLogSuite) TestAccessLog() {
+	w := s.request("/campaigns/1")
+	s.Equal(http.StatusOK, w.Code)
+
+	entries := s.logs.FilterMessage("request served").All()
+	s.Len(entries, 1)
+	s.Equal(zapcore.InfoLevel, entries[0].Level)
+	fields := entries[0].ContextMap()
+	s.Equal("GET", fields["method"])
+	s.Equal("/campaigns/:id", fields["route"])
+	s.Equal(int64(http.StatusOK), fields["status"])
+	s.Equal(int64(2), fields["bytes"])
+	s.Equal("user:user_id_1", fields["user"])
+	s.Equal("request_id", fields["request_id"])
+	s.NotEmpty(fields["trace_id"])
+	s.Contains(fields, "latency")
+}
+
+func (s *accessLogSuite) TestRecovery() {
+	w := s.request("/panic")
+	s.Equal(http.StatusInternalServerError, w.Code)
+	var res map[string]string
+	s.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	s.Equal("internal server error", res["error"])
+
+	panics := s.logs.FilterMessage("panic recovered").All()
+	s.Len(panics, 1)
+	s.Equal(zapcore.ErrorLevel, panics[0].Level)
+	s.Equal("boom", panics[0].ContextMap()["panic"])
+	s.Contains(panics[0].ContextMap()["stack"], "runtime/debug.Stack")
+
+	// 被 recover 的請求也會有 access log
+	entries := s.logs.FilterMessage("request served").All()
+	s.Len(entries, 1)
+	s.Equal(int64(http.StatusInternalServerError), entries[0].ContextMap()["status"])
+}
+
+func TestAccessLogSuite(t *testing.T) {
+	suite.Run(t, new(accessLogSuite))
+}
@@ -0,0 +1,745 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+)
+
+type Role string
+
+const (
+	// RoleAdmin can manage campaigns
+	RoleAdmin Role = "admin"
+	// RoleSupport can only read campaigns
+	RoleSupport Role = "support"
+)
+
+const (
+	adminUserKey = "admin_user"
+
+	// flush the exported rows to the client every exportFlushRows rows
+	exportFlushRows = 100
+)
+
+// AdminUser is the operator authenticated by a bearer token
+type AdminUser struct {
+	Name string
+	Role Role
+}
+
+type adminHandler struct {
+	campaignService service.CampaignService
+	tokens          map[string]AdminUser
+	cfg             Config
+}
+
+// RegisterAdminHTTPHandler registers the admin API, tokens maps bearer tokens to operators.
+func RegisterAdminHTTPHandler(r *gin.Engine, campaignService service.CampaignService, tokens map[string]AdminUser, cfg Config) {
+	h := adminHandler{
+		campaignService: campaignService,
+		tokens:          tokens,
+		cfg:             cfg,
+	}
+
+	g := r.Group("/admin", h.authenticate)
+	readers := h.authorize(RoleAdmin, RoleSupport)
+	writers := h.authorize(RoleAdmin)
+	idempotent := cfg.Idempotency.Handler(campaignEnd(campaignService))
+
+	// Create campaign
+	g.POST("/campaigns", writers, idempotent, h.CreateCampaign)
+	// List campaigns
+	g.GET("/campaigns", readers, h.ListCampaigns)
+	// Get campaign
+	g.GET("/campaigns/:id", readers, h.GetCampaign)
+	// Update campaign windows before opening
+	g.PUT("/campaigns/:id", writers, idempotent, h.UpdateCampaign)
+	// Cancel campaign
+	g.POST("/campaigns/:id/cancel", writers, idempotent, h.CancelCampaign)
+	// Export winners of campaign
+	g.GET("/campaigns/:id/winners", readers, h.ExportWinners)
+	// Check draw result of campaign against win ratio
+	g.GET("/campaigns/:id/fairness", readers, h.GetFairnessReport)
+	// Redeem the claimed coupon of a user
+	g.POST("/campaigns/:id/reservations/:user_id/redeem", writers, idempotent, h.RedeemCouponReservation)
+	// List audit logs by campaign_id and/or user_id
+	g.GET("/audit-logs", readers, h.ListAuditLogs)
+
+	// Get campaign statistics, served next to the public API but only to the operators
+	r.GET("/campaigns/:id/stats", h.authenticate, readers, h.GetCampaignStats)
+}
+
+func (h adminHandler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	user, ok := h.tokens[token]
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Set(adminUserKey, user)
+	c.Set(actorKey, "admin:"+user.Name)
+	c.Next()
+}
+
+func (h adminHandler) authorize(roles ...Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(adminUserKey).(AdminUser)
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
+
+type campaignRequest struct {
+	ReservationStartAt  int64 `json:"reservation_start_at" binding:"required"`
+	ReservationEndAt    int64 `json:"reservation_end_at" binding:"required"`
+	GrabStartAt         int64 `json:"grab_start_at" binding:"required"`
+	GrabEndAt           int64 `json:"grab_end_at" binding:"required"`
+	ReallocateUnclaimed bool  `json:"reallocate_unclaimed"`
+}
+
+type campaignResponse struct {
+	ID                  uint   `json:"id"`
+	Created             int64  `json:"created"`
+	Updated             int64  `json:"updated"`
+	ReservationStartAt  int64  `json:"reservation_start_at"`
+	ReservationEndAt    int64  `json:"reservation_end_at"`
+	GrabStartAt         int64  `json:"grab_start_at"`
+	GrabEndAt           int64  `json:"grab_end_at"`
+	ReallocateUnclaimed bool   `json:"reallocate_unclaimed"`
+	ReallocatedAt       int64  `json:"reallocated_at"`
+	CancelledAt         int64  `json:"cancelled_at"`
+	ScheduleKey         string `json:"schedule_key"`
+	DrawMode            string `json:"draw_mode"`
+	SeedHash            string `json:"seed_hash"`
+}
+
+type listCampaignsResponse struct {
+	Campaigns  []campaignResponse `json:"campaigns"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+func (h adminHandler) CreateCampaign(c *gin.Context) {
+	ctx := h.context(c)
+
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request",
+		})
+		return
+	}
+
+	input := service.CreateCampaignInput{
+		ReservationStartAt:  req.ReservationStartAt,
+		ReservationEndAt:    req.ReservationEndAt,
+		GrabStartAt:         req.GrabStartAt,
+		GrabEndAt:           req.GrabEndAt,
+		ReallocateUnclaimed: req.ReallocateUnclaimed,
+	}
+	campaign, err := h.campaignService.Create(ctx, input)
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCampaignResponse(campaign))
+}
+
+func (h adminHandler) ListCampaigns(c *gin.Context) {
+	ctx := h.context(c)
+
+	// cursor 是上一頁最後一筆的 campaign id
+	cursor := 0
+	var err error
+	if v := c.Query("cursor"); v != "" {
+		cursor, err = strconv.Atoi(v)
+		if err != nil || cursor < 0 {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid cursor",
+			})
+			return
+		}
+	}
+
+	limit := h.cfg.DefaultPageLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > h.cfg.MaxPageLimit {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit",
+			})
+			return
+		}
+	}
+
+	page, err := h.campaignService.List(ctx, service.ListCampaignsInput{
+		Cursor: uint(cursor),
+		Limit:  limit,
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	res := listCampaignsResponse{
+		Campaigns: make([]campaignResponse, 0, len(page.Campaigns)),
+	}
+	for i := range page.Campaigns {
+		res.Campaigns = append(res.Campaigns, toCampaignResponse(&page.Campaigns[i]))
+	}
+	if page.NextCursor != 0 {
+		res.NextCursor = strconv.FormatUint(uint64(page.NextCursor), 10)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h adminHandler) GetCampaign(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	campaign, err := h.campaignService.Get(ctx, service.GetCampaignInput{ID: uint(campaignID)})
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCampaignResponse(campaign))
+}
+
+func (h adminHandler) UpdateCampaign(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request",
+		})
+		return
+	}
+
+	input := service.UpdateCampaignInput{
+		ID:                  uint(campaignID),
+		ReservationStartAt:  req.ReservationStartAt,
+		ReservationEndAt:    req.ReservationEndAt,
+		GrabStartAt:         req.GrabStartAt,
+		GrabEndAt:           req.GrabEndAt,
+		ReallocateUnclaimed: req.ReallocateUnclaimed,
+	}
+	campaign, err := h.campaignService.Update(ctx, input)
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCampaignResponse(campaign))
+}
+
+func (h adminHandler) CancelCampaign(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	campaign, err := h.campaignService.Cancel(ctx, service.CancelCampaignInput{ID: uint(campaignID)})
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCampaignResponse(campaign))
+}
+
+type exportRow struct {
+	UserID     string `json:"user_id"`
+	CouponCode string `json:"coupon_code"`
+	ReservedAt int64  `json:"reserved_at"`
+	ClaimedAt  int64  `json:"claimed_at"`
+}
+
+// ExportWinners streams the reservations of a campaign as csv or ndjson,
+// filter=all exports all reservations instead of winners only.
+func (h adminHandler) ExportWinners(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid format",
+		})
+		return
+	}
+
+	filter := c.DefaultQuery("filter", "winners")
+	if filter != "winners" && filter != "all" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid filter",
+		})
+		return
+	}
+
+	var writeHeader func() error
+	var write func(exportRow) error
+	var flush func() error
+	switch format {
+	case "csv":
+		w := csv.NewWriter(c.Writer)
+		writeHeader = func() error {
+			c.Header("Content-Type", "text/csv")
+			return w.Write([]string{"user_id", "coupon_code", "reserved_at", "claimed_at"})
+		}
+		write = func(r exportRow) error {
+			return w.Write([]string{
+				r.UserID,
+				r.CouponCode,
+				strconv.FormatInt(r.ReservedAt, 10),
+				strconv.FormatInt(r.ClaimedAt, 10),
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	case "ndjson":
+		enc := json.NewEncoder(c.Writer)
+		writeHeader = func() error {
+			c.Header("Content-Type", "application/x-ndjson")
+			return nil
+		}
+		write = func(r exportRow) error {
+			return enc.Encode(r)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	// header 在第一筆資料寫出前才送出，campaign 不存在時還能回傳 404
+	rows := 0
+
+	input := service.ExportCouponReservationsInput{
+		CampaignID:  uint(campaignID),
+		WinnersOnly: filter == "winners",
+	}
+	err = h.campaignService.ExportCouponReservations(ctx, input, func(r service.CouponReservation) error {
+		if rows == 0 {
+			if err := writeHeader(); err != nil {
+				return err
+			}
+		}
+		if err := write(exportRow{
+			UserID:     r.UserID,
+			CouponCode: r.CouponCode,
+			ReservedAt: r.Created,
+			ClaimedAt:  r.ClaimedAt,
+		}); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil && rows == 0 {
+		writeCampaignError(c, err)
+		return
+	} else if err != nil {
+		// 已經開始輸出，只能中斷連線
+		ctx.Error(err)
+		c.Abort()
+		return
+	}
+
+	if rows == 0 {
+		if err := writeHeader(); err != nil {
+			ctx.Error(err)
+			return
+		}
+	}
+	if err := flush(); err != nil {
+		ctx.Error(err)
+	}
+	c.Status(http.StatusOK)
+}
+
+type fairnessGroupResponse struct {
+	Key          string  `json:"key"`
+	Reservations int64   `json:"reservations"`
+	Winners      int64   `json:"winners"`
+	Expected     float64 `json:"expected"`
+	ZScore       float64 `json:"z_score"`
+	Flagged      bool    `json:"flagged"`
+}
+
+type fairnessCheckResponse struct {
+	Name             string                  `json:"name"`
+	Groups           []fairnessGroupResponse `json:"groups"`
+	ChiSquare        float64                 `json:"chi_square"`
+	DegreesOfFreedom int                     `json:"degrees_of_freedom"`
+	PValue           float64                 `json:"p_value"`
+	Flagged          bool                    `json:"flagged"`
+}
+
+type fairnessReportResponse struct {
+	CampaignID      uint                    `json:"campaign_id"`
+	Reservations    int64                   `json:"reservations"`
+	Winners         int64                   `json:"winners"`
+	ExpectedWinners float64                 `json:"expected_winners"`
+	WinRatio        float64                 `json:"win_ratio"`
+	TargetWinRatio  float64                 `json:"target_win_ratio"`
+	WinRatioLow     float64                 `json:"win_ratio_low"`
+	WinRatioHigh    float64                 `json:"win_ratio_high"`
+	Flagged         bool                    `json:"flagged"`
+	Checks          []fairnessCheckResponse `json:"checks"`
+}
+
+// GetFairnessReport compares the draw result with the win ratio, user ids are grouped by
+// their first prefix_length characters.
+func (h adminHandler) GetFairnessReport(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	prefixLength := 1
+	if v := c.Query("prefix_length"); v != "" {
+		prefixLength, err = strconv.Atoi(v)
+		if err != nil || prefixLength <= 0 {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid prefix length",
+			})
+			return
+		}
+	}
+
+	report, err := h.campaignService.GetFairnessReport(ctx, service.GetFairnessReportInput{
+		CampaignID:   uint(campaignID),
+		PrefixLength: prefixLength,
+	})
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	res := fairnessReportResponse{
+		CampaignID:      report.CampaignID,
+		Reservations:    report.Reservations,
+		Winners:         report.Winners,
+		ExpectedWinners: report.ExpectedWinners,
+		WinRatio:        report.WinRatio,
+		TargetWinRatio:  report.TargetWinRatio,
+		WinRatioLow:     report.WinRatioLow,
+		WinRatioHigh:    report.WinRatioHigh,
+		Flagged:         report.Flagged,
+		Checks:          make([]fairnessCheckResponse, 0, len(report.Checks)),
+	}
+	for _, check := range report.Checks {
+		groups := make([]fairnessGroupResponse, 0, len(check.Groups))
+		for _, g := range check.Groups {
+			groups = append(groups, fairnessGroupResponse{
+				Key:          g.Key,
+				Reservations: g.Reservations,
+				Winners:      g.Winners,
+				Expected:     g.Expected,
+				ZScore:       g.ZScore,
+				Flagged:      g.Flagged,
+			})
+		}
+		res.Checks = append(res.Checks, fairnessCheckResponse{
+			Name:             check.Name,
+			Groups:           groups,
+			ChiSquare:        check.ChiSquare,
+			DegreesOfFreedom: check.DegreesOfFreedom,
+			PValue:           check.PValue,
+			Flagged:          check.Flagged,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+type minuteCountResponse struct {
+	Minute int64 `json:"minute"`
+	Count  int64 `json:"count"`
+}
+
+type getCampaignStatsResponse struct {
+	CampaignID            uint                  `json:"campaign_id"`
+	Reservations          int64                 `json:"reservations"`
+	Winners               int64                 `json:"winners"`
+	WinRatio              float64               `json:"win_ratio"`
+	TargetWinRatio        float64               `json:"target_win_ratio"`
+	Claimed               int64                 `json:"claimed"`
+	Redeemed              int64                 `json:"redeemed"`
+	ReservationsPerMinute []minuteCountResponse `json:"reservations_per_minute"`
+}
+
+func (h adminHandler) GetCampaignStats(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	stats, err := h.campaignService.GetStats(ctx, service.GetCampaignStatsInput{CampaignID: uint(campaignID)})
+	if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	res := getCampaignStatsResponse{
+		CampaignID:            stats.CampaignID,
+		Reservations:          stats.Reservations,
+		Winners:               stats.Winners,
+		WinRatio:              stats.WinRatio,
+		TargetWinRatio:        stats.TargetWinRatio,
+		Claimed:               stats.Claimed,
+		Redeemed:              stats.Redeemed,
+		ReservationsPerMinute: make([]minuteCountResponse, 0, len(stats.ReservationsPerMinute)),
+	}
+	for _, m := range stats.ReservationsPerMinute {
+		res.ReservationsPerMinute = append(res.ReservationsPerMinute, minuteCountResponse{
+			Minute: m.Minute,
+			Count:  m.Count,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// RedeemCouponReservation redeems the claimed coupon of the user in the user_id param,
+// e.g. when the user shows it at the counter.
+func (h adminHandler) RedeemCouponReservation(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	input := service.RedeemCouponReservationInput{
+		CampaignID: uint(campaignID),
+		UserID:     c.Param("user_id"),
+	}
+	_, err = h.campaignService.RedeemCouponReservation(ctx.With("user_id", input.UserID), input)
+	if err == service.ErrNotRedeemable {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	} else if err != nil {
+		writeCampaignError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type auditLogResponse struct {
+	ID         uint            `json:"id"`
+	Created    int64           `json:"created"`
+	CampaignID uint            `json:"campaign_id"`
+	UserID     string          `json:"user_id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	RequestID  string          `json:"request_id"`
+}
+
+type listAuditLogsResponse struct {
+	AuditLogs  []auditLogResponse `json:"audit_logs"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+func (h adminHandler) ListAuditLogs(c *gin.Context) {
+	ctx := h.context(c)
+
+	campaignID := 0
+	var err error
+	if v := c.Query("campaign_id"); v != "" {
+		campaignID, err = strconv.Atoi(v)
+		if err != nil || campaignID < 0 {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid campaign id",
+			})
+			return
+		}
+	}
+
+	// cursor 是上一頁最後一筆的 audit log id
+	cursor := 0
+	if v := c.Query("cursor"); v != "" {
+		cursor, err = strconv.Atoi(v)
+		if err != nil || cursor < 0 {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid cursor",
+			})
+			return
+		}
+	}
+
+	limit := h.cfg.DefaultPageLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > h.cfg.MaxPageLimit {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit",
+			})
+			return
+		}
+	}
+
+	page, err := h.campaignService.ListAuditLogs(ctx, service.ListAuditLogsInput{
+		CampaignID: uint(campaignID),
+		UserID:     c.Query("user_id"),
+		Cursor:     uint(cursor),
+		Limit:      limit,
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	res := listAuditLogsResponse{
+		AuditLogs: make([]auditLogResponse, 0, len(page.AuditLogs)),
+	}
+	for _, l := range page.AuditLogs {
+		res.AuditLogs = append(res.AuditLogs, auditLogResponse{
+			ID:         l.ID,
+			Created:    l.Created,
+			CampaignID: l.CampaignID,
+			UserID:     l.UserID,
+			Actor:      l.Actor,
+			Action:     string(l.Action),
+			Before:     rawJSON(l.Before),
+			After:      rawJSON(l.After),
+			RequestID:  l.RequestID,
+		})
+	}
+	if page.NextCursor != 0 {
+		res.NextCursor = strconv.FormatUint(uint64(page.NextCursor), 10)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h adminHandler) context(c *gin.Context) ctx.CTX {
+	user := c.MustGet(adminUserKey).(AdminUser)
+	return requestContext(c).With("admin", user.Name, "role", user.Role).WithActor("admin:" + user.Name)
+}
+
+func writeCampaignError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrCampaignNotFound:
+		c.Status(http.StatusNotFound)
+	case service.ErrInvalidWindow, service.ErrOverlappingWindow:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrCampaignStarted, service.ErrCampaignCancelled:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+func toCampaignResponse(c *service.Campaign) campaignResponse {
+	return campaignResponse{
+		ID:                  c.ID,
+		Created:             c.Created,
+		Updated:             c.Updated,
+		ReservationStartAt:  c.ReservationStartAt,
+		ReservationEndAt:    c.ReservationEndAt,
+		GrabStartAt:         c.GrabStartAt,
+		GrabEndAt:           c.GrabEndAt,
+		ReallocateUnclaimed: c.ReallocateUnclaimed,
+		ReallocatedAt:       c.ReallocatedAt,
+		CancelledAt:         c.CancelledAt,
+		ScheduleKey:         c.ScheduleKey,
+		DrawMode:            c.DrawMode,
+		SeedHash:            c.SeedHash,
+	}
+}
+
+// rawJSON embeds a JSON snapshot as is, an empty snapshot is null
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/internal/service/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	adminToken   = "admin_token"
+	supportToken = "support_token"
+)
+
+type adminHandlerSuite struct {
+	suite.Suite
+	router      *gin.Engine
+	mockService *mocks.CampaignService
+}
+
+func (s *adminHandlerSuite) SetupSuite() {
+	s.mockService = mocks.NewCampaignService(s.T())
+	gin.SetMode(gin.TestMode)
+	s.router = gin.Default()
+	RegisterAdminHTTPHandler(s.router, s.mockService, map[string]AdminUser{
+		adminToken:   {Name: "alice", Role: RoleAdmin},
+		supportToken: {Name: "bob", Role: RoleSupport},
+	}, DefaultConfig())
+}
+
+func (s *adminHandlerSuite) request(method, path, token string, body, res any) (int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	if res != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+			return 0, err
+		}
+	}
+
+	return w.Code, nil
+}
+
+func (s *adminHandlerSuite) TestCreateCampaign_Success() {
+	req := campaignRequest{
+		ReservationStartAt: 100,
+		ReservationEndAt:   200,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	}
+	s.mockService.On("Create", mockCTX, service.CreateCampaignInput{
+		ReservationStartAt: req.ReservationStartAt,
+		ReservationEndAt:   req.ReservationEndAt,
+		GrabStartAt:        req.GrabStartAt,
+		GrabEndAt:          req.GrabEndAt,
+	}).Return(&service.Campaign{ID: 1, ReservationStartAt: req.ReservationStartAt}, nil).Once()
+
+	var res campaignResponse
+	code, err := s.request(http.MethodPost, "/admin/campaigns", adminToken, req, &res)
+	s.NoError(err)
+	s.Equal(http.StatusCreated, code)
+	s.Equal(uint(1), res.ID)
+	s.Equal(req.ReservationStartAt, res.ReservationStartAt)
+}
+
+func (s *adminHandlerSuite) TestCreateCampaign_InvalidWindow() {
+	req := campaignRequest{
+		ReservationStartAt: 200,
+		ReservationEndAt:   100,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	}
+	s.mockService.On("Create", mockCTX, service.CreateCampaignInput{
+		ReservationStartAt: req.ReservationStartAt,
+		ReservationEndAt:   req.ReservationEndAt,
+		GrabStartAt:        req.GrabStartAt,
+		GrabEndAt:          req.GrabEndAt,
+	}).Return(nil, service.ErrInvalidWindow).Once()
+
+	code, err := s.request(http.MethodPost, "/admin/campaigns", adminToken, req, nil)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *adminHandlerSuite) TestCreateCampaign_Forbidden() {
+	code, err := s.request(http.MethodPost, "/admin/campaigns", supportToken, campaignRequest{}, nil)
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, code)
+}
+
+func (s *adminHandlerSuite) TestCreateCampaign_Unauthorized() {
+	code, err := s.request(http.MethodPost, "/admin/campaigns", "unknown_token", campaignRequest{}, nil)
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, code)
+}
+
+func (s *adminHandlerSuite) TestListCampaigns_Success() {
+	s.mockService.On("List", mockCTX, service.ListCampaignsInput{Limit: DefaultConfig().DefaultPageLimit}).Return(&service.Campaigns{
+		Campaigns: []service.Campaign{{ID: 2}, {ID: 1}},
+	}, nil).Once()
+
+	var res listCampaignsResponse
+	code, err := s.request(http.MethodGet, "/admin/campaigns", supportToken, nil, &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Len(res.Campaigns, 2)
+	s.Empty(res.NextCursor)
+}
+
+func (s *adminHandlerSuite) TestGetCampaign_NotFound() {
+	s.mockService.On("Get", mockCTX, service.GetCampaignInput{ID: 5}).Return(nil, service.ErrCampaignNotFound).Once()
+
+	code, err := s.request(http.MethodGet, "/admin/campaigns/5", supportToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *adminHandlerSuite) TestUpdateCampaign_Started() {
+	req := campaignRequest{
+		ReservationStartAt: 100,
+		ReservationEndAt:   200,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	}
+	s.mockService.On("Update", mockCTX, service.UpdateCampaignInput{
+		ID:                 1,
+		ReservationStartAt: req.ReservationStartAt,
+		ReservationEndAt:   req.ReservationEndAt,
+		GrabStartAt:        req.GrabStartAt,
+		GrabEndAt:          req.GrabEndAt,
+	}).Return(nil, service.ErrCampaignStarted).Once()
+
+	code, err := s.request(http.MethodPut, "/admin/campaigns/1", adminToken, req, nil)
+	s.NoError(err)
+	s.Equal(http.StatusConflict, code)
+}
+
+func (s *adminHandlerSuite) TestCancelCampaign_Success() {
+	s.mockService.On("Cancel", mockCTX, service.CancelCampaignInput{ID: 1}).Return(&service.Campaign{ID: 1, CancelledAt: 100}, nil).Once()
+
+	var res campaignResponse
+	code, err := s.request(http.MethodPost, "/admin/campaigns/1/cancel", adminToken, nil, &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal(int64(100), res.CancelledAt)
+}
+
+func (s *adminHandlerSuite) mockExport(input service.ExportCouponReservationsInput, reservations ...service.CouponReservation) {
+	s.mockService.On("ExportCouponReservations", mockCTX, input, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(2).(func(service.CouponReservation) error)
+		for _, r := range reservations {
+			s.NoError(fn(r))
+		}
+	}).Return(nil).Once()
+}
+
+func (s *adminHandlerSuite) TestExportWinners_CSV() {
+	s.mockExport(service.ExportCouponReservationsInput{CampaignID: 1, WinnersOnly: true},
+		service.CouponReservation{UserID: "user_id_1", CouponCode: "coupon_code_1", Created: 100, ClaimedAt: 200},
+		service.CouponReservation{UserID: "user_id_2", CouponCode: "coupon_code_2", Created: 101},
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/campaigns/1/winners", nil)
+	req.Header.Set("Authorization", "Bearer "+supportToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("text/csv", w.Header().Get("Content-Type"))
+	s.Equal("user_id,coupon_code,reserved_at,claimed_at\n"+
+		"user_id_1,coupon_code_1,100,200\n"+
+		"user_id_2,coupon_code_2,101,0\n", w.Body.String())
+}
+
+func (s *adminHandlerSuite) TestExportWinners_NDJSON() {
+	s.mockExport(service.ExportCouponReservationsInput{CampaignID: 1},
+		service.CouponReservation{UserID: "user_id_1", CouponCode: "coupon_code_1", Created: 100},
+		service.CouponReservation{UserID: "user_id_2", Created: 101},
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/campaigns/1/winners?format=ndjson&filter=all", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	s.Equal(http.StatusOK, w.Code)
+	dec := json.NewDecoder(w.Body)
+	var rows []exportRow
+	for dec.More() {
+		var row exportRow
+		s.NoError(dec.Decode(&row))
+		rows = append(rows, row)
+	}
+	s.Len(rows, 2)
+	s.Equal("user_id_2", rows[1].UserID)
+}
+
+func (s *adminHandlerSuite) TestExportWinners_InvalidFormat() {
+	code, err := s.request(http.MethodGet, "/admin/campaigns/1/winners?format=xml", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *adminHandlerSuite) TestExportWinners_NotFound() {
+	s.mockService.On("ExportCouponReservations", mockCTX, service.ExportCouponReservationsInput{CampaignID: 9, WinnersOnly: true}, mock.Anything).
+		Return(service.ErrCampaignNotFound).Once()
+
+	code, err := s.request(http.MethodGet, "/admin/campaigns/9/winners", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *adminHandlerSuite) TestListAuditLogs_Success() {
+	s.mockService.On("ListAuditLogs", mockCTX, service.ListAuditLogsInput{
+		CampaignID: 1,
+		UserID:     "user_id_1",
+		Limit:      DefaultConfig().DefaultPageLimit,
+	}).Return(&service.AuditLogs{
+		AuditLogs: []service.AuditLog{
+			{ID: 2, CampaignID: 1, UserID: "user_id_1", Actor: "user:user_id_1", Action: service.AuditActionCouponClaim,
+				Before: `{"coupon_status":"unclaimed"}`, After: `{"coupon_status":"claimed"}`, RequestID: "request_id"},
+			{ID: 1, CampaignID: 1, UserID: "user_id_1", Actor: "user:user_id_1", Action: service.AuditActionReservationCreate},
+		},
+		NextCursor: 1,
+	}, nil).Once()
+
+	var res listAuditLogsResponse
+	code, err := s.request(http.MethodGet, "/admin/audit-logs?campaign_id=1&user_id=user_id_1", supportToken, nil, &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Len(res.AuditLogs, 2)
+	s.JSONEq(`{"coupon_status":"claimed"}`, string(res.AuditLogs[0].After))
+	s.Equal("null", string(res.AuditLogs[1].Before))
+	s.Equal("1", res.NextCursor)
+}
+
+func (s *adminHandlerSuite) TestListAuditLogs_InvalidCampaignID() {
+	code, err := s.request(http.MethodGet, "/admin/audit-logs?campaign_id=abc", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *adminHandlerSuite) TestGetFairnessReport_Success() {
+	s.mockService.On("GetFairnessReport", mockCTX, service.GetFairnessReportInput{CampaignID: 1, PrefixLength: 2}).
+		Return(&service.FairnessReport{
+			CampaignID:   1,
+			Reservations: 100,
+			Winners:      20,
+			Flagged:      true,
+			Checks: []service.FairnessCheck{
+				{Name: service.FairnessCheckUserIDPrefix, Groups: []service.FairnessGroup{{Key: "ab", Reservations: 50, Winners: 20, Flagged: true}}, Flagged: true},
+			},
+		}, nil).Once()
+
+	var res fairnessReportResponse
+	code, err := s.request(http.MethodGet, "/admin/campaigns/1/fairness?prefix_length=2", supportToken, nil, &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.True(res.Flagged)
+	s.Len(res.Checks, 1)
+	s.Equal("user_id_prefix", res.Checks[0].Name)
+	s.Equal("ab", res.Checks[0].Groups[0].Key)
+}
+
+func (s *adminHandlerSuite) TestGetFairnessReport_InvalidPrefixLength() {
+	code, err := s.request(http.MethodGet, "/admin/campaigns/1/fairness?prefix_length=0", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *adminHandlerSuite) TestGetFairnessReport_NotFound() {
+	s.mockService.On("GetFairnessReport", mockCTX, service.GetFairnessReportInput{CampaignID: 9, PrefixLength: 1}).
+		Return(nil, service.ErrCampaignNotFound).Once()
+
+	code, err := s.request(http.MethodGet, "/admin/campaigns/9/fairness", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *adminHandlerSuite) TestGetCampaignStats_Success() {
+	s.mockService.On("GetStats", mockCTX, service.GetCampaignStatsInput{CampaignID: 1}).Return(&service.CampaignStats{
+		CampaignID:     1,
+		Reservations:   300,
+		Winners:        60,
+		WinRatio:       0.2,
+		TargetWinRatio: 0.2,
+		ReservationsPerMinute: []service.MinuteCount{
+			{Minute: 1724683500, Count: 300},
+		},
+	}, nil).Once()
+
+	var res getCampaignStatsResponse
+	code, err := s.request(http.MethodGet, "/campaigns/1/stats", supportToken, nil, &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal(int64(300), res.Reservations)
+	s.Equal(int64(60), res.Winners)
+	s.Len(res.ReservationsPerMinute, 1)
+}
+
+func (s *adminHandlerSuite) TestGetCampaignStats_Unauthorized() {
+	code, err := s.request(http.MethodGet, "/campaigns/1/stats", "", nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, code)
+}
+
+func (s *adminHandlerSuite) TestRedeemCouponReservation_Success() {
+	s.mockService.On("RedeemCouponReservation", mockCTX, service.RedeemCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).
+		Return(&service.CouponReservation{CampaignID: 1, UserID: "user_id_1"}, nil).Once()
+
+	code, err := s.request(http.MethodPost, "/admin/campaigns/1/reservations/user_id_1/redeem", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, code)
+}
+
+func (s *adminHandlerSuite) TestRedeemCouponReservation_NotRedeemable() {
+	s.mockService.On("RedeemCouponReservation", mockCTX, service.RedeemCouponReservationInput{CampaignID: 1, UserID: "user_id_2"}).
+		Return(nil, service.ErrNotRedeemable).Once()
+
+	code, err := s.request(http.MethodPost, "/admin/campaigns/1/reservations/user_id_2/redeem", adminToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusConflict, code)
+}
+
+func (s *adminHandlerSuite) TestRedeemCouponReservation_Forbidden() {
+	code, err := s.request(http.MethodPost, "/admin/campaigns/1/reservations/user_id_1/redeem", supportToken, nil, nil)
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, code)
+}
+
+func TestAdminHandlerSuite(t *testing.T) {
+	suite.Run(t, new(adminHandlerSuite))
+}
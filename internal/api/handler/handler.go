@@ -5,7 +5,6 @@ import (
 	"strconv"
 
 	"github.com/asymptoter/tonx-take-home-test/internal/service"
-	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -16,21 +15,65 @@ var (
 	}
 )
 
+// Config configures the pagination of the list APIs, the rate limiter of the public API
+// and the Idempotency-Key of the mutating routes
+type Config struct {
+	DefaultPageLimit int
+	MaxPageLimit     int
+	// RateLimiter is nil if the requests aren't limited
+	RateLimiter *RateLimiter
+	// Idempotency is nil if the Idempotency-Key isn't supported
+	Idempotency *Idempotency
+}
+
+// DefaultConfig lists 20 items per page and at most 100
+func DefaultConfig() Config {
+	return Config{
+		DefaultPageLimit: 20,
+		MaxPageLimit:     100,
+	}
+}
+
 type handler struct {
 	campaignService service.CampaignService
+	cfg             Config
 }
 
-func RegisterHTTPHandler(r *gin.Engine, campaignService service.CampaignService) {
+func RegisterHTTPHandler(r *gin.Engine, campaignService service.CampaignService, cfg Config) {
 	h := handler{
 		campaignService: campaignService,
+		cfg:             cfg,
 	}
 
+	// 限流在驗證用戶之後，才能依用戶計算
+	rateLimit := cfg.RateLimiter.Handler()
+	users := r.Group("", h.authenticate, rateLimit)
+	public := r.Group("", rateLimit)
+	idempotent := cfg.Idempotency.Handler(campaignEnd(campaignService))
+
 	// Get latest campaign id
-	r.GET("/campaigns/latest", h.GetLatestCampaign)
+	users.GET("/campaigns/latest", h.GetLatestCampaign)
 	// Create reservation
-	r.POST("/campaigns/:id/reservations", h.CreateCouponReservation)
+	users.POST("/campaigns/:id/reservations", idempotent, h.CreateCouponReservation)
 	// Get coupon code
-	r.GET("/campaigns/:id/reservations", h.GetCouponReservation)
+	users.GET("/campaigns/:id/reservations", h.GetCouponReservation)
+	// Claim coupon code
+	users.POST("/campaigns/:id/reservations/claim", idempotent, h.ClaimCouponReservation)
+	// Get the proof of the commit-reveal draw
+	public.GET("/campaigns/:id/proof", h.GetCampaignProof)
+	// List reservations of the user across campaigns
+	users.GET("/me/reservations", h.ListMyCouponReservations)
+}
+
+func (h handler) authenticate(c *gin.Context) {
+	userID, err := getUserID()
+	if err != nil {
+		requestContext(c).Error(err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Set(userIDKey, userID)
+	c.Next()
 }
 
 type getLatestCampaignResponse struct {
@@ -38,13 +81,8 @@ type getLatestCampaignResponse struct {
 }
 
 func (h handler) GetLatestCampaign(c *gin.Context) {
-	ctx := ctx.Background()
-	userID, err := getUserID()
-	if err != nil {
-		c.Status(http.StatusUnauthorized)
-		return
-	}
-	ctx = ctx.With("user_id", userID)
+	userID := c.GetString(userIDKey)
+	ctx := userContext(c, userID)
 
 	campaign, err := h.campaignService.GetLatest(ctx, service.GetLatestCampaignInput{})
 	if err != nil {
@@ -58,14 +96,8 @@ func (h handler) GetLatestCampaign(c *gin.Context) {
 }
 
 func (h handler) CreateCouponReservation(c *gin.Context) {
-	ctx := ctx.Background()
-	userID, err := getUserID()
-	if err != nil {
-		ctx.Error(err)
-		c.Status(http.StatusUnauthorized)
-		return
-	}
-	ctx = ctx.With("user_id", userID)
+	userID := c.GetString(userIDKey)
+	ctx := userContext(c, userID)
 
 	campaignID, err := strconv.Atoi(c.Param("id"))
 	if err != nil || campaignID < 0 {
@@ -81,9 +113,12 @@ func (h handler) CreateCouponReservation(c *gin.Context) {
 		UserID:     userID,
 	}
 	_, err = h.campaignService.CreateCouponReservation(ctx, input)
-	if err == service.ErrNotReservationTime {
+	if err == service.ErrNotReservationTime || err == service.ErrCampaignCancelled {
 		c.Status(http.StatusForbidden)
 		return
+	} else if err == service.ErrCampaignNotFound {
+		c.Status(http.StatusNotFound)
+		return
 	} else if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
@@ -97,15 +132,50 @@ type getCouponReservationResponse struct {
 }
 
 func (h handler) GetCouponReservation(c *gin.Context) {
-	ctx := ctx.Background()
+	userID := c.GetString(userIDKey)
+	ctx := userContext(c, userID)
 
-	userID, err := getUserID()
-	if err != nil {
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
 		ctx.Error(err)
-		c.Status(http.StatusUnauthorized)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
 		return
 	}
-	ctx = ctx.With("user_id", userID)
+
+	input := service.GetCouponReservationInput{
+		CampaignID: uint(campaignID),
+		UserID:     userID,
+	}
+	reservation, err := h.campaignService.GetCouponReservation(ctx, input)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, getCouponReservationResponse{
+		CouponCode: claimedCouponCode(reservation),
+	})
+}
+
+// claimedCouponCode hides the coupon code until the user claims it,
+// so the claim is the only way to grab the coupon.
+func claimedCouponCode(r *service.CouponReservation) string {
+	if r.ClaimedAt == 0 {
+		return ""
+	}
+	return r.CouponCode
+}
+
+type claimCouponReservationResponse struct {
+	CouponCode     string `json:"coupon_code"`
+	AlreadyClaimed bool   `json:"already_claimed"`
+}
+
+func (h handler) ClaimCouponReservation(c *gin.Context) {
+	userID := c.GetString(userIDKey)
+	ctx := userContext(c, userID)
 
 	campaignID, err := strconv.Atoi(c.Param("id"))
 	if err != nil || campaignID < 0 {
@@ -116,17 +186,149 @@ func (h handler) GetCouponReservation(c *gin.Context) {
 		return
 	}
 
-	input := service.GetCouponReservationInput{
+	input := service.ClaimCouponReservationInput{
 		CampaignID: uint(campaignID),
 		UserID:     userID,
 	}
-	reservation, err := h.campaignService.GetCouponReservation(ctx, input)
+	claim, err := h.campaignService.ClaimCouponReservation(ctx, input)
+	if err == service.ErrNotGrabTime || err == service.ErrCampaignCancelled {
+		c.Status(http.StatusForbidden)
+		return
+	} else if err == service.ErrCampaignNotFound || err == service.ErrReservationNotFound {
+		c.Status(http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// 每個用戶只能搶一次，之後的請求回傳同樣的結果
+	status := http.StatusOK
+	if claim.AlreadyClaimed {
+		status = http.StatusConflict
+	}
+	c.JSON(status, claimCouponReservationResponse{
+		CouponCode:     claim.Reservation.CouponCode,
+		AlreadyClaimed: claim.AlreadyClaimed,
+	})
+}
+
+type couponReservationResponse struct {
+	CampaignID   uint   `json:"campaign_id"`
+	ReservedAt   int64  `json:"reserved_at"`
+	Won          bool   `json:"won"`
+	CouponCode   string `json:"coupon_code"`
+	CouponStatus string `json:"coupon_status"`
+}
+
+type listMyCouponReservationsResponse struct {
+	Reservations []couponReservationResponse `json:"reservations"`
+	NextCursor   string                      `json:"next_cursor"`
+}
+
+func (h handler) ListMyCouponReservations(c *gin.Context) {
+	userID := c.GetString(userIDKey)
+	ctx := userContext(c, userID)
+
+	// cursor 是上一頁最後一筆的 campaign id
+	cursor := 0
+	var err error
+	if v := c.Query("cursor"); v != "" {
+		cursor, err = strconv.Atoi(v)
+		if err != nil || cursor < 0 {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid cursor",
+			})
+			return
+		}
+	}
+
+	limit := h.cfg.DefaultPageLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > h.cfg.MaxPageLimit {
+			ctx.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit",
+			})
+			return
+		}
+	}
+
+	input := service.ListUserCouponReservationsInput{
+		UserID: userID,
+		Cursor: uint(cursor),
+		Limit:  limit,
+	}
+	page, err := h.campaignService.ListUserCouponReservations(ctx, input)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, getCouponReservationResponse{
-		CouponCode: reservation.CouponCode,
+	res := listMyCouponReservationsResponse{
+		Reservations: make([]couponReservationResponse, 0, len(page.Reservations)),
+	}
+	for _, r := range page.Reservations {
+		res.Reservations = append(res.Reservations, couponReservationResponse{
+			CampaignID:   r.CampaignID,
+			ReservedAt:   r.Created,
+			Won:          r.Won(),
+			CouponCode:   claimedCouponCode(&r),
+			CouponStatus: string(r.CouponStatus),
+		})
+	}
+	if page.NextCursor != 0 {
+		res.NextCursor = strconv.FormatUint(uint64(page.NextCursor), 10)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+type getCampaignProofResponse struct {
+	CampaignID uint    `json:"campaign_id"`
+	Algorithm  string  `json:"algorithm"`
+	SeedHash   string  `json:"seed_hash"`
+	Seed       string  `json:"seed"`
+	Revealed   bool    `json:"revealed"`
+	RevealAt   int64   `json:"reveal_at"`
+	WinRatio   float64 `json:"win_ratio"`
+	// threshold 超過 2^53，用字串避免 JSON 數字失去精度
+	Threshold string `json:"threshold"`
+}
+
+// proofAlgorithm tells the verifiers how to recompute the draw, see pkg/lottery
+const proofAlgorithm = "sha256(seed) = seed_hash; won = uint64be(hmac_sha256(seed, uint64be(campaign_id) || user_id)[:8]) < threshold"
+
+func (h handler) GetCampaignProof(c *gin.Context) {
+	ctx := requestContext(c)
+
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || campaignID < 0 {
+		ctx.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid campaign id",
+		})
+		return
+	}
+
+	proof, err := h.campaignService.GetProof(ctx, service.GetCampaignProofInput{CampaignID: uint(campaignID)})
+	if err == service.ErrCampaignNotFound || err == service.ErrNoDrawProof {
+		c.Status(http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, getCampaignProofResponse{
+		CampaignID: proof.CampaignID,
+		Algorithm:  proofAlgorithm,
+		SeedHash:   proof.SeedHash,
+		Seed:       proof.Seed,
+		Revealed:   proof.Seed != "",
+		RevealAt:   proof.RevealAt,
+		WinRatio:   proof.WinRatio,
+		Threshold:  strconv.FormatUint(proof.Threshold, 10),
 	})
 }
@@ -28,7 +28,7 @@ func (s *handlerSuite) SetupSuite() {
 	s.mockService = mocks.NewCampaignService(s.T())
 	gin.SetMode(gin.TestMode)
 	s.router = gin.Default()
-	RegisterHTTPHandler(s.router, s.mockService)
+	RegisterHTTPHandler(s.router, s.mockService, DefaultConfig())
 }
 
 func (s *handlerSuite) request(method, path string, res any) (int, error) {
@@ -116,7 +116,7 @@ func (s *handlerSuite) TestGetCouponReservation_Success() {
 		CampaignID: 1,
 		UserID:     mockUserID,
 	}
-	s.mockService.On("GetCouponReservation", mockCTX, getCouponReservationInput).Return(&service.CouponReservation{CouponCode: couponCode}, nil).Once()
+	s.mockService.On("GetCouponReservation", mockCTX, getCouponReservationInput).Return(&service.CouponReservation{CouponCode: couponCode, ClaimedAt: 1}, nil).Once()
 
 	var res getCouponReservationResponse
 	code, err := s.request(http.MethodGet, "/campaigns/1/reservations", &res)
@@ -125,6 +125,26 @@ func (s *handlerSuite) TestGetCouponReservation_Success() {
 	s.Equal(couponCode, res.CouponCode)
 }
 
+func (s *handlerSuite) TestGetCouponReservation_Unclaimed() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	getCouponReservationInput := service.GetCouponReservationInput{
+		CampaignID: 1,
+		UserID:     mockUserID,
+	}
+	s.mockService.On("GetCouponReservation", mockCTX, getCouponReservationInput).Return(&service.CouponReservation{CouponCode: "coupon_code"}, nil).Once()
+
+	// 領取之前看不到 coupon code
+	var res getCouponReservationResponse
+	code, err := s.request(http.MethodGet, "/campaigns/1/reservations", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Empty(res.CouponCode)
+}
+
 func (s *handlerSuite) TestGetCouponReservation_UnexpectedError() {
 	mockUserID := "mock_user_id"
 	getUserID = func() (string, error) {
@@ -142,6 +162,162 @@ func (s *handlerSuite) TestGetCouponReservation_UnexpectedError() {
 	s.Equal(http.StatusInternalServerError, code)
 }
 
+func (s *handlerSuite) TestClaimCouponReservation_Success() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	couponCode := "coupon_code"
+	claimCouponReservationInput := service.ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     mockUserID,
+	}
+	s.mockService.On("ClaimCouponReservation", mockCTX, claimCouponReservationInput).Return(&service.CouponClaim{
+		Reservation: service.CouponReservation{CouponCode: couponCode},
+	}, nil).Once()
+
+	var res claimCouponReservationResponse
+	code, err := s.request(http.MethodPost, "/campaigns/1/reservations/claim", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal(couponCode, res.CouponCode)
+	s.False(res.AlreadyClaimed)
+}
+
+func (s *handlerSuite) TestClaimCouponReservation_AlreadyClaimed() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	couponCode := "coupon_code"
+	claimCouponReservationInput := service.ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     mockUserID,
+	}
+	s.mockService.On("ClaimCouponReservation", mockCTX, claimCouponReservationInput).Return(&service.CouponClaim{
+		Reservation:    service.CouponReservation{CouponCode: couponCode},
+		AlreadyClaimed: true,
+	}, nil).Once()
+
+	var res claimCouponReservationResponse
+	code, err := s.request(http.MethodPost, "/campaigns/1/reservations/claim", &res)
+	s.NoError(err)
+	s.Equal(http.StatusConflict, code)
+	s.Equal(couponCode, res.CouponCode)
+	s.True(res.AlreadyClaimed)
+}
+
+func (s *handlerSuite) TestClaimCouponReservation_InvalidTime() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	claimCouponReservationInput := service.ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     mockUserID,
+	}
+	s.mockService.On("ClaimCouponReservation", mockCTX, claimCouponReservationInput).Return(nil, service.ErrNotGrabTime).Once()
+
+	code, err := s.request(http.MethodPost, "/campaigns/1/reservations/claim", nil)
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, code)
+}
+
+func (s *handlerSuite) TestClaimCouponReservation_NotReserved() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	claimCouponReservationInput := service.ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     mockUserID,
+	}
+	s.mockService.On("ClaimCouponReservation", mockCTX, claimCouponReservationInput).Return(nil, service.ErrReservationNotFound).Once()
+
+	code, err := s.request(http.MethodPost, "/campaigns/1/reservations/claim", nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *handlerSuite) TestListMyCouponReservations_Success() {
+	mockUserID := "mock_user_id"
+	getUserID = func() (string, error) {
+		return mockUserID, nil
+	}
+
+	listUserCouponReservationsInput := service.ListUserCouponReservationsInput{
+		UserID: mockUserID,
+		Cursor: 5,
+		Limit:  2,
+	}
+	s.mockService.On("ListUserCouponReservations", mockCTX, listUserCouponReservationsInput).Return(&service.UserCouponReservations{
+		Reservations: []service.CouponReservation{
+			{CampaignID: 4, CouponCode: "coupon_code", ClaimedAt: 1, CouponStatus: service.CouponStatusClaimed},
+			{CampaignID: 3, CouponStatus: service.CouponStatusNone},
+			{CampaignID: 2, CouponCode: "coupon_code", CouponStatus: service.CouponStatusUnclaimed},
+		},
+		NextCursor: 3,
+	}, nil).Once()
+
+	var res listMyCouponReservationsResponse
+	code, err := s.request(http.MethodGet, "/me/reservations?cursor=5&limit=2", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Len(res.Reservations, 3)
+	s.True(res.Reservations[0].Won)
+	s.Equal("claimed", res.Reservations[0].CouponStatus)
+	s.Equal("coupon_code", res.Reservations[0].CouponCode)
+	s.False(res.Reservations[1].Won)
+	// 未領取的 coupon code 不會回傳
+	s.True(res.Reservations[2].Won)
+	s.Empty(res.Reservations[2].CouponCode)
+	s.Equal("3", res.NextCursor)
+}
+
+func (s *handlerSuite) TestListMyCouponReservations_InvalidLimit() {
+	code, err := s.request(http.MethodGet, "/me/reservations?limit=1000", nil)
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *handlerSuite) TestRemovedRoutes() {
+	// 兌換由 admin 操作
+	code, err := s.request(http.MethodPost, "/campaigns/1/reservations/redeem", nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *handlerSuite) TestGetCampaignProof_Success() {
+	s.mockService.On("GetProof", mockCTX, service.GetCampaignProofInput{CampaignID: 1}).Return(&service.CampaignProof{
+		CampaignID: 1,
+		SeedHash:   "seed_hash",
+		Seed:       "seed",
+		WinRatio:   0.5,
+		Threshold:  1 << 63,
+		RevealAt:   1724684460,
+	}, nil).Once()
+
+	var res getCampaignProofResponse
+	code, err := s.request(http.MethodGet, "/campaigns/1/proof", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal("seed", res.Seed)
+	s.True(res.Revealed)
+	s.Equal("9223372036854775808", res.Threshold)
+}
+
+func (s *handlerSuite) TestGetCampaignProof_NoDrawProof() {
+	s.mockService.On("GetProof", mockCTX, service.GetCampaignProofInput{CampaignID: 2}).Return(nil, service.ErrNoDrawProof).Once()
+
+	code, err := s.request(http.MethodGet, "/campaigns/2/proof", nil)
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, code)
+}
+
 // Test Suite Runner
 func TestHandlerSuite(t *testing.T) {
 	suite.Run(t, new(handlerSuite))
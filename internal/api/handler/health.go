@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+)
+
+// readinessCheckTimeout bounds each readiness check so a stuck dependency can't hang the probe
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck is a dependency which must be healthy before the instance serves traffic
+type ReadinessCheck struct {
+	Name  string
+	Check func(c ctx.CTX) error
+}
+
+type healthHandler struct {
+	checks []ReadinessCheck
+}
+
+// RegisterHealthHTTPHandler registers /healthz for liveness and /readyz running checks for readiness
+func RegisterHealthHTTPHandler(r *gin.Engine, checks ...ReadinessCheck) {
+	h := healthHandler{
+		checks: checks,
+	}
+
+	// Process is alive
+	r.GET("/healthz", h.Healthz)
+	// Dependencies are ready
+	r.GET("/readyz", h.Readyz)
+}
+
+type checkResponse struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type readyzResponse struct {
+	Status string                   `json:"status"`
+	Checks map[string]checkResponse `json:"checks"`
+}
+
+func (h healthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func (h healthHandler) Readyz(c *gin.Context) {
+	ctx := requestContext(c)
+
+	res := readyzResponse{
+		Status: "ok",
+		Checks: make(map[string]checkResponse, len(h.checks)),
+	}
+	for _, check := range h.checks {
+		// 從請求的 ctx 衍生，check 的 log 和 span 仍帶有 request_id 和 trace_id
+		timeoutCTX, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+		start := time.Now()
+		err := check.Check(ctx.WithContext(timeoutCTX).With("check", check.Name))
+		cancel()
+
+		r := checkResponse{
+			Status:     "ok",
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			r.Status = "fail"
+			r.Error = err.Error()
+			res.Status = "unavailable"
+		}
+		res.Checks[check.Name] = r
+	}
+
+	status := http.StatusOK
+	if res.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, res)
+}
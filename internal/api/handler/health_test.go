@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type healthHandlerSuite struct {
+	suite.Suite
+	dbErr error
+	// dbCTX is the ctx the database check ran with
+	dbCTX  ctx.CTX
+	router *gin.Engine
+}
+
+func (s *healthHandlerSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	s.router = gin.Default()
+	s.router.Use(RequestContext())
+	RegisterHealthHTTPHandler(s.router,
+		ReadinessCheck{Name: "database", Check: func(c ctx.CTX) error {
+			s.dbCTX = c
+			return s.dbErr
+		}},
+		ReadinessCheck{Name: "migrations", Check: func(c ctx.CTX) error { return nil }},
+	)
+}
+
+func (s *healthHandlerSuite) SetupTest() {
+	s.dbErr = nil
+}
+
+func (s *healthHandlerSuite) request(path string, res any) (int, error) {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		return 0, err
+	}
+	return w.Code, nil
+}
+
+func (s *healthHandlerSuite) TestHealthz() {
+	var res map[string]string
+	code, err := s.request("/healthz", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal("ok", res["status"])
+}
+
+func (s *healthHandlerSuite) TestReadyz() {
+	var res readyzResponse
+	code, err := s.request("/readyz", &res)
+	s.NoError(err)
+	s.Equal(http.StatusOK, code)
+	s.Equal("ok", res.Status)
+	s.Equal("ok", res.Checks["database"].Status)
+	s.Equal("ok", res.Checks["migrations"].Status)
+}
+
+func (s *healthHandlerSuite) TestReadyz_Unavailable() {
+	s.dbErr = errors.New("database is closed")
+
+	var res readyzResponse
+	code, err := s.request("/readyz", &res)
+	s.NoError(err)
+	s.Equal(http.StatusServiceUnavailable, code)
+	s.Equal("unavailable", res.Status)
+	s.Equal("fail", res.Checks["database"].Status)
+	s.Equal("database is closed", res.Checks["database"].Error)
+	s.Equal("ok", res.Checks["migrations"].Status)
+}
+
+func (s *healthHandlerSuite) TestReadyzWithRequestContext() {
+	s.dbErr = errors.New("database is closed")
+	exporter := tracetest.NewInMemoryExporter()
+	defer ctx.SetSpanExporter(exporter)()
+
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+	req.Header.Set(requestIDHeader, "request_id")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// check 失敗時可以用 request_id 和 trace_id 找到對應的請求
+	s.Equal("request_id", s.dbCTX.RequestID())
+	spans := exporter.GetSpans()
+	s.Len(spans, 1)
+	s.Equal(spans[0].SpanContext.TraceID().String(), s.dbCTX.TraceID())
+	_, ok := s.dbCTX.Deadline()
+	s.True(ok)
+}
+
+func TestHealthHandlerSuite(t *testing.T) {
+	suite.Run(t, new(healthHandlerSuite))
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/idempotency"
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds the keys sent by the clients, e.g. a uuid
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes bounds the body read to fingerprint the request, the API only takes small JSON bodies
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+var (
+	httpRequestsReplayed = metrics.NewCounterVec("http_requests_idempotent_replayed_total",
+		"Number of HTTP requests answered with the saved response of their Idempotency-Key by route.", "route")
+)
+
+// Idempotency saves the response of a mutating request sent with an Idempotency-Key, and replays it
+// when the request is retried with the same key. A key is kept until the campaign of the request ends,
+// and at least TTL.
+type Idempotency struct {
+	store idempotency.Store
+	ttl   time.Duration
+}
+
+func NewIdempotency(store idempotency.Store, ttl time.Duration) *Idempotency {
+	return &Idempotency{
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// idempotencyWriter keeps a copy of the response body to save it
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Handler is the middleware of the mutating routes, it must run after the user is authenticated.
+// expiresAt returns when the key of the request may expire, the zero time if it isn't bound to
+// a campaign. The requests without a key and a nil Idempotency aren't changed.
+func (i *Idempotency) Handler(expiresAt func(c *gin.Context) time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if i == nil || key == "" {
+			c.Next()
+			return
+		}
+
+		reqCTX := requestContext(c)
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid idempotency key",
+			})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "request body too large",
+			})
+			return
+		} else if err != nil {
+			reqCTX.Error(err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// key 只在同一個用戶或管理者之間有效
+		principal := c.GetString(actorKey)
+		if userID := c.GetString(userIDKey); userID != "" {
+			principal = "user:" + userID
+		}
+		storeKey := principal + ":" + key
+
+		now := time.Now()
+		record := idempotency.Record{
+			Fingerprint: idempotency.Fingerprint(c.Request.Method, c.Request.URL.RequestURI(), body),
+			ExpiresAt:   now.Add(i.ttl),
+		}
+		if t := expiresAt(c); t.After(record.ExpiresAt) {
+			record.ExpiresAt = t
+		}
+
+		saved, ok, err := i.store.Begin(reqCTX, storeKey, record)
+		if err != nil {
+			// store 無法使用時照常處理請求，和沒有帶 key 一樣
+			reqCTX.Errorw("begin idempotency key failed", ctx.Err(err))
+			c.Next()
+			return
+		}
+		if !ok {
+			switch {
+			case saved.Fingerprint != record.Fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "idempotency key reused with a different request",
+				})
+			case !saved.Done():
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "request with the same idempotency key in progress",
+				})
+			default:
+				httpRequestsReplayed.WithLabelValues(c.FullPath()).Inc()
+				reqCTX.Infow("idempotent request replayed", "status", saved.Status)
+				c.Header(idempotentReplayedHeader, "true")
+				if saved.ContentType != "" {
+					c.Header("Content-Type", saved.ContentType)
+				}
+				c.Status(saved.Status)
+				c.Writer.Write(saved.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		// 客戶端逾時斷線會取消 request context，保存或釋放 key 不能跟著失敗，
+		// 否則 key 一直停在處理中，重試只會拿到 409
+		storeCTX := reqCTX.WithContext(context.WithoutCancel(reqCTX))
+
+		// 請求 panic 或失敗時釋放 key，讓用戶可以重試
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := i.store.Release(storeCTX, storeKey); err != nil {
+				reqCTX.Errorw("release idempotency key failed", ctx.Err(err))
+			}
+		}()
+
+		w := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		status := w.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		record.Status = status
+		record.ContentType = w.Header().Get("Content-Type")
+		record.Body = w.body.Bytes()
+		if err := i.store.Complete(storeCTX, storeKey, record); err != nil {
+			reqCTX.Errorw("complete idempotency key failed", ctx.Err(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// campaignEndCacheTTL bounds how long the end of a campaign is cached,
+// the windows of a campaign can only be updated before it opens.
+const campaignEndCacheTTL = time.Minute
+
+type cachedCampaignEnd struct {
+	endAt     time.Time
+	expiresAt time.Time
+}
+
+// campaignEnd returns the end of the campaign in the id param, so the keys of its requests
+// are kept until it ends. It's the zero time if the campaign isn't found. The ends are cached
+// by campaign id, so a keyed request doesn't read the campaign once more.
+func campaignEnd(campaignService service.CampaignService) func(c *gin.Context) time.Time {
+	var (
+		mu    sync.Mutex
+		cache = map[uint]cachedCampaignEnd{}
+	)
+	return func(c *gin.Context) time.Time {
+		campaignID, err := strconv.Atoi(c.Param("id"))
+		if err != nil || campaignID < 0 {
+			return time.Time{}
+		}
+		id := uint(campaignID)
+		now := time.Now()
+		mu.Lock()
+		cached, ok := cache[id]
+		mu.Unlock()
+		if ok && now.Before(cached.expiresAt) {
+			return cached.endAt
+		}
+
+		campaign, err := campaignService.Get(requestContext(c), service.GetCampaignInput{ID: id})
+		if err != nil {
+			return time.Time{}
+		}
+		endAt := time.Unix(campaign.EndAt, 0)
+		mu.Lock()
+		// 順便刪掉過期的，cache 只會有最近的幾個 campaign
+		for k, v := range cache {
+			if !now.Before(v.expiresAt) {
+				delete(cache, k)
+			}
+		}
+		cache[id] = cachedCampaignEnd{endAt: endAt, expiresAt: now.Add(campaignEndCacheTTL)}
+		mu.Unlock()
+		return endAt
+	}
+}
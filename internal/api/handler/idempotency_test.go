@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/internal/service/mocks"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/idempotency"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+// recordingStore keeps the last record begun
+type recordingStore struct {
+	*idempotency.MemoryStore
+	last idempotency.Record
+}
+
+func (s *recordingStore) Begin(c ctx.CTX, key string, r idempotency.Record) (idempotency.Record, bool, error) {
+	s.last = r
+	return s.MemoryStore.Begin(c, key, r)
+}
+
+// Complete and Release fail on a cancelled context like the database store
+func (s *recordingStore) Complete(c ctx.CTX, key string, r idempotency.Record) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Complete(c, key, r)
+}
+
+func (s *recordingStore) Release(c ctx.CTX, key string) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Release(c, key)
+}
+
+type idempotencySuite struct {
+	suite.Suite
+	mockService *mocks.CampaignService
+	store       *recordingStore
+	router      *gin.Engine
+}
+
+func (s *idempotencySuite) SetupTest() {
+	s.mockService = mocks.NewCampaignService(s.T())
+	s.store = &recordingStore{MemoryStore: idempotency.NewMemoryStore()}
+
+	gin.SetMode(gin.TestMode)
+	s.router = gin.New()
+	s.router.Use(RequestContext())
+	cfg := DefaultConfig()
+	cfg.Idempotency = NewIdempotency(s.store, time.Minute)
+	RegisterHTTPHandler(s.router, s.mockService, cfg)
+	RegisterAdminHTTPHandler(s.router, s.mockService, map[string]AdminUser{
+		adminToken: {Name: "alice", Role: RoleAdmin},
+	}, cfg)
+
+	s.mockService.On("Get", mockCTX, service.GetCampaignInput{ID: 1}).Return(&service.Campaign{ID: 1}, nil).Maybe()
+}
+
+func (s *idempotencySuite) request(method, path, userID, key, body string) *httptest.ResponseRecorder {
+	getUserID = func() (string, error) {
+		return userID, nil
+	}
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	if strings.HasPrefix(path, "/admin") {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *idempotencySuite) TestReplay() {
+	input := service.ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}
+	s.mockService.On("ClaimCouponReservation", mockCTX, input).Return(&service.CouponClaim{
+		Reservation: service.CouponReservation{CouponCode: "coupon_code"},
+	}, nil).Once()
+	replayed := httpRequestsReplayed.WithLabelValues("/campaigns/:id/reservations/claim").Value()
+
+	first := s.request(http.MethodPost, "/campaigns/1/reservations/claim", "user_id_1", "key", "")
+	s.Equal(http.StatusOK, first.Code)
+	s.Empty(first.Header().Get(idempotentReplayedHeader))
+
+	// 重試時不會再呼叫 service，回傳同樣的結果
+	second := s.request(http.MethodPost, "/campaigns/1/reservations/claim", "user_id_1", "key", "")
+	s.Equal(http.StatusOK, second.Code)
+	s.Equal("true", second.Header().Get(idempotentReplayedHeader))
+	s.Equal(first.Header().Get("Content-Type"), second.Header().Get("Content-Type"))
+	s.JSONEq(first.Body.String(), second.Body.String())
+	s.Equal(replayed+1, httpRequestsReplayed.WithLabelValues("/campaigns/:id/reservations/claim").Value())
+
+	// 同一個 key 只在同一個用戶之間有效
+	s.mockService.On("ClaimCouponReservation", mockCTX, service.ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_2"}).Return(&service.CouponClaim{}, nil).Once()
+	w := s.request(http.MethodPost, "/campaigns/1/reservations/claim", "user_id_2", "key", "")
+	s.Equal(http.StatusOK, w.Code)
+	s.Empty(w.Header().Get(idempotentReplayedHeader))
+}
+
+func (s *idempotencySuite) TestReplayWithoutBody() {
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).Return(nil, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+		s.Equal(http.StatusNoContent, w.Code)
+		s.Empty(w.Body.String())
+	}
+}
+
+func (s *idempotencySuite) TestKeyReusedWithDifferentRequest() {
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).Return(nil, nil).Once()
+
+	w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+	s.Equal(http.StatusNoContent, w.Code)
+	w = s.request(http.MethodPost, "/campaigns/1/reservations/claim", "user_id_1", "key", "")
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+	s.JSONEq(`{"error":"idempotency key reused with a different request"}`, w.Body.String())
+
+	// admin 的請求也比對 body
+	s.mockService.On("Cancel", mockCTX, service.CancelCampaignInput{ID: 1}).Return(&service.Campaign{ID: 1}, nil).Once()
+	w = s.request(http.MethodPost, "/admin/campaigns/1/cancel", "", "key", `{}`)
+	s.Equal(http.StatusOK, w.Code)
+	w = s.request(http.MethodPost, "/admin/campaigns/1/cancel", "", "key", `{"reason":"test"}`)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+}
+
+func (s *idempotencySuite) TestRequestInProgress() {
+	s.store.MemoryStore.Begin(ctx.Background(), "user:user_id_1:key", idempotency.Record{
+		Fingerprint: idempotency.Fingerprint(http.MethodPost, "/campaigns/1/reservations", nil),
+		ExpiresAt:   time.Now().Add(time.Minute),
+	})
+
+	w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+	s.Equal(http.StatusConflict, w.Code)
+	s.Equal("1", w.Header().Get("Retry-After"))
+}
+
+func (s *idempotencySuite) TestFailedRequestReleasesKey() {
+	input := service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}
+	s.mockService.On("CreateCouponReservation", mockCTX, input).Return(nil, errors.New("error")).Once()
+	s.mockService.On("CreateCouponReservation", mockCTX, input).Return(nil, nil).Once()
+
+	w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+	s.Equal(http.StatusInternalServerError, w.Code)
+	w = s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+	s.Equal(http.StatusNoContent, w.Code)
+}
+
+func (s *idempotencySuite) TestReplayAfterClientDisconnected() {
+	reqCTX, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	input := service.ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}
+	// 客戶端在 service 處理完之前逾時斷線
+	s.mockService.On("ClaimCouponReservation", mockCTX, input).Run(func(mock.Arguments) {
+		cancel()
+	}).Return(&service.CouponClaim{
+		Reservation: service.CouponReservation{CouponCode: "coupon_code"},
+	}, nil).Once()
+	getUserID = func() (string, error) {
+		return "user_id_1", nil
+	}
+	req, _ := http.NewRequestWithContext(reqCTX, http.MethodPost, "/campaigns/1/reservations/claim", http.NoBody)
+	req.Header.Set(idempotencyKeyHeader, "key")
+	first := httptest.NewRecorder()
+	s.router.ServeHTTP(first, req)
+
+	// 重試時回傳保存的結果，不是 409
+	second := s.request(http.MethodPost, "/campaigns/1/reservations/claim", "user_id_1", "key", "")
+	s.Equal(http.StatusOK, second.Code)
+	s.Equal("true", second.Header().Get(idempotentReplayedHeader))
+	s.JSONEq(first.Body.String(), second.Body.String())
+}
+
+func (s *idempotencySuite) TestFailedRequestReleasesKeyAfterClientDisconnected() {
+	reqCTX, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	input := service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}
+	s.mockService.On("CreateCouponReservation", mockCTX, input).Run(func(mock.Arguments) {
+		cancel()
+	}).Return(nil, errors.New("error")).Once()
+	s.mockService.On("CreateCouponReservation", mockCTX, input).Return(nil, nil).Once()
+	getUserID = func() (string, error) {
+		return "user_id_1", nil
+	}
+	req, _ := http.NewRequestWithContext(reqCTX, http.MethodPost, "/campaigns/1/reservations", http.NoBody)
+	req.Header.Set(idempotencyKeyHeader, "key")
+	s.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "key", "")
+	s.Equal(http.StatusNoContent, w.Code)
+}
+
+func (s *idempotencySuite) TestExpiresAfterCampaignEnds() {
+	endAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	s.mockService.On("Get", mockCTX, service.GetCampaignInput{ID: 2}).Return(&service.Campaign{ID: 2, EndAt: endAt.Unix()}, nil).Once()
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 2, UserID: "user_id_1"}).Return(nil, nil).Once()
+
+	s.request(http.MethodPost, "/campaigns/2/reservations", "user_id_1", "key", "")
+	s.Equal(endAt, s.store.last.ExpiresAt)
+
+	// campaign 的結束時間被 cache，不會再讀一次 campaign
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 2, UserID: "user_id_2"}).Return(nil, nil).Once()
+	s.request(http.MethodPost, "/campaigns/2/reservations", "user_id_2", "key", "")
+	s.Equal(endAt, s.store.last.ExpiresAt)
+
+	// campaign 已經結束時至少保留 TTL
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).Return(nil, nil).Once()
+	s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", "another_key", "")
+	s.WithinDuration(time.Now().Add(time.Minute), s.store.last.ExpiresAt, time.Second)
+}
+
+func (s *idempotencySuite) TestInvalidKey() {
+	w := s.request(http.MethodPost, "/campaigns/1/reservations", "user_id_1", strings.Repeat("k", maxIdempotencyKeyLength+1), "")
+	s.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (s *idempotencySuite) TestBodyTooLarge() {
+	w := s.request(http.MethodPost, "/admin/campaigns/1/cancel", "", "key", `{"reason":"`+strings.Repeat("r", maxIdempotentBodyBytes)+`"}`)
+	s.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	s.Zero(s.store.last)
+}
+
+func TestIdempotencySuite(t *testing.T) {
+	suite.Run(t, new(idempotencySuite))
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"Number of HTTP requests by method, route and status.", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latencies by method, route and status.", nil, "method", "route", "status")
+)
+
+// RegisterMetricsHTTPHandler serves /metrics in the Prometheus text format,
+// the requests are recorded by the Metrics middleware.
+func RegisterMetricsHTTPHandler(r *gin.Engine) {
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
+
+// Metrics is a middleware counting the requests and their latencies per route and status,
+// it must be registered before Recovery so the 500 of a panic is counted.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// 用 route pattern 而不是 path，避免 campaign id 讓 label 無限增長
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
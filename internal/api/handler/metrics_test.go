@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+)
+
+type metricsHandlerSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (s *metricsHandlerSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	s.router = gin.New()
+	s.router.Use(Middlewares()...)
+	RegisterMetricsHTTPHandler(s.router)
+	s.router.GET("/campaigns/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	s.router.GET("/metrics_panic", func(c *gin.Context) {
+		panic("boom")
+	})
+}
+
+func (s *metricsHandlerSuite) request(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *metricsHandlerSuite) TestMetrics() {
+	s.request("/campaigns/1")
+	s.request("/campaigns/2")
+	s.request("/unknown")
+
+	w := s.request("/metrics")
+	s.Equal(http.StatusOK, w.Code)
+	s.True(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	// 以 route pattern 為 label，不同的 campaign id 算在同一個 route
+	body := w.Body.String()
+	s.Contains(body, `http_requests_total{method="GET",route="/campaigns/:id",status="204"} 2`+"\n")
+	s.Contains(body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`+"\n")
+	s.Contains(body, `http_request_duration_seconds_count{method="GET",route="/campaigns/:id",status="204"} 2`+"\n")
+}
+
+func (s *metricsHandlerSuite) TestMetricsPanic() {
+	w := s.request("/metrics_panic")
+	s.Equal(http.StatusInternalServerError, w.Code)
+
+	// Recovery 在 Metrics 裡面，panic 變成的 500 也會被計算
+	body := s.request("/metrics").Body.String()
+	s.Contains(body, `http_requests_total{method="GET",route="/metrics_panic",status="500"} 1`+"\n")
+	s.Contains(body, `http_request_duration_seconds_count{method="GET",route="/metrics_panic",status="500"} 1`+"\n")
+}
+
+func TestMetricsHandlerSuite(t *testing.T) {
+	suite.Run(t, new(metricsHandlerSuite))
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequestsRateLimited = metrics.NewCounterVec("http_requests_rate_limited_total",
+		"Number of HTTP requests rejected by the rate limiter by route and key.", "route", "key")
+)
+
+// RateLimitRule limits the requests to Route, e.g. "POST /campaigns/:id/reservations",
+// per authenticated user and per client IP. A zero limit isn't applied, so a rule limits
+// by user, by IP or both. The rule with an empty Route applies to the routes without a rule.
+type RateLimitRule struct {
+	Route string
+	User  ratelimit.Limit
+	IP    ratelimit.Limit
+}
+
+// RateLimiter limits the requests to the public API with a token bucket per route and user or IP
+type RateLimiter struct {
+	store ratelimit.Store
+	rules map[string]RateLimitRule
+}
+
+func NewRateLimiter(store ratelimit.Store, rules ...RateLimitRule) *RateLimiter {
+	l := &RateLimiter{
+		store: store,
+		rules: map[string]RateLimitRule{},
+	}
+	for _, rule := range rules {
+		l.rules[rule.Route] = rule
+	}
+	return l
+}
+
+// Handler is the middleware rejecting the limited requests with 429 and Retry-After,
+// it must run after the user is authenticated. A nil RateLimiter doesn't limit anything.
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		rule, ok := l.rules[route]
+		if !ok {
+			rule = l.rules[""]
+		}
+
+		reqCTX := requestContext(c)
+		// 先檢查 IP，同一個 IP 大量請求時不會消耗用戶的 token
+		for _, k := range []struct {
+			name  string
+			id    string
+			limit ratelimit.Limit
+		}{
+			{"ip", c.ClientIP(), rule.IP},
+			{"user", c.GetString(userIDKey), rule.User},
+		} {
+			if k.limit.IsZero() || k.id == "" {
+				continue
+			}
+			allowed, wait, err := l.store.Take(reqCTX, k.name+":"+route+":"+k.id, k.limit)
+			if err != nil {
+				// store 無法使用時不擋請求，避免限流造成整個服務無法使用
+				reqCTX.Errorw("rate limit failed", "key", k.name, ctx.Err(err))
+				continue
+			}
+			if !allowed {
+				httpRequestsRateLimited.WithLabelValues(c.FullPath(), k.name).Inc()
+				reqCTX.Warnw("rate limited", "key", k.name, "limit", k.limit.String(), "retry_after", wait)
+				c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+					"error": "too many requests",
+				})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/internal/service/mocks"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(c ctx.CTX, key string, l ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+type rateLimitSuite struct {
+	suite.Suite
+	mockService *mocks.CampaignService
+}
+
+func (s *rateLimitSuite) SetupTest() {
+	s.mockService = mocks.NewCampaignService(s.T())
+}
+
+func (s *rateLimitSuite) newRouter(store ratelimit.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestContext())
+	cfg := DefaultConfig()
+	cfg.RateLimiter = NewRateLimiter(store,
+		RateLimitRule{Route: "POST /campaigns/:id/reservations", User: ratelimit.Limit{Count: 1, Period: time.Minute}},
+		RateLimitRule{IP: ratelimit.Limit{Count: 2, Period: time.Hour}},
+	)
+	RegisterHTTPHandler(router, s.mockService, cfg)
+	return router
+}
+
+func (s *rateLimitSuite) request(router *gin.Engine, method, path, userID, ip string, forwardedFor ...string) *httptest.ResponseRecorder {
+	getUserID = func() (string, error) {
+		return userID, nil
+	}
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":12345"
+	for _, f := range forwardedFor {
+		req.Header.Add("X-Forwarded-For", f)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *rateLimitSuite) TestLimitByUser() {
+	router := s.newRouter(ratelimit.NewMemoryStore())
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).Return(nil, nil).Once()
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_2"}).Return(nil, nil).Once()
+	limited := httpRequestsRateLimited.WithLabelValues("/campaigns/:id/reservations", "user").Value()
+
+	w := s.request(router, http.MethodPost, "/campaigns/1/reservations", "user_id_1", "10.0.0.1")
+	s.Equal(http.StatusNoContent, w.Code)
+
+	// 同一個用戶換 IP 也會被限制
+	w = s.request(router, http.MethodPost, "/campaigns/1/reservations", "user_id_1", "10.0.0.2")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("60", w.Header().Get("Retry-After"))
+	s.JSONEq(`{"error":"too many requests"}`, w.Body.String())
+	s.Equal(limited+1, httpRequestsRateLimited.WithLabelValues("/campaigns/:id/reservations", "user").Value())
+
+	w = s.request(router, http.MethodPost, "/campaigns/1/reservations", "user_id_2", "10.0.0.1")
+	s.Equal(http.StatusNoContent, w.Code)
+}
+
+func (s *rateLimitSuite) TestLimitByIP() {
+	router := s.newRouter(ratelimit.NewMemoryStore())
+	s.mockService.On("GetProof", mockCTX, service.GetCampaignProofInput{CampaignID: 1}).Return(&service.CampaignProof{CampaignID: 1}, nil).Times(3)
+
+	// 沒有規則的 route 使用預設規則，不同用戶共用同一個 IP 的限制
+	for _, userID := range []string{"user_id_1", "user_id_2"} {
+		w := s.request(router, http.MethodGet, "/campaigns/1/proof", userID, "10.0.0.1")
+		s.Equal(http.StatusOK, w.Code)
+	}
+	w := s.request(router, http.MethodGet, "/campaigns/1/proof", "user_id_3", "10.0.0.1")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("1800", w.Header().Get("Retry-After"))
+
+	w = s.request(router, http.MethodGet, "/campaigns/1/proof", "user_id_3", "10.0.0.2")
+	s.Equal(http.StatusOK, w.Code)
+}
+
+func (s *rateLimitSuite) TestForwardedForFromUntrustedProxy() {
+	router := s.newRouter(ratelimit.NewMemoryStore())
+	s.mockService.On("GetLatest", mockCTX, service.GetLatestCampaignInput{}).Return(&service.Campaign{ID: 1}, nil)
+
+	// 沒有信任的 proxy 時，偽造的 X-Forwarded-For 不會拿到新的 bucket
+	s.NoError(router.SetTrustedProxies(nil))
+	for i, forwardedFor := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		w := s.request(router, http.MethodGet, "/campaigns/latest", "user_id_1", "10.0.0.1", forwardedFor)
+		s.Equal(i < 2, w.Code == http.StatusOK, forwardedFor)
+	}
+
+	// 信任的 proxy 轉送的請求以 X-Forwarded-For 區分 client
+	s.NoError(router.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	w := s.request(router, http.MethodGet, "/campaigns/latest", "user_id_1", "10.0.0.1", "4.4.4.4")
+	s.Equal(http.StatusOK, w.Code)
+}
+
+func (s *rateLimitSuite) TestStoreErrorAllowsRequest() {
+	router := s.newRouter(failingStore{})
+	s.mockService.On("CreateCouponReservation", mockCTX, service.CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}).Return(nil, nil).Twice()
+
+	for i := 0; i < 2; i++ {
+		w := s.request(router, http.MethodPost, "/campaigns/1/reservations", "user_id_1", "10.0.0.1")
+		s.Equal(http.StatusNoContent, w.Code)
+	}
+}
+
+func TestRateLimitSuite(t *testing.T) {
+	suite.Run(t, new(rateLimitSuite))
+}
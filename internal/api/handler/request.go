@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds a forwarded request id, longer ones are replaced
+	maxRequestIDLength = 128
+
+	requestCTXKey = "request_ctx"
+	// actorKey is who sent the request, logged by AccessLog
+	actorKey = "actor"
+	// userIDKey is the user authenticated by the public API
+	userIDKey = "user_id"
+)
+
+// RequestContext is a middleware building the ctx.CTX of the request from c.Request.Context(),
+// so client disconnects and deadlines reach the database. The request id is forwarded from
+// X-Request-ID or generated, and echoed in the response. The request is the root span of its trace.
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		reqCTX, span := newRequestContext(c).StartSpan(c.Request.Method+" "+route,
+			"http.method", c.Request.Method, "http.route", route)
+		requestID := reqCTX.RequestID()
+		span.SetAttributes("request_id", requestID)
+
+		c.Header(requestIDHeader, requestID)
+		c.Set(requestCTXKey, reqCTX)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(status))
+		}
+		span.End()
+	}
+}
+
+// requestContext returns the ctx.CTX set by RequestContext, or builds one if the middleware isn't used
+func requestContext(c *gin.Context) ctx.CTX {
+	if v, ok := c.Get(requestCTXKey); ok {
+		return v.(ctx.CTX)
+	}
+	return newRequestContext(c)
+}
+
+// userContext returns the request context acting as the user
+func userContext(c *gin.Context, userID string) ctx.CTX {
+	c.Set(actorKey, "user:"+userID)
+	return requestContext(c).With("user_id", userID).WithActor("user:" + userID)
+}
+
+func newRequestContext(c *gin.Context) ctx.CTX {
+	requestID := c.GetHeader(requestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = uuid.NewString()
+	}
+	return ctx.Background().WithContext(c.Request.Context()).WithRequestID(requestID)
+}
+
+// validRequestID only accepts short ids of [A-Za-z0-9._:-], so a client can't inject into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
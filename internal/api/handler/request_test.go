@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type requestContextSuite struct {
+	suite.Suite
+	router *gin.Engine
+	ctx    ctx.CTX
+}
+
+func (s *requestContextSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	s.router = gin.New()
+	s.router.Use(RequestContext())
+	s.router.GET("/", func(c *gin.Context) {
+		s.ctx = requestContext(c)
+		c.Status(http.StatusNoContent)
+	})
+}
+
+func (s *requestContextSuite) request(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *requestContextSuite) TestForwardedRequestID() {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "upstream-id_1")
+
+	w := s.request(req)
+	s.Equal("upstream-id_1", w.Header().Get(requestIDHeader))
+	s.Equal("upstream-id_1", s.ctx.RequestID())
+}
+
+func (s *requestContextSuite) TestGeneratedRequestID() {
+	for _, id := range []string{"", "bad id\nlevel=error", strings.Repeat("a", maxRequestIDLength+1)} {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, id)
+
+		w := s.request(req)
+		s.NotEmpty(s.ctx.RequestID())
+		s.NotEqual(id, s.ctx.RequestID())
+		s.Equal(s.ctx.RequestID(), w.Header().Get(requestIDHeader))
+	}
+}
+
+func (s *requestContextSuite) TestCancellation() {
+	parent, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(parent, http.MethodGet, "/", nil)
+
+	s.request(req)
+	s.NoError(s.ctx.Err())
+
+	// 客戶端斷線時 request context 被取消，handler 拿到的 ctx 也會被取消
+	cancel()
+	s.ErrorIs(s.ctx.Err(), context.Canceled)
+}
+
+func (s *requestContextSuite) TestSpan() {
+	exporter := tracetest.NewInMemoryExporter()
+	defer ctx.SetSpanExporter(exporter)()
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "request_id")
+	s.request(req)
+
+	spans := exporter.GetSpans()
+	s.Len(spans, 1)
+	s.Equal("GET /", spans[0].Name)
+	s.False(spans[0].Parent.IsValid())
+	s.Equal(spans[0].SpanContext.TraceID().String(), s.ctx.TraceID())
+	s.Contains(spans[0].Attributes, attribute.String("request_id", "request_id"))
+	s.Contains(spans[0].Attributes, attribute.Int("http.status_code", http.StatusNoContent))
+}
+
+func TestRequestContextSuite(t *testing.T) {
+	suite.Run(t, new(requestContextSuite))
+}
@@ -0,0 +1,32 @@
+// Package app converts the loaded config into the configs of the layers, shared by the app and couponctl.
+package app
+
+import (
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/config"
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+)
+
+// ServiceConfig converts the campaign config to the config of the campaign service
+func ServiceConfig(c config.Campaign) service.Config {
+	return service.Config{
+		WinRatio:             c.WinRatio,
+		ReservationStart:     time.Duration(c.ReservationStart),
+		ReservationDuration:  time.Duration(c.ReservationDuration),
+		GrabStart:            time.Duration(c.GrabStart),
+		GrabDuration:         time.Duration(c.GrabDuration),
+		ReallocationDuration: time.Duration(c.ReallocationDuration),
+		FollowUpGrabDuration: time.Duration(c.FollowUpGrabDuration),
+		DrawMode:             c.DrawMode,
+	}
+}
+
+// DBLoggerConfig converts the database config to the config of the gorm logger
+func DBLoggerConfig(c config.Database) repository.LoggerConfig {
+	return repository.LoggerConfig{
+		LogLevel:      c.GormLogLevel(),
+		SlowThreshold: time.Duration(c.SlowQueryThreshold),
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/config"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/stretchr/testify/suite"
+)
+
+type configSuite struct {
+	suite.Suite
+}
+
+func (s *configSuite) TestServiceConfig() {
+	// 預設的設定轉換後和 service 的預設值一樣
+	s.Equal(service.DefaultConfig(), ServiceConfig(config.Default().Campaign))
+}
+
+func (s *configSuite) TestDBLoggerConfig() {
+	c := config.Default().Database
+	c.SlowQueryThreshold = config.Duration(time.Second)
+	res := DBLoggerConfig(c)
+	s.Equal(time.Second, res.SlowThreshold)
+	s.Equal(c.GormLogLevel(), res.LogLevel)
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(configSuite))
+}
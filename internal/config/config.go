@@ -0,0 +1,477 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Config is loaded from a YAML or TOML file, then overridden by the environment variables
+// named by the env tags.
+type Config struct {
+	HTTP        HTTP        `yaml:"http" toml:"http"`
+	Database    Database    `yaml:"database" toml:"database"`
+	Scheduler   Scheduler   `yaml:"scheduler" toml:"scheduler"`
+	Campaign    Campaign    `yaml:"campaign" toml:"campaign"`
+	Admin       Admin       `yaml:"admin" toml:"admin"`
+	Log         Log         `yaml:"log" toml:"log"`
+	Trace       Trace       `yaml:"trace" toml:"trace"`
+	RateLimit   RateLimit   `yaml:"rate_limit" toml:"rate_limit"`
+	Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+}
+
+type HTTP struct {
+	Addr             string   `yaml:"addr" toml:"addr" env:"HTTP_ADDR"`
+	ShutdownTimeout  Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	DefaultPageLimit int      `yaml:"default_page_limit" toml:"default_page_limit" env:"HTTP_DEFAULT_PAGE_LIMIT"`
+	MaxPageLimit     int      `yaml:"max_page_limit" toml:"max_page_limit" env:"HTTP_MAX_PAGE_LIMIT"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For is used as the client IP,
+	// none by default so a forged header can't get another rate limit bucket.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
+}
+
+type Database struct {
+	DSN         string `yaml:"dsn" toml:"dsn" env:"DB_DSN"`
+	AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+	// LogLevel is silent, error, warn or info, info logs every query at debug level
+	LogLevel           string   `yaml:"log_level" toml:"log_level" env:"DB_LOG_LEVEL"`
+	SlowQueryThreshold Duration `yaml:"slow_query_threshold" toml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+}
+
+type Scheduler struct {
+	CreateCampaignSpec string `yaml:"create_campaign_spec" toml:"create_campaign_spec" env:"CREATE_CAMPAIGN_SPEC"`
+	ReallocateSpec     string `yaml:"reallocate_spec" toml:"reallocate_spec" env:"REALLOCATE_SPEC"`
+}
+
+// Campaign configures the daily campaign, the windows are in the local timezone
+type Campaign struct {
+	// WinRatio is the probability of a user to win
+	WinRatio float64 `yaml:"win_ratio" toml:"win_ratio" env:"WIN_RATIO"`
+	// DrawMode is keyed or commit_reveal
+	DrawMode             string    `yaml:"draw_mode" toml:"draw_mode" env:"DRAW_MODE"`
+	ReservationStart     TimeOfDay `yaml:"reservation_start" toml:"reservation_start" env:"RESERVATION_START"`
+	ReservationDuration  Duration  `yaml:"reservation_duration" toml:"reservation_duration" env:"RESERVATION_DURATION"`
+	GrabStart            TimeOfDay `yaml:"grab_start" toml:"grab_start" env:"GRAB_START"`
+	GrabDuration         Duration  `yaml:"grab_duration" toml:"grab_duration" env:"GRAB_DURATION"`
+	ReallocateUnclaimed  bool      `yaml:"reallocate_unclaimed" toml:"reallocate_unclaimed" env:"REALLOCATE_UNCLAIMED"`
+	ReallocationDuration Duration  `yaml:"reallocation_duration" toml:"reallocation_duration" env:"REALLOCATION_DURATION"`
+	FollowUpGrabDuration Duration  `yaml:"follow_up_grab_duration" toml:"follow_up_grab_duration" env:"FOLLOW_UP_GRAB_DURATION"`
+}
+
+// The draw modes of the new campaigns, they match the draw modes of the campaign service
+const (
+	DrawModeKeyed        = "keyed"
+	DrawModeCommitReveal = "commit_reveal"
+)
+
+type Admin struct {
+	// Tokens are "name:role:token" entries separated by commas
+	Tokens string `yaml:"tokens" toml:"tokens" env:"ADMIN_TOKENS"`
+}
+
+// Log configures the process-wide logger, the file is rotated by size with lumberjack
+type Log struct {
+	Level              string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Encoding           string `yaml:"encoding" toml:"encoding" env:"LOG_ENCODING"`
+	SamplingInitial    int    `yaml:"sampling_initial" toml:"sampling_initial" env:"LOG_SAMPLING_INITIAL"`
+	SamplingThereafter int    `yaml:"sampling_thereafter" toml:"sampling_thereafter" env:"LOG_SAMPLING_THEREAFTER"`
+	File               string `yaml:"file" toml:"file" env:"LOG_FILE"`
+	MaxSizeMB          int    `yaml:"max_size_mb" toml:"max_size_mb" env:"LOG_MAX_SIZE_MB"`
+	MaxBackups         int    `yaml:"max_backups" toml:"max_backups" env:"LOG_MAX_BACKUPS"`
+	MaxAgeDays         int    `yaml:"max_age_days" toml:"max_age_days" env:"LOG_MAX_AGE_DAYS"`
+}
+
+// Trace configures where the spans are exported, they are dropped if File is empty
+type Trace struct {
+	// File is appended with the spans by the OpenTelemetry stdout exporter, one JSON object per span
+	File        string `yaml:"file" toml:"file" env:"TRACE_FILE"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"TRACE_SERVICE_NAME"`
+}
+
+// RateLimit limits the public API per route, by user and by client IP
+type RateLimit struct {
+	// Store is memory, limiting each replica on its own, or database, shared by the replicas
+	Store           string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`
+	ReservationUser Rate   `yaml:"reservation_user" toml:"reservation_user" env:"RATE_LIMIT_RESERVATION_USER"`
+	ReservationIP   Rate   `yaml:"reservation_ip" toml:"reservation_ip" env:"RATE_LIMIT_RESERVATION_IP"`
+	ClaimUser       Rate   `yaml:"claim_user" toml:"claim_user" env:"RATE_LIMIT_CLAIM_USER"`
+	ClaimIP         Rate   `yaml:"claim_ip" toml:"claim_ip" env:"RATE_LIMIT_CLAIM_IP"`
+	// DefaultUser and DefaultIP limit each of the other routes
+	DefaultUser Rate `yaml:"default_user" toml:"default_user" env:"RATE_LIMIT_DEFAULT_USER"`
+	DefaultIP   Rate `yaml:"default_ip" toml:"default_ip" env:"RATE_LIMIT_DEFAULT_IP"`
+}
+
+// Idempotency keeps the responses of the mutating requests sent with an Idempotency-Key
+type Idempotency struct {
+	// Store is memory, kept by each replica, or database, shared by the replicas
+	Store string `yaml:"store" toml:"store" env:"IDEMPOTENCY_STORE"`
+	// TTL is the minimum time a key is kept, the keys of a campaign are kept until it ends
+	TTL Duration `yaml:"ttl" toml:"ttl" env:"IDEMPOTENCY_TTL"`
+}
+
+// Rate is a rate limit written as "5/1m", allowing bursts of 5 requests refilled over a minute.
+// An empty rate disables the limit.
+type Rate ratelimit.Limit
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	l, err := ratelimit.ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*r = Rate(l)
+	return nil
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(ratelimit.Limit(r).String()), nil
+}
+
+// Duration is a time.Duration written as "30s" or "1m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// TimeOfDay is the duration since midnight written as "22:55"
+type TimeOfDay time.Duration
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	v, err := time.Parse("15:04", string(text))
+	if err != nil {
+		return err
+	}
+	*t = TimeOfDay(time.Duration(v.Hour())*time.Hour + time.Duration(v.Minute())*time.Minute)
+	return nil
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	d := time.Duration(t)
+	return []byte(fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)), nil
+}
+
+var gormLogLevels = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+// GormLogLevel is the level of the database logger
+func (c Database) GormLogLevel() gormlogger.LogLevel {
+	return gormLogLevels[c.LogLevel]
+}
+
+// LoggerConfig is the part of c used to build the logger
+func (c Log) LoggerConfig() ctx.LogConfig {
+	return ctx.LogConfig{
+		Level:              c.Level,
+		Encoding:           c.Encoding,
+		SamplingInitial:    c.SamplingInitial,
+		SamplingThereafter: c.SamplingThereafter,
+		File:               c.File,
+		MaxSizeMB:          c.MaxSizeMB,
+		MaxBackups:         c.MaxBackups,
+		MaxAgeDays:         c.MaxAgeDays,
+	}
+}
+
+// Slot identifies the daily campaign by its grab start time, e.g. 2300
+func (c Campaign) Slot() string {
+	return time.Time{}.Add(time.Duration(c.GrabStart)).Format("1504")
+}
+
+// Default is the configuration used when nothing is set
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Addr:             ":8080",
+			ShutdownTimeout:  Duration(30 * time.Second),
+			DefaultPageLimit: 20,
+			MaxPageLimit:     100,
+		},
+		Database: Database{
+			DSN:                ":memory:",
+			AutoMigrate:        true,
+			LogLevel:           "warn",
+			SlowQueryThreshold: Duration(200 * time.Millisecond),
+		},
+		Scheduler: Scheduler{
+			CreateCampaignSpec: "0 30 22 * * *",
+			ReallocateSpec:     "0 1 23 * * *",
+		},
+		Campaign: Campaign{
+			WinRatio:             0.2,
+			DrawMode:             DrawModeKeyed,
+			ReservationStart:     TimeOfDay(22*time.Hour + 55*time.Minute),
+			ReservationDuration:  Duration(4 * time.Minute),
+			GrabStart:            TimeOfDay(23 * time.Hour),
+			GrabDuration:         Duration(time.Minute),
+			ReallocateUnclaimed:  true,
+			ReallocationDuration: Duration(time.Minute),
+			FollowUpGrabDuration: Duration(time.Minute),
+		},
+		Log: Log{
+			Level:              "info",
+			Encoding:           "json",
+			SamplingInitial:    100,
+			SamplingThereafter: 100,
+			MaxSizeMB:          100,
+		},
+		Trace: Trace{
+			ServiceName: "coupon",
+		},
+		// 同一個 IP 後面可能有很多用戶，IP 的限制比用戶寬鬆
+		RateLimit: RateLimit{
+			Store:           "memory",
+			ReservationUser: Rate{Count: 5, Period: time.Minute},
+			ReservationIP:   Rate{Count: 100, Period: time.Minute},
+			ClaimUser:       Rate{Count: 10, Period: time.Minute},
+			ClaimIP:         Rate{Count: 200, Period: time.Minute},
+			DefaultUser:     Rate{Count: 60, Period: time.Minute},
+			DefaultIP:       Rate{Count: 600, Period: time.Minute},
+		},
+		// 重試可能被送到另一個 replica，預設共用資料庫
+		Idempotency: Idempotency{
+			Store: "database",
+			TTL:   Duration(10 * time.Minute),
+		},
+	}
+}
+
+// Load reads the defaults, the file at path if path is not empty, then the environment variables,
+// and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(b, &cfg)
+		case ".toml":
+			err = toml.Unmarshal(b, &cfg)
+		default:
+			err = fmt.Errorf("unsupported config file %q, use .yaml, .yml or .toml", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load config %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate returns all the invalid values joined in one error
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid config: "+format, args...))
+	}
+
+	if c.HTTP.Addr == "" {
+		invalid("http.addr is empty")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		invalid("http.shutdown_timeout must be positive")
+	}
+	if c.HTTP.DefaultPageLimit <= 0 || c.HTTP.DefaultPageLimit > c.HTTP.MaxPageLimit {
+		invalid("http.default_page_limit must be between 1 and http.max_page_limit")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			invalid("http.trusted_proxies: %q is not an IP or CIDR", proxy)
+		}
+	}
+	if c.Database.DSN == "" {
+		invalid("database.dsn is empty")
+	}
+	if _, ok := gormLogLevels[c.Database.LogLevel]; !ok {
+		invalid("database.log_level must be silent, error, warn or info")
+	}
+	if c.Database.SlowQueryThreshold < 0 {
+		invalid("database.slow_query_threshold must not be negative")
+	}
+
+	campaign := c.Campaign
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	createCampaign, err := parser.Parse(c.Scheduler.CreateCampaignSpec)
+	if err != nil {
+		invalid("scheduler.create_campaign_spec: %v", err)
+	} else if run, day := firstRun(createCampaign, 0); run >= time.Duration(campaign.ReservationStart) {
+		// 每天的 campaign 要在開始預約前建立
+		invalid("scheduler.create_campaign_spec must run before campaign.reservation_start, it first runs at %s",
+			day.Add(run).Format(time.DateTime))
+	}
+	reallocate, err := parser.Parse(c.Scheduler.ReallocateSpec)
+	if err != nil {
+		invalid("scheduler.reallocate_spec: %v", err)
+	} else if campaign.ReallocateUnclaimed {
+		// 搶購時間開始後第一次執行要落在搶購結束到補搶開始之間
+		grabEnd := time.Duration(campaign.GrabStart) + time.Duration(campaign.GrabDuration)
+		reallocationEnd := grabEnd + time.Duration(campaign.ReallocationDuration)
+		if run, day := firstRun(reallocate, time.Duration(campaign.GrabStart)); run < grabEnd || run >= reallocationEnd {
+			invalid("scheduler.reallocate_spec must run after the grab window and before the follow-up grab window, "+
+				"it runs at %s", day.Add(run).Format(time.DateTime))
+		}
+	}
+
+	if campaign.WinRatio <= 0 || campaign.WinRatio > 1 {
+		invalid("campaign.win_ratio must be in (0, 1]")
+	}
+	// hash 模式可以被預測，新的 campaign 不能再使用
+	if campaign.DrawMode != DrawModeKeyed && campaign.DrawMode != DrawModeCommitReveal {
+		invalid("campaign.draw_mode must be %s or %s", DrawModeKeyed, DrawModeCommitReveal)
+	}
+	for name, d := range map[string]Duration{
+		"campaign.reservation_duration":    campaign.ReservationDuration,
+		"campaign.grab_duration":           campaign.GrabDuration,
+		"campaign.reallocation_duration":   campaign.ReallocationDuration,
+		"campaign.follow_up_grab_duration": campaign.FollowUpGrabDuration,
+	} {
+		if d <= 0 {
+			invalid("%s must be positive", name)
+		}
+	}
+	if time.Duration(campaign.ReservationStart)+time.Duration(campaign.ReservationDuration) > time.Duration(campaign.GrabStart) {
+		invalid("campaign reservation window must end before campaign.grab_start")
+	}
+	if time.Duration(campaign.GrabStart)+time.Duration(campaign.GrabDuration)+
+		time.Duration(campaign.ReallocationDuration)+time.Duration(campaign.FollowUpGrabDuration) > 24*time.Hour {
+		invalid("campaign windows must end within the day")
+	}
+
+	log := c.Log
+	if _, err := zapcore.ParseLevel(log.Level); err != nil {
+		invalid("log.level: %v", err)
+	}
+	if log.Encoding != "json" && log.Encoding != "console" {
+		invalid("log.encoding must be json or console")
+	}
+	if log.SamplingInitial < 0 || log.SamplingThereafter < 0 || log.MaxSizeMB < 0 || log.MaxBackups < 0 || log.MaxAgeDays < 0 {
+		invalid("log sampling and rotation values must not be negative")
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "database" {
+		invalid("rate_limit.store must be memory or database")
+	}
+	if c.Idempotency.Store != "memory" && c.Idempotency.Store != "database" {
+		invalid("idempotency.store must be memory or database")
+	}
+	if c.Idempotency.TTL <= 0 {
+		invalid("idempotency.ttl must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// firstRun returns when sched first runs at or after offset into the next day it runs, as an offset
+// from the local midnight of that day. The runs on later days are past 24h.
+func firstRun(sched cron.Schedule, offset time.Duration) (time.Duration, time.Time) {
+	next := sched.Next(time.Now())
+	day := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
+	return sched.Next(day.Add(offset - time.Second)).Sub(day), day
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// applyEnv sets the fields with an env tag from the environment variables
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		// 實作 TextUnmarshaler 的 struct（例如 Rate）是一個值，不是設定的區段
+		if field.Type.Kind() == reflect.Struct && !value.Addr().Type().Implements(textUnmarshalerType) {
+			if err := applyEnv(value); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		s, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+		if err := setValue(value, s); err != nil {
+			errs = append(errs, fmt.Errorf("invalid config: %s=%q: %w", name, s, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		// 以逗號分隔，空字串表示清空
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
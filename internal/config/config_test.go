@@ -0,0 +1,226 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/api/handler"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"github.com/stretchr/testify/suite"
+)
+
+type configSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *configSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func (s *configSuite) writeFile(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func (s *configSuite) TestLoadDefault() {
+	cfg, err := Load("")
+	s.NoError(err)
+	s.Equal(Default(), *cfg)
+}
+
+func (s *configSuite) TestLoadYAML() {
+	path := s.writeFile("config.yaml", `
+http:
+  addr: ":9090"
+  shutdown_timeout: 10s
+database:
+  dsn: coupon.db
+scheduler:
+  create_campaign_spec: "0 30 21 * * *"
+  reallocate_spec: "0 1 22 * * *"
+campaign:
+  win_ratio: 0.25
+  reservation_start: "21:55"
+  grab_start: "22:00"
+`)
+
+	cfg, err := Load(path)
+	s.NoError(err)
+	s.Equal(":9090", cfg.HTTP.Addr)
+	s.Equal(Duration(10*time.Second), cfg.HTTP.ShutdownTimeout)
+	s.Equal(20, cfg.HTTP.DefaultPageLimit)
+	s.Equal("coupon.db", cfg.Database.DSN)
+	s.Equal(0.25, cfg.Campaign.WinRatio)
+	s.Equal(TimeOfDay(21*time.Hour+55*time.Minute), cfg.Campaign.ReservationStart)
+	s.Equal(TimeOfDay(22*time.Hour), cfg.Campaign.GrabStart)
+}
+
+func (s *configSuite) TestDefaultMatchesPackageDefaults() {
+	cfg := Default()
+	serviceConfig := service.DefaultConfig()
+	s.Equal(serviceConfig.WinRatio, cfg.Campaign.WinRatio)
+	s.Equal(serviceConfig.DrawMode, cfg.Campaign.DrawMode)
+	s.Equal(serviceConfig.ReservationStart, time.Duration(cfg.Campaign.ReservationStart))
+	s.Equal(serviceConfig.ReservationDuration, time.Duration(cfg.Campaign.ReservationDuration))
+	s.Equal(serviceConfig.GrabStart, time.Duration(cfg.Campaign.GrabStart))
+	s.Equal(serviceConfig.GrabDuration, time.Duration(cfg.Campaign.GrabDuration))
+	s.Equal(serviceConfig.ReallocationDuration, time.Duration(cfg.Campaign.ReallocationDuration))
+	s.Equal(serviceConfig.FollowUpGrabDuration, time.Duration(cfg.Campaign.FollowUpGrabDuration))
+	s.Equal(service.DrawModeKeyed, DrawModeKeyed)
+	s.Equal(service.DrawModeCommitReveal, DrawModeCommitReveal)
+	handlerConfig := handler.DefaultConfig()
+	s.Equal(handlerConfig.DefaultPageLimit, cfg.HTTP.DefaultPageLimit)
+	s.Equal(handlerConfig.MaxPageLimit, cfg.HTTP.MaxPageLimit)
+	s.Equal("2300", cfg.Campaign.Slot())
+	s.Equal(ctx.DefaultLogConfig(), cfg.Log.LoggerConfig())
+}
+
+func (s *configSuite) TestLoadExample() {
+	cfg, err := Load("../../config.example.yaml")
+	s.NoError(err)
+	s.Equal("coupon.db", cfg.Database.DSN)
+	s.Equal(Default().Campaign, cfg.Campaign)
+	s.Equal(Default().RateLimit, cfg.RateLimit)
+}
+
+func (s *configSuite) TestLoadTOML() {
+	path := s.writeFile("config.toml", `
+[scheduler]
+create_campaign_spec = "0 0 21 * * *"
+reallocate_spec = "30 2 23 * * *"
+
+[campaign]
+grab_duration = "2m"
+`)
+
+	cfg, err := Load(path)
+	s.NoError(err)
+	s.Equal("0 0 21 * * *", cfg.Scheduler.CreateCampaignSpec)
+	s.Equal(Duration(2*time.Minute), cfg.Campaign.GrabDuration)
+}
+
+func (s *configSuite) TestLoadWithEnv() {
+	path := s.writeFile("config.yaml", `
+database:
+  dsn: coupon.db
+`)
+	s.T().Setenv("DB_DSN", "env.db")
+	s.T().Setenv("WIN_RATIO", "0.5")
+	s.T().Setenv("REALLOCATE_UNCLAIMED", "false")
+	s.T().Setenv("GRAB_START", "23:30")
+	s.T().Setenv("LOG_LEVEL", "debug")
+	s.T().Setenv("DB_SLOW_QUERY_THRESHOLD", "1s")
+	s.T().Setenv("RATE_LIMIT_CLAIM_USER", "2/1s")
+	s.T().Setenv("RATE_LIMIT_DEFAULT_IP", "")
+	s.T().Setenv("IDEMPOTENCY_STORE", "memory")
+	s.T().Setenv("HTTP_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+
+	cfg, err := Load(path)
+	s.NoError(err)
+	s.Equal("env.db", cfg.Database.DSN)
+	s.Equal(0.5, cfg.Campaign.WinRatio)
+	s.False(cfg.Campaign.ReallocateUnclaimed)
+	s.Equal(TimeOfDay(23*time.Hour+30*time.Minute), cfg.Campaign.GrabStart)
+	s.Equal("debug", cfg.Log.Level)
+	s.Equal(Duration(time.Second), cfg.Database.SlowQueryThreshold)
+	s.Equal(Rate{Count: 2, Period: time.Second}, cfg.RateLimit.ClaimUser)
+	s.True(ratelimit.Limit(cfg.RateLimit.DefaultIP).IsZero())
+	s.Equal("memory", cfg.Idempotency.Store)
+	s.Equal([]string{"10.0.0.0/8", "192.168.1.1"}, cfg.HTTP.TrustedProxies)
+}
+
+func (s *configSuite) TestLoadWithInvalidEnv() {
+	s.T().Setenv("HTTP_MAX_PAGE_LIMIT", "many")
+
+	_, err := Load("")
+	s.ErrorContains(err, "HTTP_MAX_PAGE_LIMIT")
+}
+
+func (s *configSuite) TestLoadWithValidationError() {
+	path := s.writeFile("config.yaml", `
+http:
+  addr: ""
+  trusted_proxies: ["10.0.0.0/33"]
+scheduler:
+  reallocate_spec: "every minute"
+campaign:
+  win_ratio: 1.5
+  draw_mode: hash
+log:
+  encoding: logfmt
+database:
+  log_level: verbose
+rate_limit:
+  store: redis
+idempotency:
+  ttl: 0s
+`)
+
+	_, err := Load(path)
+	s.ErrorContains(err, "http.addr")
+	s.ErrorContains(err, "http.trusted_proxies")
+	s.ErrorContains(err, "scheduler.reallocate_spec")
+	s.ErrorContains(err, "campaign.win_ratio")
+	s.ErrorContains(err, "campaign.draw_mode")
+	s.ErrorContains(err, "log.encoding")
+	s.ErrorContains(err, "database.log_level")
+	s.ErrorContains(err, "rate_limit.store")
+	s.ErrorContains(err, "idempotency.ttl")
+}
+
+func (s *configSuite) TestLoadWithCommitRevealDraw() {
+	path := s.writeFile("config.yaml", `
+campaign:
+  win_ratio: 0.3
+  draw_mode: commit_reveal
+`)
+
+	// keyed 的 draw 不需要 1/n 的 win ratio
+	cfg, err := Load(path)
+	s.NoError(err)
+	s.Equal(DrawModeCommitReveal, cfg.Campaign.DrawMode)
+
+	s.T().Setenv("DRAW_MODE", "random")
+	_, err = Load(path)
+	s.ErrorContains(err, "campaign.draw_mode")
+}
+
+func (s *configSuite) TestLoadWithSpecOutsideWindow() {
+	// 在開始預約之後才建立 campaign
+	s.T().Setenv("CREATE_CAMPAIGN_SPEC", "0 0 23 * * *")
+	_, err := Load("")
+	s.ErrorContains(err, "scheduler.create_campaign_spec must run before campaign.reservation_start")
+
+	// 在搶購結束前重新分配
+	s.T().Setenv("CREATE_CAMPAIGN_SPEC", "0 30 22 * * *")
+	s.T().Setenv("REALLOCATE_SPEC", "0 0 23 * * *")
+	_, err = Load("")
+	s.ErrorContains(err, "scheduler.reallocate_spec must run after the grab window")
+
+	// 補搶開始後才重新分配
+	s.T().Setenv("REALLOCATE_SPEC", "0 30 23 * * *")
+	_, err = Load("")
+	s.ErrorContains(err, "scheduler.reallocate_spec must run after the grab window")
+
+	// 沒有開啟重新分配時不檢查
+	s.T().Setenv("REALLOCATE_UNCLAIMED", "false")
+	_, err = Load("")
+	s.NoError(err)
+}
+
+func (s *configSuite) TestLoadWithUnsupportedFile() {
+	path := s.writeFile("config.json", `{}`)
+
+	_, err := Load(path)
+	s.ErrorContains(err, "unsupported config file")
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(configSuite))
+}
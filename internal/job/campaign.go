@@ -0,0 +1,112 @@
+package job
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+const (
+	// 22:30 建立 campaign，重試的時間加起來不會超過 22:55 開始預約
+	maxAttempts    = 6
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+var (
+	timeNow = time.Now
+	sleep   = sleepContext
+)
+
+// CreateCampaignJobConfig configures the daily campaign, Slot is the grab start time like 2300
+type CreateCampaignJobConfig struct {
+	Slot                string
+	ReallocateUnclaimed bool
+}
+
+// CreateCampaignJob creates the daily campaign, it is safe to run more than once a day
+// since the campaign is keyed by the date and the slot.
+type CreateCampaignJob struct {
+	ctx             ctx.CTX
+	campaignService service.CampaignService
+	cfg             CreateCampaignJobConfig
+}
+
+func NewCreateCampaignJob(c ctx.CTX, campaignService service.CampaignService, cfg CreateCampaignJobConfig) CreateCampaignJob {
+	return CreateCampaignJob{
+		ctx:             c,
+		campaignService: campaignService,
+		cfg:             cfg,
+	}
+}
+
+// Run implements cron.Job with the ctx of the job
+func (j CreateCampaignJob) Run() {
+	j.RunContext(j.ctx)
+}
+
+// RunContext retries with exponential backoff until c is done and never panics
+func (j CreateCampaignJob) RunContext(c ctx.CTX) {
+	key := scheduleKey(timeNow(), j.cfg.Slot)
+	c, span := c.With("schedule_key", key).StartSpan("CreateCampaignJob.Run", "schedule_key", key)
+	defer span.End()
+	jobRuns.WithLabelValues(jobCreateCampaign).Inc()
+
+	defer func() {
+		if r := recover(); r != nil {
+			jobFailures.WithLabelValues(jobCreateCampaign).Inc()
+			c.Errorw("create campaign job panicked", "panic", r)
+		}
+	}()
+
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		campaign, err := j.campaignService.Create(c, service.CreateCampaignInput{
+			ReallocateUnclaimed: j.cfg.ReallocateUnclaimed,
+			ScheduleKey:         key,
+		})
+		if err == nil {
+			c.Infow("daily campaign created", "campaign_id", campaign.ID, "attempt", attempt)
+			return
+		}
+
+		if !retryable(err) || attempt == maxAttempts || c.Err() != nil {
+			jobFailures.WithLabelValues(jobCreateCampaign).Inc()
+			c.Errorw("create daily campaign failed", "attempt", attempt, ctx.Err(err))
+			return
+		}
+
+		jobRetries.WithLabelValues(jobCreateCampaign).Inc()
+		c.Warnw("create daily campaign failed, retrying", "attempt", attempt, "backoff", backoff.String(), ctx.Err(err))
+		if err := sleep(c, backoff); err != nil {
+			jobFailures.WithLabelValues(jobCreateCampaign).Inc()
+			c.Errorw("create daily campaign stopped", "attempt", attempt, ctx.Err(err))
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// sleepContext waits for d, it returns the error of c if c is done before, e.g. when shutting down
+func sleepContext(c ctx.CTX, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// scheduleKey is the business key of the daily campaign, e.g. daily:2024-08-26:2300
+func scheduleKey(t time.Time, slot string) string {
+	return "daily:" + t.Format(time.DateOnly) + ":" + slot
+}
+
+// 時間設定錯誤或和其他 campaign 重疊，重試也不會成功
+func retryable(err error) bool {
+	return !errors.Is(err, service.ErrInvalidWindow) && !errors.Is(err, service.ErrOverlappingWindow)
+}
@@ -0,0 +1,130 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/internal/service/mocks"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	mockCTX = mock.Anything
+)
+
+type createCampaignJobSuite struct {
+	suite.Suite
+	mockService *mocks.CampaignService
+	job         CreateCampaignJob
+	sleeps      []time.Duration
+}
+
+func (s *createCampaignJobSuite) SetupSuite() {
+	s.mockService = mocks.NewCampaignService(s.T())
+	s.job = NewCreateCampaignJob(ctx.Background(), s.mockService, CreateCampaignJobConfig{
+		Slot:                "2300",
+		ReallocateUnclaimed: true,
+	})
+}
+
+func (s *createCampaignJobSuite) SetupTest() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 22, 30, 0, 0, loc)
+	}
+	s.sleeps = nil
+	sleep = func(c ctx.CTX, d time.Duration) error {
+		s.sleeps = append(s.sleeps, d)
+		return nil
+	}
+}
+
+var createInput = service.CreateCampaignInput{
+	ReallocateUnclaimed: true,
+	ScheduleKey:         "daily:2024-08-26:2300",
+}
+
+func (s *createCampaignJobSuite) TestRun() {
+	runs := jobRuns.WithLabelValues(jobCreateCampaign).Value()
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(&service.Campaign{ID: 1}, nil).Once()
+
+	s.job.Run()
+	s.Empty(s.sleeps)
+	s.Equal(runs+1, jobRuns.WithLabelValues(jobCreateCampaign).Value())
+	s.Equal(failures, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunWithRetry() {
+	retries := jobRetries.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(nil, errors.New("database is locked")).Times(2)
+	s.mockService.On("Create", mockCTX, createInput).Return(&service.Campaign{ID: 1}, nil).Once()
+
+	s.job.Run()
+	s.Equal([]time.Duration{time.Second, 2 * time.Second}, s.sleeps)
+	s.Equal(retries+2, jobRetries.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunWithMaxAttempts() {
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(nil, errors.New("database is locked")).Times(maxAttempts)
+
+	s.job.Run()
+	s.Len(s.sleeps, maxAttempts-1)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunContextDone() {
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(nil, context.Canceled).Once()
+
+	// 失去 lease 之後不再重試
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.job.RunContext(ctx.Background().WithContext(c))
+	s.Empty(s.sleeps)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunWithOverlappingWindowError() {
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(nil, service.ErrOverlappingWindow).Once()
+
+	s.job.Run()
+	s.Empty(s.sleeps)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunWithPanic() {
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Run(func(args mock.Arguments) {
+		panic("unexpected")
+	}).Return(nil, nil).Once()
+
+	s.NotPanics(s.job.Run)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func (s *createCampaignJobSuite) TestRunStoppedWhileRetrying() {
+	failures := jobFailures.WithLabelValues(jobCreateCampaign).Value()
+	s.mockService.On("Create", mockCTX, createInput).Return(nil, errors.New("database is locked")).Once()
+	sleep = sleepContext
+
+	// 關閉時不等重試的 backoff
+	c, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	s.job.RunContext(ctx.Background().WithContext(c))
+	s.Less(time.Since(start), initialBackoff)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobCreateCampaign).Value())
+}
+
+func TestCreateCampaignJobSuite(t *testing.T) {
+	suite.Run(t, new(createCampaignJobSuite))
+}
@@ -0,0 +1,154 @@
+package job
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// SchedulerLease is the lease held by the replica running the scheduled jobs
+	SchedulerLease = "scheduler"
+
+	// 續約間隔要比 lease 的有效時間短，續約失敗幾次之後其他 replica 才會接手
+	leaseTTL           = 15 * time.Second
+	leaseRenewInterval = 5 * time.Second
+	// leaderCheckInterval is how often a running job checks this replica is still the leader
+	leaderCheckInterval = time.Second
+)
+
+// Job is a cron job stopping when its ctx is done
+type Job interface {
+	RunContext(c ctx.CTX)
+}
+
+// Leader keeps a lease in the database, only the replica holding the lease is the leader
+type Leader struct {
+	repo   repository.LeaseRepository
+	name   string
+	holder string
+	// unix timestamp the lease held by this replica expires at, 0 if not held
+	expiresAt atomic.Int64
+}
+
+func NewLeader(c ctx.CTX, repo repository.LeaseRepository, name, holder string) *Leader {
+	return &Leader{
+		repo:   repo,
+		name:   name,
+		holder: holder,
+	}
+}
+
+// Run acquires and renews the lease every leaseRenewInterval until c is done,
+// then releases the lease so another replica can take over immediately.
+func (l *Leader) Run(c ctx.CTX) {
+	c = c.With("lease", l.name, "holder", l.holder)
+
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		l.renew(c)
+
+		select {
+		case <-c.Done():
+			l.expiresAt.Store(0)
+			if err := l.repo.ReleaseLease(ctx.Background(), repository.ReleaseLeaseInput{
+				Name:   l.name,
+				Holder: l.holder,
+			}); err != nil {
+				c.Errorw("release lease failed", ctx.Err(err))
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsLeader reports whether this replica holds an unexpired lease
+func (l *Leader) IsLeader() bool {
+	return timeNow().Unix() < l.expiresAt.Load()
+}
+
+// Wrap returns a job which runs j with c only if this replica is the leader,
+// the ctx of j is done as soon as this replica loses the lease so another leader doesn't run the job at the same time.
+// A replica which isn't the leader when the job fires waits up to leaseTTL for the lease, so the job isn't skipped
+// by every replica while the lease is being taken over. The jobs must be idempotent, the new leader may run a job
+// the previous leader just ran.
+func (l *Leader) Wrap(c ctx.CTX, j Job) cron.Job {
+	return cron.FuncJob(func() {
+		if !l.waitLeader(c) {
+			c.Infow("not the leader, skip job", "lease", l.name, "holder", l.holder)
+			return
+		}
+		jobCTX, cancel := l.leaderContext(c)
+		defer cancel()
+		j.RunContext(jobCTX)
+	})
+}
+
+// waitLeader reports whether this replica is the leader within leaseTTL. After the leader crashes or releases
+// the lease, no replica is the leader until another one renews the lease.
+func (l *Leader) waitLeader(c ctx.CTX) bool {
+	deadline := timeNow().Add(leaseTTL)
+	for !l.IsLeader() {
+		if !timeNow().Before(deadline) {
+			return false
+		}
+		if err := sleep(c, leaderCheckInterval); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// leaderContext returns a copy of c which is done when this replica is no longer the leader
+func (l *Leader) leaderContext(c ctx.CTX) (ctx.CTX, context.CancelFunc) {
+	leaderCTX, cancel := context.WithCancel(c.Context)
+	go func() {
+		ticker := time.NewTicker(leaderCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaderCTX.Done():
+				return
+			case <-ticker.C:
+				if !l.IsLeader() {
+					c.Warnw("lease lost, stop job", "lease", l.name, "holder", l.holder)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return c.WithContext(leaderCTX), cancel
+}
+
+func (l *Leader) renew(c ctx.CTX) {
+	now := timeNow()
+	expiresAt := now.Add(leaseTTL).Unix()
+	ok, err := l.repo.AcquireLease(c, repository.AcquireLeaseInput{
+		Name:      l.name,
+		Holder:    l.holder,
+		Now:       now.Unix(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		// 續約失敗時保留原本的期限，過期之後就不再是 leader
+		c.Errorw("renew lease failed", ctx.Err(err))
+		return
+	}
+
+	wasLeader := l.IsLeader()
+	if ok {
+		l.expiresAt.Store(expiresAt)
+	} else {
+		l.expiresAt.Store(0)
+	}
+	if ok != wasLeader {
+		c.Infow("leadership changed", "leader", ok)
+	}
+}
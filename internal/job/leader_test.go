@@ -0,0 +1,160 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/internal/repository/mocks"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/stretchr/testify/suite"
+)
+
+type leaderSuite struct {
+	suite.Suite
+	ctx      ctx.CTX
+	mockRepo *mocks.LeaseRepository
+	now      time.Time
+}
+
+func (s *leaderSuite) SetupSuite() {
+	s.ctx = ctx.Background()
+	s.mockRepo = mocks.NewLeaseRepository(s.T())
+}
+
+func (s *leaderSuite) SetupTest() {
+	s.now = time.Unix(1000, 0)
+	timeNow = func() time.Time {
+		return s.now
+	}
+	sleep = func(c ctx.CTX, d time.Duration) error {
+		s.now = s.now.Add(d)
+		return nil
+	}
+}
+
+func (s *leaderSuite) mockAcquire(ok bool, err error) {
+	s.mockRepo.On("AcquireLease", mockCTX, repository.AcquireLeaseInput{
+		Name:      SchedulerLease,
+		Holder:    "holder_1",
+		Now:       s.now.Unix(),
+		ExpiresAt: s.now.Add(leaseTTL).Unix(),
+	}).Return(ok, err).Once()
+}
+
+func (s *leaderSuite) TestRenew() {
+	l := NewLeader(s.ctx, s.mockRepo, SchedulerLease, "holder_1")
+	s.False(l.IsLeader())
+
+	s.mockAcquire(true, nil)
+	l.renew(s.ctx)
+	s.True(l.IsLeader())
+
+	// 續約失敗時在期限內還是 leader，過期後就不是
+	s.now = s.now.Add(leaseRenewInterval)
+	s.mockAcquire(false, errors.New("database is locked"))
+	l.renew(s.ctx)
+	s.True(l.IsLeader())
+
+	s.now = s.now.Add(leaseTTL)
+	s.False(l.IsLeader())
+
+	// 被其他 replica 接手
+	s.mockAcquire(false, nil)
+	l.renew(s.ctx)
+	s.False(l.IsLeader())
+}
+
+func (s *leaderSuite) TestWrap() {
+	l := NewLeader(s.ctx, s.mockRepo, SchedulerLease, "holder_1")
+	runs := 0
+	j := l.Wrap(s.ctx, jobFunc(func(c ctx.CTX) {
+		runs++
+	}))
+
+	// 其他 replica 是 leader 時，等到 lease 的有效時間過去就跳過
+	start := s.now
+	j.Run()
+	s.Equal(0, runs)
+	s.Equal(start.Add(leaseTTL), s.now)
+
+	s.mockAcquire(true, nil)
+	l.renew(s.ctx)
+	j.Run()
+	s.Equal(1, runs)
+}
+
+func (s *leaderSuite) TestWrapWithoutLeader() {
+	l := NewLeader(s.ctx, s.mockRepo, SchedulerLease, "holder_1")
+	runs := 0
+	j := l.Wrap(s.ctx, jobFunc(func(c ctx.CTX) {
+		runs++
+	}))
+
+	// job 觸發時沒有 replica 是 leader，例如 leader 剛停掉，這個 replica 接手後執行
+	sleeps := 0
+	sleep = func(c ctx.CTX, d time.Duration) error {
+		s.now = s.now.Add(d)
+		sleeps++
+		if sleeps == 3 {
+			s.mockAcquire(true, nil)
+			l.renew(s.ctx)
+		}
+		return nil
+	}
+	j.Run()
+	s.Equal(1, runs)
+	s.Equal(3, sleeps)
+}
+
+func (s *leaderSuite) TestWrapStoppedWhileWaiting() {
+	l := NewLeader(s.ctx, s.mockRepo, SchedulerLease, "holder_1")
+	runs := 0
+	sleep = sleepContext
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	j := l.Wrap(s.ctx.WithContext(c), jobFunc(func(c ctx.CTX) {
+		runs++
+	}))
+
+	// 關閉時不再等 lease
+	j.Run()
+	s.Equal(0, runs)
+}
+
+func (s *leaderSuite) TestWrapStopsWhenLeaseLost() {
+	l := NewLeader(s.ctx, s.mockRepo, SchedulerLease, "holder_1")
+	s.mockAcquire(true, nil)
+	l.renew(s.ctx)
+
+	started := make(chan struct{})
+	stopped := make(chan error)
+	j := l.Wrap(s.ctx, jobFunc(func(c ctx.CTX) {
+		close(started)
+		select {
+		case <-c.Done():
+			stopped <- c.Err()
+		case <-time.After(5 * leaderCheckInterval):
+			stopped <- nil
+		}
+	}))
+	go j.Run()
+	<-started
+
+	// 執行中的 job 在被其他 replica 接手後停止
+	s.mockAcquire(false, nil)
+	l.renew(s.ctx)
+	s.ErrorIs(<-stopped, context.Canceled)
+}
+
+type jobFunc func(c ctx.CTX)
+
+func (f jobFunc) RunContext(c ctx.CTX) {
+	f(c)
+}
+
+func TestLeaderSuite(t *testing.T) {
+	suite.Run(t, new(leaderSuite))
+}
@@ -0,0 +1,19 @@
+package job
+
+import (
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+)
+
+var (
+	jobRuns = metrics.NewCounterVec("job_runs_total",
+		"Number of scheduled job runs by job.", "job")
+	jobRetries = metrics.NewCounterVec("job_retries_total",
+		"Number of retried attempts of the scheduled jobs by job.", "job")
+	jobFailures = metrics.NewCounterVec("job_failures_total",
+		"Number of scheduled job runs failed after the retries or panicked by job.", "job")
+)
+
+const (
+	jobCreateCampaign    = "create_campaign"
+	jobReallocateCoupons = "reallocate_coupons"
+)
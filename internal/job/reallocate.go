@@ -0,0 +1,95 @@
+package job
+
+import (
+	"errors"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+// ReallocateCouponsJob reallocates the unclaimed coupons of the campaign whose grab window just ended,
+// it is safe to run more than once since a campaign is only reallocated once.
+type ReallocateCouponsJob struct {
+	ctx             ctx.CTX
+	campaignService service.CampaignService
+}
+
+func NewReallocateCouponsJob(c ctx.CTX, campaignService service.CampaignService) ReallocateCouponsJob {
+	return ReallocateCouponsJob{
+		ctx:             c,
+		campaignService: campaignService,
+	}
+}
+
+// Run implements cron.Job with the ctx of the job
+func (j ReallocateCouponsJob) Run() {
+	j.RunContext(j.ctx)
+}
+
+// RunContext retries with exponential backoff until c is done and never panics
+func (j ReallocateCouponsJob) RunContext(c ctx.CTX) {
+	c, span := c.StartSpan("ReallocateCouponsJob.Run")
+	defer span.End()
+	jobRuns.WithLabelValues(jobReallocateCoupons).Inc()
+
+	defer func() {
+		if r := recover(); r != nil {
+			jobFailures.WithLabelValues(jobReallocateCoupons).Inc()
+			c.Errorw("reallocate coupons job panicked", "panic", r)
+		}
+	}()
+
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := j.reallocate(c)
+		if err == nil {
+			c.Infow("unclaimed coupons reallocated", "campaign_id", res.CampaignID, "unclaimed", res.Unclaimed,
+				"reallocated", res.Reallocated, "attempt", attempt)
+			return
+		}
+		if errors.Is(err, service.ErrReallocationDisabled) {
+			// 剛結束的 campaign 沒有開啟重新分配，不算失敗
+			c.Infow("reallocation disabled, skipped", "attempt", attempt)
+			return
+		}
+
+		if !reallocationRetryable(err) || attempt == maxAttempts || c.Err() != nil {
+			jobFailures.WithLabelValues(jobReallocateCoupons).Inc()
+			c.Errorw("reallocate coupons failed", "attempt", attempt, ctx.Err(err))
+			return
+		}
+
+		jobRetries.WithLabelValues(jobReallocateCoupons).Inc()
+		c.Warnw("reallocate coupons failed, retrying", "attempt", attempt, "backoff", backoff.String(), ctx.Err(err))
+		if err := sleep(c, backoff); err != nil {
+			jobFailures.WithLabelValues(jobReallocateCoupons).Inc()
+			c.Errorw("reallocate coupons stopped", "attempt", attempt, ctx.Err(err))
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (j ReallocateCouponsJob) reallocate(c ctx.CTX) (*service.Reallocation, error) {
+	// 不用最新建立的 campaign，管理者可能已經提前建立之後的 campaign
+	campaign, err := j.campaignService.GetLatest(c, service.GetLatestCampaignInput{GrabEnded: true})
+	if err != nil {
+		return nil, err
+	}
+	return j.campaignService.ReallocateCoupons(c.With("campaign_id", campaign.ID), service.ReallocateCouponsInput{CampaignID: campaign.ID})
+}
+
+// 不在重新分配時間、已經分配過或 campaign 不存在，重試也不會成功
+func reallocationRetryable(err error) bool {
+	for _, target := range []error{
+		service.ErrNotReallocationTime,
+		service.ErrAlreadyReallocated,
+		service.ErrCampaignNotFound,
+		service.ErrCampaignCancelled,
+	} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/internal/service"
+	"github.com/asymptoter/tonx-take-home-test/internal/service/mocks"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type reallocateCouponsJobSuite struct {
+	suite.Suite
+	mockService *mocks.CampaignService
+	job         ReallocateCouponsJob
+	sleeps      []time.Duration
+}
+
+func (s *reallocateCouponsJobSuite) SetupTest() {
+	s.mockService = mocks.NewCampaignService(s.T())
+	s.job = NewReallocateCouponsJob(ctx.Background(), s.mockService)
+	s.sleeps = nil
+	sleep = func(c ctx.CTX, d time.Duration) error {
+		s.sleeps = append(s.sleeps, d)
+		return nil
+	}
+}
+
+func (s *reallocateCouponsJobSuite) mockLatest() {
+	s.mockService.On("GetLatest", mockCTX, service.GetLatestCampaignInput{GrabEnded: true}).Return(&service.Campaign{ID: 1}, nil)
+}
+
+var reallocateInput = service.ReallocateCouponsInput{CampaignID: 1}
+
+func (s *reallocateCouponsJobSuite) TestRun() {
+	runs := jobRuns.WithLabelValues(jobReallocateCoupons).Value()
+	failures := jobFailures.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockLatest()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Return(&service.Reallocation{CampaignID: 1, Reallocated: 3}, nil).Once()
+
+	s.job.Run()
+	s.Empty(s.sleeps)
+	s.Equal(runs+1, jobRuns.WithLabelValues(jobReallocateCoupons).Value())
+	s.Equal(failures, jobFailures.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func (s *reallocateCouponsJobSuite) TestRunWithRetry() {
+	retries := jobRetries.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockLatest()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Return(nil, errors.New("database is locked")).Once()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Return(&service.Reallocation{CampaignID: 1}, nil).Once()
+
+	s.job.Run()
+	s.Equal([]time.Duration{time.Second}, s.sleeps)
+	s.Equal(retries+1, jobRetries.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func (s *reallocateCouponsJobSuite) TestRunWithGetLatestError() {
+	failures := jobFailures.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockService.On("GetLatest", mockCTX, service.GetLatestCampaignInput{GrabEnded: true}).Return(nil, errors.New("database is locked")).Times(maxAttempts)
+
+	s.job.Run()
+	s.Len(s.sleeps, maxAttempts-1)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func (s *reallocateCouponsJobSuite) TestRunWithAlreadyReallocatedError() {
+	failures := jobFailures.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockLatest()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Return(nil, service.ErrAlreadyReallocated).Once()
+
+	s.job.Run()
+	s.Empty(s.sleeps)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func (s *reallocateCouponsJobSuite) TestRunWithReallocationDisabled() {
+	failures := jobFailures.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockLatest()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Return(nil, service.ErrReallocationDisabled).Once()
+
+	s.job.Run()
+	s.Empty(s.sleeps)
+	s.Equal(failures, jobFailures.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func (s *reallocateCouponsJobSuite) TestRunWithPanic() {
+	failures := jobFailures.WithLabelValues(jobReallocateCoupons).Value()
+	s.mockLatest()
+	s.mockService.On("ReallocateCoupons", mockCTX, reallocateInput).Run(func(args mock.Arguments) {
+		panic("unexpected")
+	}).Return(nil, nil).Once()
+
+	s.NotPanics(s.job.Run)
+	s.Equal(failures+1, jobFailures.WithLabelValues(jobReallocateCoupons).Value())
+}
+
+func TestReallocateCouponsJobSuite(t *testing.T) {
+	suite.Run(t, new(reallocateCouponsJobSuite))
+}
+
+// reallocateCouponsJobDBSuite runs the job with the service and a sqlite database
+type reallocateCouponsJobDBSuite struct {
+	suite.Suite
+	ctx  ctx.CTX
+	db   *gorm.DB
+	repo repository.CampaignRepository
+	job  ReallocateCouponsJob
+}
+
+func (s *reallocateCouponsJobDBSuite) SetupTest() {
+	s.ctx = ctx.Background()
+	var err error
+	s.db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.Require().NoError(err)
+	s.repo = repository.NewCampaignRepository(s.ctx, s.db, repository.Config{AutoMigrate: true})
+	s.job = NewReallocateCouponsJob(s.ctx, service.NewCampaignService(s.ctx, s.repo, service.DefaultConfig()))
+}
+
+func (s *reallocateCouponsJobDBSuite) TearDownTest() {
+	db, err := s.db.DB()
+	s.Require().NoError(err)
+	s.NoError(db.Close())
+}
+
+// createCampaign creates a campaign whose grab window ends at grabEndAt
+func (s *reallocateCouponsJobDBSuite) createCampaign(grabEndAt time.Time) *repository.Campaign {
+	res, err := s.repo.Create(s.ctx, repository.CreateCampaignInput{
+		ReservationStartAt:  grabEndAt.Add(-6 * time.Minute).Unix(),
+		ReservationEndAt:    grabEndAt.Add(-2 * time.Minute).Unix(),
+		GrabStartAt:         grabEndAt.Add(-time.Minute).Unix(),
+		GrabEndAt:           grabEndAt.Unix(),
+		ReallocateUnclaimed: true,
+	})
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *reallocateCouponsJobDBSuite) getCampaign(id uint) *repository.Campaign {
+	res, err := s.repo.Get(s.ctx, repository.GetCampaignInput{ID: id})
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *reallocateCouponsJobDBSuite) TestRunWithFutureCampaign() {
+	now := time.Now()
+	ended := s.createCampaign(now.Add(-10 * time.Second))
+	// 管理者提前建立明天的 campaign
+	future := s.createCampaign(now.Add(24 * time.Hour))
+
+	s.job.Run()
+	s.NotZero(s.getCampaign(ended.ID).ReallocatedAt)
+	s.Zero(s.getCampaign(future.ID).ReallocatedAt)
+}
+
+// createReservations creates an unclaimed winner and a loser of the campaign
+func (s *reallocateCouponsJobDBSuite) createReservations(campaignID uint, winner, loser string) {
+	_, err := s.repo.CreateCouponReservation(s.ctx, repository.CreateCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     winner,
+		CouponCode: "coupon_code_" + winner,
+		WonDraw:    true,
+	})
+	s.Require().NoError(err)
+	_, err = s.repo.CreateCouponReservation(s.ctx, repository.CreateCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     loser,
+	})
+	s.Require().NoError(err)
+}
+
+func (s *reallocateCouponsJobDBSuite) listWinners(campaignID uint) []repository.CouponReservation {
+	winner := true
+	res, err := s.repo.ListCouponReservations(s.ctx, repository.ListCouponReservationsInput{
+		CampaignID: campaignID,
+		Winner:     &winner,
+	})
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *reallocateCouponsJobDBSuite) TestRunReallocatesEndedCampaign() {
+	now := time.Now()
+	ended := s.createCampaign(now.Add(-10 * time.Second))
+	s.createReservations(ended.ID, "user_id_1", "user_id_2")
+	future := s.createCampaign(now.Add(24 * time.Hour))
+	s.createReservations(future.ID, "user_id_3", "user_id_4")
+
+	// 沒領取的 coupon 移給剛結束的 campaign 中沒中獎的用戶
+	s.job.Run()
+	winners := s.listWinners(ended.ID)
+	s.Require().Len(winners, 1)
+	s.Equal("user_id_2", winners[0].UserID)
+	s.Equal("coupon_code_user_id_1", winners[0].CouponCode)
+	s.NotZero(winners[0].ReallocatedAt)
+
+	// 之後的 campaign 不受影響
+	winners = s.listWinners(future.ID)
+	s.Require().Len(winners, 1)
+	s.Equal("user_id_3", winners[0].UserID)
+	s.Zero(winners[0].ReallocatedAt)
+}
+
+func TestReallocateCouponsJobDBSuite(t *testing.T) {
+	suite.Run(t, new(reallocateCouponsJobDBSuite))
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+// AuditLog is an append-only record of a state change,
+// Before and After are JSON snapshots of the changed values.
+type AuditLog struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement:true"`
+	Created    int64  `gorm:"autoCreateTime"`
+	CampaignID uint   `gorm:"index"`
+	UserID     string `gorm:"index"`
+	Actor      string
+	Action     string
+	Before     string
+	After      string
+	RequestID  string
+}
+
+type CreateAuditLogInput struct {
+	CampaignID uint
+	UserID     string
+	Actor      string
+	Action     string
+	Before     string
+	After      string
+	RequestID  string
+}
+
+// ListAuditLogsInput lists audit logs from the newest one, filtered by CampaignID and
+// UserID if they are set. Cursor is the audit log id to continue before, 0 means from the newest one.
+type ListAuditLogsInput struct {
+	CampaignID uint
+	UserID     string
+	Cursor     uint
+	Limit      int
+}
+
+func (r campaignRepository) CreateAuditLog(c ctx.CTX, p CreateAuditLogInput) (*AuditLog, error) {
+	c, span := c.StartSpan("campaignRepository.CreateAuditLog", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	res := AuditLog{
+		CampaignID: p.CampaignID,
+		UserID:     p.UserID,
+		Actor:      p.Actor,
+		Action:     p.Action,
+		Before:     p.Before,
+		After:      p.After,
+		RequestID:  p.RequestID,
+	}
+	if err := r.db.WithContext(c).Create(&res).Error; err != nil {
+		c.Errorw("create audit log failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) ListAuditLogs(c ctx.CTX, p ListAuditLogsInput) ([]AuditLog, error) {
+	c, span := c.StartSpan("campaignRepository.ListAuditLogs", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	db := r.db.WithContext(c)
+	if p.CampaignID != 0 {
+		db = db.Where("campaign_id = ?", p.CampaignID)
+	}
+	if p.UserID != "" {
+		db = db.Where("user_id = ?", p.UserID)
+	}
+	if p.Cursor != 0 {
+		db = db.Where("id < ?", p.Cursor)
+	}
+
+	var res []AuditLog
+	if err := db.Order("id DESC").Limit(p.Limit).Find(&res).Error; err != nil {
+		c.Errorw("list audit logs failed", ctx.Err(err))
+		return nil, err
+	}
+	return res, nil
+}
@@ -1,33 +1,156 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCampaignNotFound    = errors.New("campaign not found")
+	ErrCampaignStarted     = errors.New("campaign already started")
+	ErrAlreadyReallocated  = errors.New("campaign already reallocated")
+	ErrInvalidReallocation = errors.New("invalid reallocation")
+	ErrNotRedeemable       = errors.New("coupon not redeemable")
+	ErrReservationNotFound = errors.New("coupon reservation not found")
+	ErrMigrationPending    = errors.New("migration pending")
 )
 
+// Campaign windows are unix timestamps, each window is [start, end)
 type Campaign struct {
-	ID      uint  `gorm:"primaryKey;autoIncrement:true"`
-	Created int64 `gorm:"autoCreateTime"`
+	ID                  uint  `gorm:"primaryKey;autoIncrement:true"`
+	Created             int64 `gorm:"autoCreateTime"`
+	Updated             int64 `gorm:"autoUpdateTime"`
+	ReservationStartAt  int64 `gorm:"index"`
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64 `gorm:"index"`
+	ReallocateUnclaimed bool
+	ReallocatedAt       int64
+	CancelledAt         int64
+	// ScheduleKey identifies the scheduled slot of the campaign, e.g. daily:2024-08-26:2300,
+	// it's null for campaigns created by operators.
+	ScheduleKey *string `gorm:"uniqueIndex"`
+	// DrawMode decides the winners, empty for the campaigns created before draw modes
+	DrawMode string
+	// WinRatio, SeedHash and Seed are committed when the campaign is created for the keyed draws,
+	// each campaign has its own Seed which is secret until the commit-reveal draw reveals it.
+	WinRatio float64
+	SeedHash string
+	Seed     lottery.Seed
 }
 
 // CouponReservation represents a user's coupon reservation
 type CouponReservation struct {
-	CampaignID uint   `gorm:"primaryKey"`
-	UserID     string `gorm:"primaryKey"`
+	CampaignID    uint   `gorm:"primaryKey;index:idx_coupon_reservations_user_campaign,priority:2"`
+	UserID        string `gorm:"primaryKey;index:idx_coupon_reservations_user_campaign,priority:1"`
+	CouponCode    string
+	Created       int64 `gorm:"autoCreateTime"`
+	ClaimedAt     int64
+	RedeemedAt    int64
+	ReallocatedAt int64
+	// WonDraw is the result of the draw at reservation, it isn't changed by the reallocation
+	WonDraw  bool
+	Campaign Campaign `gorm:"foreignKey:CampaignID"`
+}
+
+// CouponReallocation moves the coupon of an unclaimed winner to a loser
+type CouponReallocation struct {
+	FromUserID string
+	ToUserID   string
 	CouponCode string
-	Campaign   Campaign `gorm:"foreignKey:CampaignID"`
 }
 
+// CampaignStats is aggregated from the reservations of a campaign
+type CampaignStats struct {
+	Reservations          int64
+	Winners               int64
+	Claimed               int64
+	Redeemed              int64
+	ReservationsPerMinute []MinuteCount `gorm:"-"`
+}
+
+// MinuteCount is the number of reservations made in the minute starting at Minute
+type MinuteCount struct {
+	Minute int64
+	Count  int64
+}
+
+// CouponClaim is the result of claiming a coupon reservation
+type CouponClaim struct {
+	Reservation    CouponReservation
+	AlreadyClaimed bool
+}
+
+// CreateCampaignInput creates a campaign, the campaign already created with
+// the same ScheduleKey is returned instead if ScheduleKey is set.
 type CreateCampaignInput struct {
+	ReservationStartAt  int64
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64
+	ReallocateUnclaimed bool
+	ScheduleKey         string
+	DrawMode            string
+	WinRatio            float64
+	SeedHash            string
+	Seed                lottery.Seed
+}
+
+type GetCampaignInput struct {
+	ID uint
+}
+
+type GetCampaignByScheduleKeyInput struct {
+	ScheduleKey string
+}
+
+// ListCampaignsInput lists campaigns from the newest one,
+// Cursor is the campaign id to continue before, 0 means from the newest one.
+type ListCampaignsInput struct {
+	Cursor uint
+	Limit  int
+}
+
+// UpdateCampaignInput updates the windows of a campaign which is not opened at Now yet
+type UpdateCampaignInput struct {
+	ID                  uint
+	Now                 int64
+	ReservationStartAt  int64
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64
+	ReallocateUnclaimed bool
+}
+
+type CancelCampaignInput struct {
+	ID uint
 }
 
+// CountOverlappingCampaignsInput counts the campaigns, other than ExcludeID,
+// whose windows overlap with [Start, End).
+type CountOverlappingCampaignsInput struct {
+	ExcludeID uint
+	Start     int64
+	End       int64
+}
+
+// GetLatestCampaignInput returns the campaign whose grab window ended last at or before GrabEndedBefore
+// in unix seconds, or the campaign created last if 0.
 type GetLatestCampaignInput struct {
+	GrabEndedBefore int64
 }
 
 type CreateCouponReservationInput struct {
 	CampaignID uint
 	UserID     string
 	CouponCode string
+	WonDraw    bool
 }
 
 type GetCouponReservationInput struct {
@@ -35,24 +158,128 @@ type GetCouponReservationInput struct {
 	UserID     string
 }
 
+type ClaimCouponReservationInput struct {
+	CampaignID uint
+	UserID     string
+}
+
+type RedeemCouponReservationInput struct {
+	CampaignID uint
+	UserID     string
+}
+
+type GetCampaignStatsInput struct {
+	CampaignID uint
+}
+
+// ListCouponReservationsInput lists the reservations of a campaign, Winner filters who holds a coupon now
+// while WonDraw filters who won the draw at reservation.
+type ListCouponReservationsInput struct {
+	CampaignID  uint
+	Winner      *bool
+	Claimed     *bool
+	WonDraw     *bool
+	Reallocated *bool
+}
+
+// ScanCouponReservationsInput scans the reservations of a campaign ordered by user_id,
+// only winners are scanned if WinnersOnly.
+type ScanCouponReservationsInput struct {
+	CampaignID  uint
+	WinnersOnly bool
+}
+
+// ListUserCouponReservationsInput lists the reservations of a user from the newest campaign,
+// Cursor is the campaign id to continue before, 0 means from the newest one.
+type ListUserCouponReservationsInput struct {
+	UserID string
+	Cursor uint
+	Limit  int
+}
+
+// ReallocateCouponsInput applies Reallocations, a campaign can only be reallocated once unless Rerun.
+type ReallocateCouponsInput struct {
+	CampaignID    uint
+	Reallocations []CouponReallocation
+	Rerun         bool
+}
+
 type CampaignRepository interface {
 	Create(c ctx.CTX, p CreateCampaignInput) (*Campaign, error)
+	Get(c ctx.CTX, p GetCampaignInput) (*Campaign, error)
+	GetByScheduleKey(c ctx.CTX, p GetCampaignByScheduleKeyInput) (*Campaign, error)
 	GetLatest(c ctx.CTX, p GetLatestCampaignInput) (*Campaign, error)
+	List(c ctx.CTX, p ListCampaignsInput) ([]Campaign, error)
+	Update(c ctx.CTX, p UpdateCampaignInput) (*Campaign, error)
+	Cancel(c ctx.CTX, p CancelCampaignInput) (*Campaign, error)
+	CountOverlapping(c ctx.CTX, p CountOverlappingCampaignsInput) (int64, error)
+	GetStats(c ctx.CTX, p GetCampaignStatsInput) (*CampaignStats, error)
 
 	CreateCouponReservation(c ctx.CTX, p CreateCouponReservationInput) (*CouponReservation, error)
 	GetCouponReservation(c ctx.CTX, p GetCouponReservationInput) (*CouponReservation, error)
+	// ClaimCouponReservation atomically records claimed_at of a reservation,
+	// a reservation can only be claimed once.
+	ClaimCouponReservation(c ctx.CTX, p ClaimCouponReservationInput) (*CouponClaim, error)
+	// RedeemCouponReservation records redeemed_at of a claimed coupon,
+	// ErrNotRedeemable is returned if the coupon is not claimed or already redeemed.
+	RedeemCouponReservation(c ctx.CTX, p RedeemCouponReservationInput) (*CouponReservation, error)
+	ListCouponReservations(c ctx.CTX, p ListCouponReservationsInput) ([]CouponReservation, error)
+	ListUserCouponReservations(c ctx.CTX, p ListUserCouponReservationsInput) ([]CouponReservation, error)
+	// ScanCouponReservations calls fn for each reservation read from a database cursor,
+	// so memory doesn't grow with the number of reservations.
+	ScanCouponReservations(c ctx.CTX, p ScanCouponReservationsInput, fn func(*CouponReservation) error) error
+
+	// ReallocateCoupons applies the reallocations of a campaign in one transaction.
+	// Reallocations whose coupon has been claimed in the meantime are skipped,
+	// only the applied ones are returned.
+	ReallocateCoupons(c ctx.CTX, p ReallocateCouponsInput) ([]CouponReallocation, error)
+
+	// CreateAuditLog appends an audit log, audit logs are never updated or deleted
+	CreateAuditLog(c ctx.CTX, p CreateAuditLogInput) (*AuditLog, error)
+	ListAuditLogs(c ctx.CTX, p ListAuditLogsInput) ([]AuditLog, error)
+
+	// Ping checks the database connection
+	Ping(c ctx.CTX) error
+	// CheckMigrations returns ErrMigrationPending if a table or a column is missing
+	CheckMigrations(c ctx.CTX) error
 }
 
 type campaignRepository struct {
 	db *gorm.DB
 }
 
-func NewCampaignRepository(c ctx.CTX, db *gorm.DB) CampaignRepository {
-	if err := db.AutoMigrate(Campaign{}); err != nil {
-		c.Fatal(err)
+// Config configures the campaign repository
+type Config struct {
+	// AutoMigrate migrates the tables when the repository is created,
+	// disable it if migrations are run by couponctl migrate.
+	AutoMigrate bool
+}
+
+// models are migrated in order
+var models = []any{Campaign{}, CouponReservation{}, AuditLog{}, Lease{}, RateLimitBucket{}, IdempotencyKey{}}
+
+// Migrate creates or updates the tables of the campaign and lease repositories and the rate limit store
+func Migrate(db *gorm.DB) error {
+	backfillWonDraw := db.Migrator().HasTable(&CouponReservation{}) && !db.Migrator().HasColumn(&CouponReservation{}, "won_draw")
+	for _, model := range models {
+		if err := db.AutoMigrate(model); err != nil {
+			return err
+		}
 	}
-	if err := db.AutoMigrate(CouponReservation{}); err != nil {
-		c.Fatal(err)
+	if backfillWonDraw {
+		// 舊的 reservation 沒有記錄抽籤結果，只能從 coupon 和 reallocated_at 推算
+		return db.Model(&CouponReservation{}).
+			Where("(reallocated_at = 0 AND coupon_code <> '') OR (reallocated_at <> 0 AND coupon_code = '')").
+			Update("won_draw", true).Error
+	}
+	return nil
+}
+
+func NewCampaignRepository(c ctx.CTX, db *gorm.DB, cfg Config) CampaignRepository {
+	if cfg.AutoMigrate {
+		if err := Migrate(db); err != nil {
+			c.Fatal(err)
+		}
 	}
 	return campaignRepository{
 		db: db,
@@ -60,41 +287,460 @@ func NewCampaignRepository(c ctx.CTX, db *gorm.DB) CampaignRepository {
 }
 
 func (r campaignRepository) Create(c ctx.CTX, p CreateCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.Create")
+	defer span.End()
+
+	res := Campaign{
+		ReservationStartAt:  p.ReservationStartAt,
+		ReservationEndAt:    p.ReservationEndAt,
+		GrabStartAt:         p.GrabStartAt,
+		GrabEndAt:           p.GrabEndAt,
+		ReallocateUnclaimed: p.ReallocateUnclaimed,
+		DrawMode:            p.DrawMode,
+		WinRatio:            p.WinRatio,
+		SeedHash:            p.SeedHash,
+		Seed:                p.Seed,
+	}
+	if p.ScheduleKey == "" {
+		if err := r.db.WithContext(c).Create(&res).Error; err != nil {
+			c.Errorw("create campaign failed", ctx.Err(err))
+			return nil, err
+		}
+		return &res, nil
+	}
+
+	// 同一個 schedule key 只會建立一次，重複建立時回傳已經存在的 campaign
+	res.ScheduleKey = &p.ScheduleKey
+	result := r.db.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&res)
+	if err := result.Error; err != nil {
+		c.Errorw("create campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return r.GetByScheduleKey(c, GetCampaignByScheduleKeyInput{ScheduleKey: p.ScheduleKey})
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) GetByScheduleKey(c ctx.CTX, p GetCampaignByScheduleKeyInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.GetByScheduleKey")
+	defer span.End()
+
 	var res Campaign
-	if err := r.db.Create(&res).Error; err != nil {
-		c.Error(err)
+	if err := r.db.WithContext(c).Where("schedule_key = ?", p.ScheduleKey).First(&res).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Errorw("get campaign by schedule key failed", ctx.Err(ErrCampaignNotFound))
+		return nil, ErrCampaignNotFound
+	} else if err != nil {
+		c.Errorw("get campaign by schedule key failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) Get(c ctx.CTX, p GetCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.Get", "campaign_id", p.ID)
+	defer span.End()
+
+	var res Campaign
+	if err := r.db.WithContext(c).First(&res, p.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Errorw("get campaign failed", ctx.Err(ErrCampaignNotFound))
+		return nil, ErrCampaignNotFound
+	} else if err != nil {
+		c.Errorw("get campaign failed", ctx.Err(err))
 		return nil, err
 	}
 	return &res, nil
 }
 
 func (r campaignRepository) GetLatest(c ctx.CTX, p GetLatestCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.GetLatest")
+	defer span.End()
+
+	var res Campaign
+	db := r.db.WithContext(c).Where("cancelled_at = 0")
+	if p.GrabEndedBefore != 0 {
+		// 提前建立的 campaign 比較新，但還沒開始
+		db = db.Where("grab_end_at <= ?", p.GrabEndedBefore).Order("grab_end_at DESC")
+	}
+	if err := db.Last(&res).Error; err != nil {
+		c.Errorw("get latest campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) List(c ctx.CTX, p ListCampaignsInput) ([]Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.List")
+	defer span.End()
+
+	db := r.db.WithContext(c)
+	if p.Cursor != 0 {
+		db = db.Where("id < ?", p.Cursor)
+	}
+
+	var res []Campaign
+	if err := db.Order("id DESC").Limit(p.Limit).Find(&res).Error; err != nil {
+		c.Errorw("list campaigns failed", ctx.Err(err))
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r campaignRepository) Update(c ctx.CTX, p UpdateCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.Update", "campaign_id", p.ID)
+	defer span.End()
+
 	var res Campaign
-	if err := r.db.Last(&res).Error; err != nil {
-		c.Error(err)
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// 活動開始預約之後就不能再修改
+		result := tx.Model(&Campaign{}).
+			Where("id = ? AND cancelled_at = 0 AND reservation_start_at > ?", p.ID, p.Now).
+			Updates(map[string]any{
+				"reservation_start_at": p.ReservationStartAt,
+				"reservation_end_at":   p.ReservationEndAt,
+				"grab_start_at":        p.GrabStartAt,
+				"grab_end_at":          p.GrabEndAt,
+				"reallocate_unclaimed": p.ReallocateUnclaimed,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCampaignStarted
+		}
+
+		return tx.First(&res, p.ID).Error
+	})
+	if err != nil {
+		c.Errorw("update campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) Cancel(c ctx.CTX, p CancelCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignRepository.Cancel", "campaign_id", p.ID)
+	defer span.End()
+
+	var res Campaign
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Campaign{}).
+			Where("id = ? AND cancelled_at = 0", p.ID).
+			Update("cancelled_at", time.Now().Unix()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&res, p.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCampaignNotFound
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		c.Errorw("cancel campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) CountOverlapping(c ctx.CTX, p CountOverlappingCampaignsInput) (int64, error) {
+	c, span := c.StartSpan("campaignRepository.CountOverlapping")
+	defer span.End()
+
+	var res int64
+	if err := r.db.WithContext(c).Model(&Campaign{}).
+		Where("id <> ? AND cancelled_at = 0 AND reservation_start_at < ? AND grab_end_at > ?", p.ExcludeID, p.End, p.Start).
+		Count(&res).Error; err != nil {
+		c.Errorw("count overlapping campaigns failed", ctx.Err(err))
+		return 0, err
+	}
+	return res, nil
+}
+
+func (r campaignRepository) GetStats(c ctx.CTX, p GetCampaignStatsInput) (*CampaignStats, error) {
+	c, span := c.StartSpan("campaignRepository.GetStats", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	var res CampaignStats
+	if err := r.db.WithContext(c).Model(&CouponReservation{}).
+		Select(`COUNT(*) AS reservations,
+			COALESCE(SUM(CASE WHEN coupon_code <> '' THEN 1 ELSE 0 END), 0) AS winners,
+			COALESCE(SUM(CASE WHEN coupon_code <> '' AND claimed_at <> 0 THEN 1 ELSE 0 END), 0) AS claimed,
+			COALESCE(SUM(CASE WHEN redeemed_at <> 0 THEN 1 ELSE 0 END), 0) AS redeemed`).
+		Where("campaign_id = ?", p.CampaignID).
+		Scan(&res).Error; err != nil {
+		c.Errorw("get campaign stats failed", ctx.Err(err))
+		return nil, err
+	}
+
+	if err := r.db.WithContext(c).Model(&CouponReservation{}).
+		Select("created - created % 60 AS minute, COUNT(*) AS count").
+		Where("campaign_id = ?", p.CampaignID).
+		Group("minute").
+		Order("minute").
+		Scan(&res.ReservationsPerMinute).Error; err != nil {
+		c.Errorw("get campaign stats failed", ctx.Err(err))
 		return nil, err
 	}
 	return &res, nil
 }
 
 func (r campaignRepository) CreateCouponReservation(c ctx.CTX, p CreateCouponReservationInput) (*CouponReservation, error) {
+	c, span := c.StartSpan("campaignRepository.CreateCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
 	res := CouponReservation{
 		CampaignID: p.CampaignID,
 		UserID:     p.UserID,
 		CouponCode: p.CouponCode,
+		WonDraw:    p.WonDraw,
 	}
-	if err := r.db.Create(&res).Error; err != nil {
-		c.Error(err)
+	if err := r.db.WithContext(c).Create(&res).Error; err != nil {
+		c.Errorw("create coupon reservation failed", ctx.Err(err))
 		return nil, err
 	}
 	return &res, nil
 }
 
 func (r campaignRepository) GetCouponReservation(c ctx.CTX, p GetCouponReservationInput) (*CouponReservation, error) {
+	c, span := c.StartSpan("campaignRepository.GetCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	var res CouponReservation
+	if err := r.db.WithContext(c).First(&res, "campaign_id = ? AND user_id = ?", p.CampaignID, p.UserID).Error; err != nil {
+		c.Errorw("get coupon reservation failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) ClaimCouponReservation(c ctx.CTX, p ClaimCouponReservationInput) (*CouponClaim, error) {
+	c, span := c.StartSpan("campaignRepository.ClaimCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	var res CouponClaim
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&CouponReservation{}).
+			Where("campaign_id = ? AND user_id = ? AND claimed_at = 0", p.CampaignID, p.UserID).
+			Update("claimed_at", time.Now().Unix())
+		if result.Error != nil {
+			return result.Error
+		}
+		res.AlreadyClaimed = result.RowsAffected == 0
+
+		err := tx.First(&res.Reservation, "campaign_id = ? AND user_id = ?", p.CampaignID, p.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservationNotFound
+		}
+		return err
+	})
+	if err != nil {
+		c.Errorw("claim coupon reservation failed", ctx.Err(err))
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r campaignRepository) RedeemCouponReservation(c ctx.CTX, p RedeemCouponReservationInput) (*CouponReservation, error) {
+	c, span := c.StartSpan("campaignRepository.RedeemCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
 	var res CouponReservation
-	if err := r.db.First(&res, "campaign_id = ? AND user_id = ?", p.CampaignID, p.UserID).Error; err != nil {
-		c.Error(err)
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&CouponReservation{}).
+			Where("campaign_id = ? AND user_id = ? AND coupon_code <> '' AND claimed_at <> 0 AND redeemed_at = 0", p.CampaignID, p.UserID).
+			Update("redeemed_at", time.Now().Unix())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotRedeemable
+		}
+
+		return tx.First(&res, "campaign_id = ? AND user_id = ?", p.CampaignID, p.UserID).Error
+	})
+	if err != nil {
+		c.Errorw("redeem coupon reservation failed", ctx.Err(err))
 		return nil, err
 	}
 	return &res, nil
 }
+
+func (r campaignRepository) ListCouponReservations(c ctx.CTX, p ListCouponReservationsInput) ([]CouponReservation, error) {
+	c, span := c.StartSpan("campaignRepository.ListCouponReservations", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	db := r.db.WithContext(c).Where("campaign_id = ?", p.CampaignID)
+	if p.Winner != nil {
+		if *p.Winner {
+			db = db.Where("coupon_code <> ''")
+		} else {
+			db = db.Where("coupon_code = ''")
+		}
+	}
+	if p.Claimed != nil {
+		if *p.Claimed {
+			db = db.Where("claimed_at <> 0")
+		} else {
+			db = db.Where("claimed_at = 0")
+		}
+	}
+	if p.WonDraw != nil {
+		db = db.Where("won_draw = ?", *p.WonDraw)
+	}
+	if p.Reallocated != nil {
+		if *p.Reallocated {
+			db = db.Where("reallocated_at <> 0")
+		} else {
+			db = db.Where("reallocated_at = 0")
+		}
+	}
+
+	var res []CouponReservation
+	if err := db.Order("user_id").Find(&res).Error; err != nil {
+		c.Errorw("list coupon reservations failed", ctx.Err(err))
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r campaignRepository) ListUserCouponReservations(c ctx.CTX, p ListUserCouponReservationsInput) ([]CouponReservation, error) {
+	c, span := c.StartSpan("campaignRepository.ListUserCouponReservations", "user_id", p.UserID)
+	defer span.End()
+
+	db := r.db.WithContext(c).Where("user_id = ?", p.UserID)
+	if p.Cursor != 0 {
+		db = db.Where("campaign_id < ?", p.Cursor)
+	}
+
+	var res []CouponReservation
+	if err := db.Order("campaign_id DESC").Limit(p.Limit).Find(&res).Error; err != nil {
+		c.Errorw("list user coupon reservations failed", ctx.Err(err))
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r campaignRepository) ScanCouponReservations(c ctx.CTX, p ScanCouponReservationsInput, fn func(*CouponReservation) error) error {
+	c, span := c.StartSpan("campaignRepository.ScanCouponReservations", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	db := r.db.WithContext(c).Model(&CouponReservation{}).Where("campaign_id = ?", p.CampaignID)
+	if p.WinnersOnly {
+		db = db.Where("coupon_code <> ''")
+	}
+
+	rows, err := db.Order("user_id").Rows()
+	if err != nil {
+		c.Errorw("scan coupon reservations failed", ctx.Err(err))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res CouponReservation
+		if err := r.db.ScanRows(rows, &res); err != nil {
+			c.Errorw("scan coupon reservations failed", ctx.Err(err))
+			return err
+		}
+		if err := fn(&res); err != nil {
+			c.Errorw("scan coupon reservations failed", ctx.Err(err))
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.Errorw("scan coupon reservations failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (r campaignRepository) ReallocateCoupons(c ctx.CTX, p ReallocateCouponsInput) ([]CouponReallocation, error) {
+	c, span := c.StartSpan("campaignRepository.ReallocateCoupons", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	var res []CouponReallocation
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		db := tx.Model(&Campaign{}).Where("id = ?", p.CampaignID)
+		if !p.Rerun {
+			db = db.Where("reallocated_at = 0")
+		}
+		result := db.Update("reallocated_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyReallocated
+		}
+
+		for _, a := range p.Reallocations {
+			// 只收回還沒被領取的 coupon，已經領取的就跳過
+			result := tx.Model(&CouponReservation{}).
+				Where("campaign_id = ? AND user_id = ? AND coupon_code = ? AND claimed_at = 0", p.CampaignID, a.FromUserID, a.CouponCode).
+				Updates(map[string]any{"coupon_code": "", "reallocated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			// 拿到重新分配 coupon 的用戶可以在補搶時間再領取一次，被收回的中獎者和已經拿到的用戶不能再拿
+			result = tx.Model(&CouponReservation{}).
+				Where("campaign_id = ? AND user_id = ? AND coupon_code = '' AND won_draw = ? AND reallocated_at = 0", p.CampaignID, a.ToUserID, false).
+				Updates(map[string]any{"coupon_code": a.CouponCode, "claimed_at": 0, "reallocated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInvalidReallocation
+			}
+			res = append(res, a)
+		}
+		return nil
+	})
+	if err != nil {
+		c.Errorw("reallocate coupons failed", ctx.Err(err))
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r campaignRepository) Ping(c ctx.CTX) error {
+	db, err := r.db.DB()
+	if err != nil {
+		c.Errorw("ping database failed", ctx.Err(err))
+		return err
+	}
+	if err := db.PingContext(c); err != nil {
+		c.Errorw("ping database failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (r campaignRepository) CheckMigrations(c ctx.CTX) error {
+	migrator := r.db.Migrator()
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: r.db}
+		if err := stmt.Parse(model); err != nil {
+			c.Errorw("check migrations failed", ctx.Err(err))
+			return err
+		}
+		if !migrator.HasTable(model) {
+			err := fmt.Errorf("%w: table %s", ErrMigrationPending, stmt.Schema.Table)
+			c.Errorw("check migrations failed", ctx.Err(err))
+			return err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				err := fmt.Errorf("%w: column %s.%s", ErrMigrationPending, stmt.Schema.Table, field.DBName)
+				c.Errorw("check migrations failed", ctx.Err(err))
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
 	"testing"
 
 	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -24,7 +27,7 @@ func (s *campaignRepositorySuite) SetupSuite() {
 		s.ctx.Fatal(err)
 	}
 
-	s.repo = NewCampaignRepository(s.ctx, s.db)
+	s.repo = NewCampaignRepository(s.ctx, s.db, Config{AutoMigrate: true})
 }
 
 func (s *campaignRepositorySuite) TearDownSuite() {
@@ -47,6 +50,16 @@ func (s *campaignRepositorySuite) SetupTest() {
 	if err := s.db.Exec("DELETE FROM coupon_reservations").Error; err != nil {
 		s.ctx.Fatal(err)
 	}
+
+	// Clear the audit logs table before each test
+	if err := s.db.Exec("DELETE FROM audit_logs").Error; err != nil {
+		s.ctx.Fatal(err)
+	}
+
+	// Reset the auto increment ids before each test
+	if err := s.db.Exec("DELETE FROM sqlite_sequence").Error; err != nil {
+		s.ctx.Fatal(err)
+	}
 }
 
 func (s *campaignRepositorySuite) TestCreate() {
@@ -55,6 +68,30 @@ func (s *campaignRepositorySuite) TestCreate() {
 	s.Equal(uint(1), campaign.ID)
 }
 
+func (s *campaignRepositorySuite) TestCreateWithScheduleKey() {
+	input := CreateCampaignInput{ScheduleKey: "daily:2024-08-26:2300"}
+	campaign, err := s.repo.Create(s.ctx, input)
+	s.NoError(err)
+
+	// 同一個 schedule key 再建立一次會拿到同一個 campaign
+	res, err := s.repo.Create(s.ctx, input)
+	s.NoError(err)
+	s.Equal(campaign.ID, res.ID)
+
+	// 沒有 schedule key 的 campaign 不受影響
+	_, err = s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+	_, err = s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+
+	res, err = s.repo.GetByScheduleKey(s.ctx, GetCampaignByScheduleKeyInput{ScheduleKey: input.ScheduleKey})
+	s.NoError(err)
+	s.Equal(campaign.ID, res.ID)
+
+	_, err = s.repo.GetByScheduleKey(s.ctx, GetCampaignByScheduleKeyInput{ScheduleKey: "daily:2024-08-27:2300"})
+	s.Equal(ErrCampaignNotFound, err)
+}
+
 func (s *campaignRepositorySuite) TestGetLatest() {
 	_, err := s.repo.Create(s.ctx, CreateCampaignInput{})
 	s.NoError(err)
@@ -67,6 +104,27 @@ func (s *campaignRepositorySuite) TestGetLatest() {
 	s.Equal(campaign2.ID, res.ID)
 }
 
+func (s *campaignRepositorySuite) TestGetLatestWithGrabEnded() {
+	ended, err := s.repo.Create(s.ctx, CreateCampaignInput{GrabEndAt: 2000})
+	s.NoError(err)
+	_, err = s.repo.Create(s.ctx, CreateCampaignInput{GrabEndAt: 1000})
+	s.NoError(err)
+	// 提前建立的 campaign 還沒結束
+	_, err = s.repo.Create(s.ctx, CreateCampaignInput{GrabEndAt: 3000})
+	s.NoError(err)
+
+	res, err := s.repo.GetLatest(s.ctx, GetLatestCampaignInput{GrabEndedBefore: 2500})
+	s.NoError(err)
+	s.Equal(ended.ID, res.ID)
+
+	res, err = s.repo.GetLatest(s.ctx, GetLatestCampaignInput{GrabEndedBefore: 2000})
+	s.NoError(err)
+	s.Equal(ended.ID, res.ID)
+
+	_, err = s.repo.GetLatest(s.ctx, GetLatestCampaignInput{GrabEndedBefore: 500})
+	s.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
 func (s *campaignRepositorySuite) TestCreateCouponReservation() {
 	createCouponReservationInput := CreateCouponReservationInput{
 		CampaignID: 1,
@@ -95,6 +153,489 @@ func (s *campaignRepositorySuite) TestGetCouponReservation() {
 	s.Equal(createCouponReservationInput.CouponCode, res.CouponCode)
 }
 
+func (s *campaignRepositorySuite) TestClaimCouponReservation() {
+	campaign, err := s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+	_, err = s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+		CampaignID: campaign.ID,
+		UserID:     "user_id_1",
+		CouponCode: "coupon_code_1",
+	})
+	s.NoError(err)
+
+	input := ClaimCouponReservationInput{
+		CampaignID: campaign.ID,
+		UserID:     "user_id_1",
+	}
+	res, err := s.repo.ClaimCouponReservation(s.ctx, input)
+	s.NoError(err)
+	s.False(res.AlreadyClaimed)
+	s.NotZero(res.Reservation.ClaimedAt)
+
+	res, err = s.repo.ClaimCouponReservation(s.ctx, input)
+	s.NoError(err)
+	s.True(res.AlreadyClaimed)
+	s.Equal("coupon_code_1", res.Reservation.CouponCode)
+
+	_, err = s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: campaign.ID,
+		UserID:     "user_id_2",
+	})
+	s.Equal(ErrReservationNotFound, err)
+}
+
+func (s *campaignRepositorySuite) TestListCouponReservations() {
+	campaign, err := s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+	for userID, couponCode := range map[string]string{
+		"user_id_1": "coupon_code_1",
+		"user_id_2": "coupon_code_2",
+		"user_id_3": "",
+	} {
+		_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: campaign.ID,
+			UserID:     userID,
+			CouponCode: couponCode,
+			WonDraw:    couponCode != "",
+		})
+		s.NoError(err)
+	}
+	_, err = s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: campaign.ID,
+		UserID:     "user_id_1",
+	})
+	s.NoError(err)
+
+	winner, claimed := true, false
+	res, err := s.repo.ListCouponReservations(s.ctx, ListCouponReservationsInput{
+		CampaignID: campaign.ID,
+		Winner:     &winner,
+		Claimed:    &claimed,
+	})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal("user_id_2", res[0].UserID)
+
+	res, err = s.repo.ListCouponReservations(s.ctx, ListCouponReservationsInput{
+		CampaignID: campaign.ID,
+	})
+	s.NoError(err)
+	s.Len(res, 3)
+
+	lost, reallocated := false, false
+	res, err = s.repo.ListCouponReservations(s.ctx, ListCouponReservationsInput{
+		CampaignID:  campaign.ID,
+		WonDraw:     &lost,
+		Reallocated: &reallocated,
+	})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal("user_id_3", res[0].UserID)
+	s.False(res[0].WonDraw)
+}
+
+func (s *campaignRepositorySuite) TestReallocateCoupons() {
+	campaign, err := s.repo.Create(s.ctx, CreateCampaignInput{ReallocateUnclaimed: true})
+	s.NoError(err)
+	for userID, couponCode := range map[string]string{
+		"user_id_1": "coupon_code_1",
+		"user_id_2": "coupon_code_2",
+		"user_id_3": "",
+		"user_id_4": "",
+	} {
+		_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: campaign.ID,
+			UserID:     userID,
+			CouponCode: couponCode,
+			WonDraw:    couponCode != "",
+		})
+		s.NoError(err)
+	}
+	// user_id_2 claims the coupon before the reallocation is applied, user_id_3 already saw it lost
+	for _, userID := range []string{"user_id_2", "user_id_3"} {
+		_, err = s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+			CampaignID: campaign.ID,
+			UserID:     userID,
+		})
+		s.NoError(err)
+	}
+
+	input := ReallocateCouponsInput{
+		CampaignID: campaign.ID,
+		Reallocations: []CouponReallocation{
+			{FromUserID: "user_id_1", ToUserID: "user_id_3", CouponCode: "coupon_code_1"},
+			{FromUserID: "user_id_2", ToUserID: "user_id_4", CouponCode: "coupon_code_2"},
+		},
+	}
+	res, err := s.repo.ReallocateCoupons(s.ctx, input)
+	s.NoError(err)
+	s.Equal(input.Reallocations[:1], res)
+
+	from, err := s.repo.GetCouponReservation(s.ctx, GetCouponReservationInput{CampaignID: campaign.ID, UserID: "user_id_1"})
+	s.NoError(err)
+	s.Empty(from.CouponCode)
+	s.NotZero(from.ReallocatedAt)
+
+	to, err := s.repo.GetCouponReservation(s.ctx, GetCouponReservationInput{CampaignID: campaign.ID, UserID: "user_id_3"})
+	s.NoError(err)
+	s.Equal("coupon_code_1", to.CouponCode)
+	s.Zero(to.ClaimedAt)
+	s.NotZero(to.ReallocatedAt)
+
+	skipped, err := s.repo.GetCouponReservation(s.ctx, GetCouponReservationInput{CampaignID: campaign.ID, UserID: "user_id_4"})
+	s.NoError(err)
+	s.Empty(skipped.CouponCode)
+
+	_, err = s.repo.ReallocateCoupons(s.ctx, input)
+	s.Equal(ErrAlreadyReallocated, err)
+
+	// 重跑時被收回的中獎者不能再拿到 coupon，抽籤結果也不變
+	_, err = s.repo.ReallocateCoupons(s.ctx, ReallocateCouponsInput{
+		CampaignID: campaign.ID,
+		Reallocations: []CouponReallocation{
+			{FromUserID: "user_id_3", ToUserID: "user_id_1", CouponCode: "coupon_code_1"},
+		},
+		Rerun: true,
+	})
+	s.Equal(ErrInvalidReallocation, err)
+	from, err = s.repo.GetCouponReservation(s.ctx, GetCouponReservationInput{CampaignID: campaign.ID, UserID: "user_id_1"})
+	s.NoError(err)
+	s.Empty(from.CouponCode)
+	s.True(from.WonDraw)
+	to, err = s.repo.GetCouponReservation(s.ctx, GetCouponReservationInput{CampaignID: campaign.ID, UserID: "user_id_3"})
+	s.NoError(err)
+	s.Equal("coupon_code_1", to.CouponCode)
+	s.False(to.WonDraw)
+}
+
+func (s *campaignRepositorySuite) TestListUserCouponReservations() {
+	for campaignID := uint(1); campaignID <= 3; campaignID++ {
+		_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: campaignID,
+			UserID:     "user_id_1",
+		})
+		s.NoError(err)
+	}
+	_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+		CampaignID: 3,
+		UserID:     "user_id_2",
+	})
+	s.NoError(err)
+
+	res, err := s.repo.ListUserCouponReservations(s.ctx, ListUserCouponReservationsInput{
+		UserID: "user_id_1",
+		Limit:  2,
+	})
+	s.NoError(err)
+	s.Len(res, 2)
+	s.Equal(uint(3), res[0].CampaignID)
+	s.Equal(uint(2), res[1].CampaignID)
+
+	res, err = s.repo.ListUserCouponReservations(s.ctx, ListUserCouponReservationsInput{
+		UserID: "user_id_1",
+		Cursor: 2,
+		Limit:  2,
+	})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal(uint(1), res[0].CampaignID)
+}
+
+func (s *campaignRepositorySuite) TestGetStats() {
+	for userID, couponCode := range map[string]string{
+		"user_id_1": "coupon_code_1",
+		"user_id_2": "coupon_code_2",
+		"user_id_3": "",
+	} {
+		_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: 1,
+			UserID:     userID,
+			CouponCode: couponCode,
+		})
+		s.NoError(err)
+	}
+	_, err := s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_1"})
+	s.NoError(err)
+	_, err = s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_3"})
+	s.NoError(err)
+	_, err = s.repo.RedeemCouponReservation(s.ctx, RedeemCouponReservationInput{CampaignID: 1, UserID: "user_id_1"})
+	s.NoError(err)
+
+	res, err := s.repo.GetStats(s.ctx, GetCampaignStatsInput{CampaignID: 1})
+	s.NoError(err)
+	s.Equal(int64(3), res.Reservations)
+	s.Equal(int64(2), res.Winners)
+	s.Equal(int64(1), res.Claimed)
+	s.Equal(int64(1), res.Redeemed)
+	s.NotEmpty(res.ReservationsPerMinute)
+
+	var total int64
+	for _, m := range res.ReservationsPerMinute {
+		s.Zero(m.Minute % 60)
+		total += m.Count
+	}
+	s.Equal(int64(3), total)
+}
+
+func (s *campaignRepositorySuite) TestRedeemCouponReservation() {
+	_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_1",
+		CouponCode: "coupon_code_1",
+	})
+	s.NoError(err)
+
+	input := RedeemCouponReservationInput{CampaignID: 1, UserID: "user_id_1"}
+	_, err = s.repo.RedeemCouponReservation(s.ctx, input)
+	s.Equal(ErrNotRedeemable, err)
+
+	_, err = s.repo.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{CampaignID: 1, UserID: "user_id_1"})
+	s.NoError(err)
+	res, err := s.repo.RedeemCouponReservation(s.ctx, input)
+	s.NoError(err)
+	s.NotZero(res.RedeemedAt)
+
+	_, err = s.repo.RedeemCouponReservation(s.ctx, input)
+	s.Equal(ErrNotRedeemable, err)
+}
+
+func (s *campaignRepositorySuite) TestGetWithNotFoundError() {
+	_, err := s.repo.Get(s.ctx, GetCampaignInput{ID: 1})
+	s.Equal(ErrCampaignNotFound, err)
+}
+
+func (s *campaignRepositorySuite) TestList() {
+	for i := 0; i < 3; i++ {
+		_, err := s.repo.Create(s.ctx, CreateCampaignInput{})
+		s.NoError(err)
+	}
+
+	res, err := s.repo.List(s.ctx, ListCampaignsInput{Limit: 2})
+	s.NoError(err)
+	s.Len(res, 2)
+	s.Equal(uint(3), res[0].ID)
+
+	res, err = s.repo.List(s.ctx, ListCampaignsInput{Cursor: 2, Limit: 2})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal(uint(1), res[0].ID)
+}
+
+func (s *campaignRepositorySuite) TestUpdate() {
+	campaign, err := s.repo.Create(s.ctx, CreateCampaignInput{
+		ReservationStartAt: 1000,
+		ReservationEndAt:   1100,
+		GrabStartAt:        1200,
+		GrabEndAt:          1300,
+	})
+	s.NoError(err)
+
+	input := UpdateCampaignInput{
+		ID:                  campaign.ID,
+		Now:                 500,
+		ReservationStartAt:  2000,
+		ReservationEndAt:    2100,
+		GrabStartAt:         2200,
+		GrabEndAt:           2300,
+		ReallocateUnclaimed: true,
+	}
+	res, err := s.repo.Update(s.ctx, input)
+	s.NoError(err)
+	s.Equal(int64(2000), res.ReservationStartAt)
+	s.Equal(int64(2300), res.GrabEndAt)
+	s.True(res.ReallocateUnclaimed)
+
+	input.Now = 2000
+	_, err = s.repo.Update(s.ctx, input)
+	s.Equal(ErrCampaignStarted, err)
+}
+
+func (s *campaignRepositorySuite) TestCancel() {
+	campaign1, err := s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+	campaign2, err := s.repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+
+	res, err := s.repo.Cancel(s.ctx, CancelCampaignInput{ID: campaign2.ID})
+	s.NoError(err)
+	s.NotZero(res.CancelledAt)
+
+	latest, err := s.repo.GetLatest(s.ctx, GetLatestCampaignInput{})
+	s.NoError(err)
+	s.Equal(campaign1.ID, latest.ID)
+
+	_, err = s.repo.Cancel(s.ctx, CancelCampaignInput{ID: 100})
+	s.Equal(ErrCampaignNotFound, err)
+}
+
+func (s *campaignRepositorySuite) TestCountOverlapping() {
+	campaign, err := s.repo.Create(s.ctx, CreateCampaignInput{
+		ReservationStartAt: 1000,
+		ReservationEndAt:   1100,
+		GrabStartAt:        1200,
+		GrabEndAt:          1300,
+	})
+	s.NoError(err)
+
+	n, err := s.repo.CountOverlapping(s.ctx, CountOverlappingCampaignsInput{Start: 1250, End: 1500})
+	s.NoError(err)
+	s.Equal(int64(1), n)
+
+	n, err = s.repo.CountOverlapping(s.ctx, CountOverlappingCampaignsInput{Start: 1300, End: 1500})
+	s.NoError(err)
+	s.Zero(n)
+
+	n, err = s.repo.CountOverlapping(s.ctx, CountOverlappingCampaignsInput{ExcludeID: campaign.ID, Start: 1000, End: 1300})
+	s.NoError(err)
+	s.Zero(n)
+}
+
+func (s *campaignRepositorySuite) TestScanCouponReservations() {
+	for userID, couponCode := range map[string]string{
+		"user_id_1": "coupon_code_1",
+		"user_id_2": "",
+		"user_id_3": "coupon_code_3",
+	} {
+		_, err := s.repo.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: 1,
+			UserID:     userID,
+			CouponCode: couponCode,
+		})
+		s.NoError(err)
+	}
+
+	var userIDs []string
+	err := s.repo.ScanCouponReservations(s.ctx, ScanCouponReservationsInput{CampaignID: 1, WinnersOnly: true}, func(r *CouponReservation) error {
+		userIDs = append(userIDs, r.UserID)
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]string{"user_id_1", "user_id_3"}, userIDs)
+
+	n := 0
+	err = s.repo.ScanCouponReservations(s.ctx, ScanCouponReservationsInput{CampaignID: 1}, func(r *CouponReservation) error {
+		n++
+		return nil
+	})
+	s.NoError(err)
+	s.Equal(3, n)
+}
+
+func (s *campaignRepositorySuite) TestListAuditLogs() {
+	for _, input := range []CreateAuditLogInput{
+		{CampaignID: 1, Actor: "admin:alice", Action: "campaign.create", After: `{"id":1}`, RequestID: "request_id_1"},
+		{CampaignID: 1, UserID: "user_id_1", Actor: "user:user_id_1", Action: "reservation.create", RequestID: "request_id_2"},
+		{CampaignID: 2, UserID: "user_id_1", Actor: "user:user_id_1", Action: "reservation.create", RequestID: "request_id_3"},
+	} {
+		_, err := s.repo.CreateAuditLog(s.ctx, input)
+		s.NoError(err)
+	}
+
+	res, err := s.repo.ListAuditLogs(s.ctx, ListAuditLogsInput{CampaignID: 1, Limit: 10})
+	s.NoError(err)
+	s.Len(res, 2)
+	s.Equal(uint(2), res[0].ID)
+	s.Equal("admin:alice", res[1].Actor)
+	s.Equal(`{"id":1}`, res[1].After)
+	s.NotZero(res[1].Created)
+
+	res, err = s.repo.ListAuditLogs(s.ctx, ListAuditLogsInput{UserID: "user_id_1", Cursor: 3, Limit: 10})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal("request_id_2", res[0].RequestID)
+}
+
+func (s *campaignRepositorySuite) TestPing() {
+	s.NoError(s.repo.Ping(s.ctx))
+}
+
+func (s *campaignRepositorySuite) TestCheckMigrations() {
+	s.NoError(s.repo.CheckMigrations(s.ctx))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.NoError(err)
+	repo := NewCampaignRepository(s.ctx, db, Config{})
+	s.ErrorIs(repo.CheckMigrations(s.ctx), ErrMigrationPending)
+
+	s.NoError(Migrate(db))
+	s.NoError(repo.CheckMigrations(s.ctx))
+}
+
+func (s *campaignRepositorySuite) TestMigrateBackfillsWonDraw() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.NoError(err)
+	s.NoError(Migrate(db))
+	// 舊的 reservation：沒領取被收回的中獎者、拿到重新分配 coupon 的用戶、中獎者和沒中獎的用戶
+	for _, r := range []CouponReservation{
+		{CampaignID: 1, UserID: "user_id_1", ReallocatedAt: 1},
+		{CampaignID: 1, UserID: "user_id_2", CouponCode: "coupon_code_1", ReallocatedAt: 1},
+		{CampaignID: 1, UserID: "user_id_3", CouponCode: "coupon_code_2"},
+		{CampaignID: 1, UserID: "user_id_4"},
+	} {
+		s.NoError(db.Create(&r).Error)
+	}
+	s.NoError(db.Migrator().DropColumn(&CouponReservation{}, "won_draw"))
+
+	s.NoError(Migrate(db))
+	var won []string
+	s.NoError(db.Model(&CouponReservation{}).Where("won_draw = ?", true).Order("user_id").Pluck("user_id", &won).Error)
+	s.Equal([]string{"user_id_1", "user_id_3"}, won)
+}
+
+func (s *campaignRepositorySuite) TestCancelledContext() {
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.repo.Get(s.ctx.WithContext(parent), GetCampaignInput{ID: 1})
+	s.ErrorIs(err, context.Canceled)
+}
+
+func (s *campaignRepositorySuite) TestMetricsPlugin() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.NoError(err)
+	s.NoError(db.Use(MetricsPlugin{}))
+	repo := NewCampaignRepository(s.ctx, db, Config{AutoMigrate: true})
+
+	created := dbQueryDuration.WithLabelValues("create", "campaigns").Count()
+	queried := dbQueryDuration.WithLabelValues("query", "campaigns").Count()
+
+	campaign, err := repo.Create(s.ctx, CreateCampaignInput{})
+	s.NoError(err)
+	_, err = repo.Get(s.ctx, GetCampaignInput{ID: campaign.ID})
+	s.NoError(err)
+
+	s.Equal(created+1, dbQueryDuration.WithLabelValues("create", "campaigns").Count())
+	s.Equal(queried+1, dbQueryDuration.WithLabelValues("query", "campaigns").Count())
+}
+
+func (s *campaignRepositorySuite) TestTracingPlugin() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.NoError(err)
+	s.NoError(db.Use(TracingPlugin{}))
+	repo := NewCampaignRepository(s.ctx, db, Config{AutoMigrate: true})
+
+	exporter := tracetest.NewInMemoryExporter()
+	defer ctx.SetSpanExporter(exporter)()
+
+	c, root := s.ctx.StartSpan("root")
+	_, err = repo.CreateCouponReservation(c, CreateCouponReservationInput{CampaignID: 1, UserID: "user_id_1"})
+	s.NoError(err)
+	root.End()
+
+	// db span -> repository span -> root span
+	spans := exporter.GetSpans()
+	s.Len(spans, 3)
+	query, method := spans[0], spans[1]
+	s.Equal("db.create", query.Name)
+	s.Equal(method.SpanContext.SpanID(), query.Parent.SpanID())
+	s.Contains(query.Attributes, attribute.String("db.table", "coupon_reservations"))
+	s.Contains(query.Attributes, attribute.Int64("db.rows_affected", 1))
+	s.Equal("campaignRepository.CreateCouponReservation", method.Name)
+	s.Equal(root.SpanID(), method.Parent.SpanID())
+	s.Contains(method.Attributes, attribute.Int64("campaign_id", 1))
+	s.Contains(method.Attributes, attribute.String("user_id", "user_id_1"))
+}
+
 func TestCampaignRepositorySuite(t *testing.T) {
 	suite.Run(t, new(campaignRepositorySuite))
 }
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/idempotency"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// idempotencyMaxAttempts is the number of times a key released by another replica is begun again
+	idempotencyMaxAttempts = 3
+	// idempotencySweepInterval deletes the expired keys every interval
+	idempotencySweepInterval = time.Minute
+)
+
+var (
+	errIdempotencyKeyContended = errors.New("idempotency key contended")
+)
+
+// IdempotencyKey is the request sent with an Idempotency-Key and its response, shared by the replicas.
+// The key is hashed since it contains user ids, ExpiresAt is in unix nanoseconds.
+type IdempotencyKey struct {
+	KeyHash     string `gorm:"primaryKey"`
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   int64 `gorm:"index"`
+}
+
+type idempotencyStore struct {
+	db *gorm.DB
+	// swept is when the expired keys were deleted in unix nanoseconds
+	swept atomic.Int64
+}
+
+// NewIdempotencyStore keeps the idempotency keys in the database, so a request retried
+// on another replica gets the same response. The table is migrated by Migrate and only here if cfg.AutoMigrate is set.
+func NewIdempotencyStore(c ctx.CTX, db *gorm.DB, cfg Config) (idempotency.Store, error) {
+	if cfg.AutoMigrate {
+		if err := db.AutoMigrate(IdempotencyKey{}); err != nil {
+			return nil, err
+		}
+	}
+	s := &idempotencyStore{
+		db: db,
+	}
+	s.swept.Store(time.Now().UnixNano())
+	return s, nil
+}
+
+func (r *idempotencyStore) Begin(c ctx.CTX, key string, rec idempotency.Record) (idempotency.Record, bool, error) {
+	keyHash := hashKey(key)
+	now := time.Now()
+	r.sweep(c, now)
+
+	for attempt := 0; attempt < idempotencyMaxAttempts; attempt++ {
+		// 過期的 key 可以再使用
+		if err := r.db.WithContext(c).Where("key_hash = ? AND expires_at <= ?", keyHash, now.UnixNano()).
+			Delete(&IdempotencyKey{}).Error; err != nil {
+			c.Errorw("begin idempotency key failed", ctx.Err(err))
+			return idempotency.Record{}, false, err
+		}
+
+		result := r.db.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&IdempotencyKey{
+			KeyHash:     keyHash,
+			Fingerprint: rec.Fingerprint,
+			ExpiresAt:   rec.ExpiresAt.UnixNano(),
+		})
+		if err := result.Error; err != nil {
+			c.Errorw("begin idempotency key failed", ctx.Err(err))
+			return idempotency.Record{}, false, err
+		}
+		if result.RowsAffected == 1 {
+			return rec, true, nil
+		}
+
+		var saved IdempotencyKey
+		err := r.db.WithContext(c).Where("key_hash = ?", keyHash).Take(&saved).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 其他 replica 剛好釋放了這個 key，重新開始
+			continue
+		} else if err != nil {
+			c.Errorw("begin idempotency key failed", ctx.Err(err))
+			return idempotency.Record{}, false, err
+		}
+		return idempotency.Record{
+			Fingerprint: saved.Fingerprint,
+			Status:      saved.Status,
+			ContentType: saved.ContentType,
+			Body:        saved.Body,
+			ExpiresAt:   time.Unix(0, saved.ExpiresAt),
+		}, false, nil
+	}
+
+	c.Warnw("idempotency key contended", "attempts", idempotencyMaxAttempts)
+	return idempotency.Record{}, false, errIdempotencyKeyContended
+}
+
+func (r *idempotencyStore) Complete(c ctx.CTX, key string, rec idempotency.Record) error {
+	// 只更新自己開始的請求
+	err := r.db.WithContext(c).Model(&IdempotencyKey{}).
+		Where("key_hash = ? AND fingerprint = ?", hashKey(key), rec.Fingerprint).
+		Updates(map[string]any{
+			"status":       rec.Status,
+			"content_type": rec.ContentType,
+			"body":         rec.Body,
+		}).Error
+	if err != nil {
+		c.Errorw("complete idempotency key failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (r *idempotencyStore) Release(c ctx.CTX, key string) error {
+	err := r.db.WithContext(c).Where("key_hash = ? AND status = 0", hashKey(key)).
+		Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		c.Errorw("release idempotency key failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
+
+// sweep deletes the expired keys at most once every idempotencySweepInterval per replica
+func (r *idempotencyStore) sweep(c ctx.CTX, now time.Time) {
+	swept := r.swept.Load()
+	if now.UnixNano()-swept < int64(idempotencySweepInterval) || !r.swept.CompareAndSwap(swept, now.UnixNano()) {
+		return
+	}
+	result := r.db.WithContext(c).Where("expires_at <= ?", now.UnixNano()).Delete(&IdempotencyKey{})
+	if err := result.Error; err != nil {
+		c.Errorw("sweep idempotency keys failed", ctx.Err(err))
+		return
+	}
+	if result.RowsAffected != 0 {
+		c.Infow("expired idempotency keys deleted", "rows", result.RowsAffected)
+	}
+}
+
+// hashKey hides the user ids and client IPs in the keys of the shared stores
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/idempotency"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type idempotencyStoreSuite struct {
+	suite.Suite
+	ctx ctx.CTX
+	db  *gorm.DB
+}
+
+func (s *idempotencyStoreSuite) SetupSuite() {
+	s.ctx = ctx.Background()
+	var err error
+	s.db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+	if err := Migrate(s.db); err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *idempotencyStoreSuite) TearDownSuite() {
+	db, err := s.db.DB()
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *idempotencyStoreSuite) TestBegin() {
+	// 兩個 store 模擬兩個 replica，共用同一個 key
+	store1, err := NewIdempotencyStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	store2, err := NewIdempotencyStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	r := idempotency.Record{Fingerprint: "a", ExpiresAt: time.Now().Add(time.Hour)}
+
+	_, ok, err := store1.Begin(s.ctx, "user:user_id_1:key", r)
+	s.NoError(err)
+	s.True(ok)
+	saved, ok, err := store2.Begin(s.ctx, "user:user_id_1:key", idempotency.Record{Fingerprint: "b", ExpiresAt: r.ExpiresAt})
+	s.NoError(err)
+	s.False(ok)
+	s.Equal("a", saved.Fingerprint)
+	s.False(saved.Done())
+
+	r.Status, r.ContentType, r.Body = 200, "application/json", []byte(`{"coupon_code":"code"}`)
+	s.NoError(store1.Complete(s.ctx, "user:user_id_1:key", r))
+	// 已經完成的請求不會被釋放
+	s.NoError(store2.Release(s.ctx, "user:user_id_1:key"))
+	saved, ok, err = store2.Begin(s.ctx, "user:user_id_1:key", r)
+	s.NoError(err)
+	s.False(ok)
+	s.Equal(200, saved.Status)
+	s.Equal("application/json", saved.ContentType)
+	s.Equal(r.Body, saved.Body)
+
+	// 釋放的 key 可以再使用
+	_, ok, err = store1.Begin(s.ctx, "user:user_id_2:key", r)
+	s.NoError(err)
+	s.True(ok)
+	s.NoError(store1.Release(s.ctx, "user:user_id_2:key"))
+	_, ok, err = store2.Begin(s.ctx, "user:user_id_2:key", r)
+	s.NoError(err)
+	s.True(ok)
+
+	// key 以 hash 儲存
+	var n int64
+	s.NoError(s.db.Model(&IdempotencyKey{}).Where("key_hash LIKE ?", "%user_id%").Count(&n).Error)
+	s.Zero(n)
+}
+
+func (s *idempotencyStoreSuite) TestBeginWithExpiredKey() {
+	store, err := NewIdempotencyStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	expired := idempotency.Record{Fingerprint: "a", Status: 200, ExpiresAt: time.Now().Add(-time.Second)}
+
+	_, ok, err := store.Begin(s.ctx, "user:user_id_3:key", expired)
+	s.NoError(err)
+	s.True(ok)
+	_, ok, err = store.Begin(s.ctx, "user:user_id_3:key", idempotency.Record{Fingerprint: "b", ExpiresAt: time.Now().Add(time.Hour)})
+	s.NoError(err)
+	s.True(ok)
+
+	// 過期的 key 定期被刪除
+	_, ok, err = store.Begin(s.ctx, "user:user_id_4:key", expired)
+	s.NoError(err)
+	s.True(ok)
+	store.(*idempotencyStore).swept.Store(0)
+	_, _, err = store.Begin(s.ctx, "user:user_id_5:key", idempotency.Record{ExpiresAt: time.Now().Add(time.Hour)})
+	s.NoError(err)
+	var n int64
+	s.NoError(s.db.Model(&IdempotencyKey{}).Where("expires_at <= ?", time.Now().UnixNano()).Count(&n).Error)
+	s.Zero(n)
+}
+
+func TestIdempotencyStoreSuite(t *testing.T) {
+	suite.Run(t, new(idempotencyStoreSuite))
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lease is held by Holder until ExpiresAt in unix timestamp,
+// another holder can acquire it after it expires.
+type Lease struct {
+	Name      string `gorm:"primaryKey"`
+	Holder    string
+	ExpiresAt int64
+	Updated   int64 `gorm:"autoUpdateTime"`
+}
+
+// AcquireLeaseInput acquires or renews the lease Name for Holder until ExpiresAt,
+// Now decides whether the lease held by another holder has expired.
+type AcquireLeaseInput struct {
+	Name      string
+	Holder    string
+	Now       int64
+	ExpiresAt int64
+}
+
+type ReleaseLeaseInput struct {
+	Name   string
+	Holder string
+}
+
+type LeaseRepository interface {
+	// AcquireLease reports whether Holder holds the lease after the call
+	AcquireLease(c ctx.CTX, p AcquireLeaseInput) (bool, error)
+	// ReleaseLease expires the lease if it's held by Holder, so another holder can take over immediately
+	ReleaseLease(c ctx.CTX, p ReleaseLeaseInput) error
+}
+
+type leaseRepository struct {
+	db *gorm.DB
+}
+
+// NewLeaseRepository keeps the leases in the database, the table is migrated by Migrate
+// and only here if cfg.AutoMigrate is set.
+func NewLeaseRepository(c ctx.CTX, db *gorm.DB, cfg Config) (LeaseRepository, error) {
+	if cfg.AutoMigrate {
+		if err := db.AutoMigrate(Lease{}); err != nil {
+			return nil, err
+		}
+	}
+	return leaseRepository{
+		db: db,
+	}, nil
+}
+
+func (r leaseRepository) AcquireLease(c ctx.CTX, p AcquireLeaseInput) (bool, error) {
+	c, span := c.StartSpan("leaseRepository.AcquireLease", "lease", p.Name, "holder", p.Holder)
+	defer span.End()
+
+	lease := Lease{
+		Name:      p.Name,
+		Holder:    p.Holder,
+		ExpiresAt: p.ExpiresAt,
+	}
+	result := r.db.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if err := result.Error; err != nil {
+		c.Errorw("acquire lease failed", ctx.Err(err))
+		return false, err
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	// 已經有 lease 時，只有自己持有或已經過期才能續約或接手
+	result = r.db.WithContext(c).Model(&Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at <= ?)", p.Name, p.Holder, p.Now).
+		Updates(map[string]any{
+			"holder":     p.Holder,
+			"expires_at": p.ExpiresAt,
+		})
+	if err := result.Error; err != nil {
+		c.Errorw("acquire lease failed", ctx.Err(err))
+		return false, err
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r leaseRepository) ReleaseLease(c ctx.CTX, p ReleaseLeaseInput) error {
+	c, span := c.StartSpan("leaseRepository.ReleaseLease", "lease", p.Name, "holder", p.Holder)
+	defer span.End()
+
+	if err := r.db.WithContext(c).Model(&Lease{}).
+		Where("name = ? AND holder = ?", p.Name, p.Holder).
+		Update("expires_at", 0).Error; err != nil {
+		c.Errorw("release lease failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
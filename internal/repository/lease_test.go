@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type leaseRepositorySuite struct {
+	suite.Suite
+	ctx  ctx.CTX
+	db   *gorm.DB
+	repo LeaseRepository
+}
+
+func (s *leaseRepositorySuite) SetupSuite() {
+	s.ctx = ctx.Background()
+	var err error
+	s.db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+
+	s.repo, err = NewLeaseRepository(s.ctx, s.db, Config{AutoMigrate: true})
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *leaseRepositorySuite) TearDownSuite() {
+	db, err := s.db.DB()
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *leaseRepositorySuite) SetupTest() {
+	// Clear the leases table before each test
+	if err := s.db.Exec("DELETE FROM leases").Error; err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *leaseRepositorySuite) TestAcquireLease() {
+	ok, err := s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_1", Now: 100, ExpiresAt: 115})
+	s.NoError(err)
+	s.True(ok)
+
+	// 還沒過期，其他 holder 拿不到
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_2", Now: 105, ExpiresAt: 120})
+	s.NoError(err)
+	s.False(ok)
+
+	// 自己可以續約
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_1", Now: 110, ExpiresAt: 125})
+	s.NoError(err)
+	s.True(ok)
+
+	// 過期之後其他 holder 可以接手
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_2", Now: 125, ExpiresAt: 140})
+	s.NoError(err)
+	s.True(ok)
+
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_1", Now: 126, ExpiresAt: 141})
+	s.NoError(err)
+	s.False(ok)
+}
+
+func (s *leaseRepositorySuite) TestReleaseLease() {
+	ok, err := s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_1", Now: 100, ExpiresAt: 115})
+	s.NoError(err)
+	s.True(ok)
+
+	// 只有持有者可以釋放
+	s.NoError(s.repo.ReleaseLease(s.ctx, ReleaseLeaseInput{Name: "scheduler", Holder: "holder_2"}))
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_2", Now: 101, ExpiresAt: 116})
+	s.NoError(err)
+	s.False(ok)
+
+	s.NoError(s.repo.ReleaseLease(s.ctx, ReleaseLeaseInput{Name: "scheduler", Holder: "holder_1"}))
+	ok, err = s.repo.AcquireLease(s.ctx, AcquireLeaseInput{Name: "scheduler", Holder: "holder_2", Now: 101, ExpiresAt: 116})
+	s.NoError(err)
+	s.True(ok)
+}
+
+func TestLeaseRepositorySuite(t *testing.T) {
+	suite.Run(t, new(leaseRepositorySuite))
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// redacted replaces the values of redactedColumns in the logged SQL
+const redacted = "<redacted>"
+
+// redactedColumns may hold user ids or coupon codes, before and after of the audit logs
+// are JSON snapshots which may contain user ids. The seed of a campaign is secret until it's revealed,
+// and the body of an idempotent response may contain coupon codes.
+var redactedColumns = map[string]bool{
+	"user_id":     true,
+	"coupon_code": true,
+	"before":      true,
+	"after":       true,
+	"seed":        true,
+	"body":        true,
+}
+
+var (
+	insertColumnsRe = regexp.MustCompile("(?i)^\\s*INSERT\\s+INTO\\s+\\S+\\s*\\(([^)]*)\\)\\s*VALUES")
+	// the end of the VALUES of an INSERT
+	insertValuesEndRe = regexp.MustCompile("(?i)\\s(ON\\s+CONFLICT|RETURNING)\\s")
+	// a placeholder compared with a column, e.g. `user_id` = ? or user_id IN (?,?
+	placeholderColumnRe = regexp.MustCompile("(?i)`?(\\w+)`?\\s*(?:=|<>|!=|<=|>=|<|>|LIKE|IN\\s*\\((?:\\s*\\?\\s*,)*)\\s*$")
+)
+
+// LoggerConfig configures the gorm logger adapter
+type LoggerConfig struct {
+	// LogLevel is the gorm log level, Info logs every query at debug level
+	LogLevel gormlogger.LogLevel
+	// SlowThreshold logs and counts the slower queries, 0 disables it
+	SlowThreshold time.Duration
+}
+
+// queryLogger is a gorm logger writing through the ctx.CTX of the query,
+// so the logs carry the request id and trace of the request.
+type queryLogger struct {
+	cfg LoggerConfig
+}
+
+// NewLogger returns a gorm logger adapter, set it as gorm.Config.Logger
+func NewLogger(cfg LoggerConfig) gormlogger.Interface {
+	return queryLogger{cfg: cfg}
+}
+
+func (l queryLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	l.cfg.LogLevel = level
+	return l
+}
+
+func (l queryLogger) Info(c context.Context, msg string, data ...any) {
+	if l.cfg.LogLevel >= gormlogger.Info {
+		toCTX(c).Info(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l queryLogger) Warn(c context.Context, msg string, data ...any) {
+	if l.cfg.LogLevel >= gormlogger.Warn {
+		toCTX(c).Warn(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l queryLogger) Error(c context.Context, msg string, data ...any) {
+	if l.cfg.LogLevel >= gormlogger.Error {
+		toCTX(c).Error(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l queryLogger) Trace(c context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	slow := l.cfg.SlowThreshold > 0 && elapsed > l.cfg.SlowThreshold
+	if slow {
+		slowQueries.WithLabelValues(repositoryMethod(c)).Inc()
+	}
+
+	switch {
+	case l.cfg.LogLevel <= gormlogger.Silent:
+	case err != nil && l.cfg.LogLevel >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		// 錯誤會由 repository 記錄成 error，這裡只補上 SQL
+		sql, rows := fc()
+		toCTX(c).Warnw("query failed", "sql", sql, "rows", rows, "elapsed", elapsed, ctx.Err(err))
+	case slow && l.cfg.LogLevel >= gormlogger.Warn:
+		sql, rows := fc()
+		toCTX(c).Warnw("slow query", "sql", sql, "rows", rows, "elapsed", elapsed,
+			"threshold", l.cfg.SlowThreshold, "method", repositoryMethod(c))
+	case l.cfg.LogLevel >= gormlogger.Info:
+		sql, rows := fc()
+		toCTX(c).Debugw("query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
+
+// ParamsFilter implements gorm.ParamsFilter, it redacts the values of redactedColumns
+// before they are written into the logged SQL.
+func (l queryLogger) ParamsFilter(c context.Context, sql string, params ...any) (string, []any) {
+	columns := placeholderColumns(sql)
+	res := make([]any, len(params))
+	for i, param := range params {
+		if i < len(columns) && redactedColumns[columns[i]] {
+			param = redacted
+		}
+		res[i] = param
+	}
+	return sql, res
+}
+
+// placeholderColumns returns the column of each ? in sql, empty if unknown
+func placeholderColumns(sql string) []string {
+	// INSERT 的 VALUES 依序對應欄位，多筆時重複
+	var insertColumns []string
+	valuesStart, valuesEnd := len(sql), len(sql)
+	if m := insertColumnsRe.FindStringSubmatchIndex(sql); m != nil {
+		for _, column := range strings.Split(sql[m[2]:m[3]], ",") {
+			insertColumns = append(insertColumns, strings.ToLower(strings.Trim(strings.TrimSpace(column), "`\"")))
+		}
+		valuesStart = m[1]
+		if end := insertValuesEndRe.FindStringIndex(sql[valuesStart:]); end != nil {
+			valuesEnd = valuesStart + end[0]
+		}
+	}
+
+	var res []string
+	values := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			continue
+		}
+		if i > valuesStart && i < valuesEnd {
+			res = append(res, insertColumns[values%len(insertColumns)])
+			values++
+			continue
+		}
+		column := ""
+		if m := placeholderColumnRe.FindStringSubmatch(sql[:i]); m != nil {
+			column = strings.ToLower(m[1])
+		}
+		res = append(res, column)
+	}
+	return res
+}
+
+// repositoryMethod is the name of the repository method running the query,
+// taken from the span started by the method.
+func repositoryMethod(c context.Context) string {
+	if span := ctx.SpanFromContext(c); span != nil {
+		return span.Name()
+	}
+	return "unknown"
+}
+
+func toCTX(c context.Context) ctx.CTX {
+	if reqCTX, ok := c.(ctx.CTX); ok {
+		return reqCTX
+	}
+	return ctx.Background().WithContext(c)
+}
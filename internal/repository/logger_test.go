@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// observedCTX returns a CTX recording its logs at or above level
+func observedCTX(level zapcore.Level) (ctx.CTX, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	return ctx.CTX{
+		Context: ctx.Background().Context,
+		Logger:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+	}, logs
+}
+
+func (s *campaignRepositorySuite) TestPlaceholderColumns() {
+	for sql, expected := range map[string][]string{
+		"INSERT INTO `coupon_reservations` (`campaign_id`,`user_id`,`coupon_code`) VALUES (?,?,?),(?,?,?) ON CONFLICT DO NOTHING": {
+			"campaign_id", "user_id", "coupon_code", "campaign_id", "user_id", "coupon_code",
+		},
+		"SELECT * FROM `coupon_reservations` WHERE campaign_id = ? AND user_id IN (?,?) AND `coupon_code` <> ? LIMIT 1": {
+			"campaign_id", "user_id", "user_id", "coupon_code",
+		},
+		"UPDATE `coupon_reservations` SET `user_id`=?,`claimed_at`=? WHERE campaign_id = ? AND user_id = ?": {
+			"user_id", "claimed_at", "campaign_id", "user_id",
+		},
+	} {
+		s.Equal(expected, placeholderColumns(sql), sql)
+	}
+}
+
+func (s *campaignRepositorySuite) TestQueryLogger() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: NewLogger(LoggerConfig{LogLevel: gormlogger.Info, SlowThreshold: time.Nanosecond}),
+	})
+	s.NoError(err)
+	repo := NewCampaignRepository(s.ctx, db, Config{AutoMigrate: true})
+
+	c, logs := observedCTX(zapcore.DebugLevel)
+	c = c.WithRequestID("request_id")
+	method := "campaignRepository.CreateCouponReservation"
+	slow := slowQueries.WithLabelValues(method).Value()
+
+	_, err = repo.CreateCouponReservation(c, CreateCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "secret_user_id",
+		CouponCode: "secret_coupon_code",
+	})
+	s.NoError(err)
+	_, err = repo.GetCouponReservation(c, GetCouponReservationInput{CampaignID: 1, UserID: "secret_user_id"})
+	s.NoError(err)
+
+	// 每個查詢都比 1ns 慢，記錄成 slow query 並計數
+	s.Equal(slow+1, slowQueries.WithLabelValues(method).Value())
+	entries := logs.FilterMessage("slow query").All()
+	s.Len(entries, 2)
+	for _, entry := range entries {
+		fields := entry.ContextMap()
+		sql := fields["sql"].(string)
+		s.Equal("request_id", fields["request_id"])
+		s.Contains(sql, redacted)
+		s.False(strings.Contains(sql, "secret"), sql)
+	}
+	s.Equal(method, entries[0].ContextMap()["method"])
+	s.Contains(entries[0].ContextMap()["sql"], "INSERT INTO `coupon_reservations`")
+}
+
+func (s *campaignRepositorySuite) TestQueryLoggerWithSeed() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: NewLogger(LoggerConfig{LogLevel: gormlogger.Info, SlowThreshold: time.Nanosecond}),
+	})
+	s.NoError(err)
+	repo := NewCampaignRepository(s.ctx, db, Config{AutoMigrate: true})
+
+	c, logs := observedCTX(zapcore.DebugLevel)
+	seed := lottery.Seed("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	campaign, err := repo.Create(c, CreateCampaignInput{Seed: seed})
+	s.NoError(err)
+	campaign, err = repo.Get(c, GetCampaignInput{ID: campaign.ID})
+	s.NoError(err)
+	s.Equal(seed, campaign.Seed)
+
+	// seed 不會出現在任何 log 中
+	s.NotEmpty(logs.All())
+	for _, entry := range logs.All() {
+		for _, v := range entry.ContextMap() {
+			s.NotContains(fmt.Sprint(v), string(seed))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+var (
+	dbQueryDuration = metrics.NewHistogramVec("db_query_duration_seconds",
+		"Database query latencies by operation and table.", nil, "operation", "table")
+	slowQueries = metrics.NewCounterVec("db_slow_queries_total",
+		"Number of queries slower than the slow query threshold by repository method.", "method")
+)
+
+const metricsStartKey = "metrics:start"
+
+// MetricsPlugin is a gorm plugin recording the latency of every query, register it with db.Use
+type MetricsPlugin struct{}
+
+func (MetricsPlugin) Name() string {
+	return "metrics"
+}
+
+func (MetricsPlugin) Initialize(db *gorm.DB) error {
+	type register func(name string, fn func(*gorm.DB)) error
+
+	cb := db.Callback()
+	for _, p := range []struct {
+		operation     string
+		before, after register
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := p.before("metrics:before_"+p.operation, beforeQuery); err != nil {
+			return err
+		}
+		if err := p.after("metrics:after_"+p.operation, afterQuery(p.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func beforeQuery(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func afterQuery(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		dbQueryDuration.WithLabelValues(operation, db.Statement.Table).Observe(time.Since(start).Seconds())
+	}
+}
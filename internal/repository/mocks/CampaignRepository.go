@@ -14,6 +14,112 @@ type CampaignRepository struct {
 	mock.Mock
 }
 
+// Cancel provides a mock function with given fields: c, p
+func (_m *CampaignRepository) Cancel(c ctx.CTX, p repository.CancelCampaignInput) (*repository.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Cancel")
+	}
+
+	var r0 *repository.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CancelCampaignInput) (*repository.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CancelCampaignInput) *repository.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.CancelCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CheckMigrations provides a mock function with given fields: c
+func (_m *CampaignRepository) CheckMigrations(c ctx.CTX) error {
+	ret := _m.Called(c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CheckMigrations")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX) error); ok {
+		r0 = rf(c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimCouponReservation provides a mock function with given fields: c, p
+func (_m *CampaignRepository) ClaimCouponReservation(c ctx.CTX, p repository.ClaimCouponReservationInput) (*repository.CouponClaim, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ClaimCouponReservation")
+	}
+
+	var r0 *repository.CouponClaim
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ClaimCouponReservationInput) (*repository.CouponClaim, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ClaimCouponReservationInput) *repository.CouponClaim); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.CouponClaim)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ClaimCouponReservationInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountOverlapping provides a mock function with given fields: c, p
+func (_m *CampaignRepository) CountOverlapping(c ctx.CTX, p repository.CountOverlappingCampaignsInput) (int64, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountOverlapping")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CountOverlappingCampaignsInput) (int64, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CountOverlappingCampaignsInput) int64); ok {
+		r0 = rf(c, p)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.CountOverlappingCampaignsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Create provides a mock function with given fields: c, p
 func (_m *CampaignRepository) Create(c ctx.CTX, p repository.CreateCampaignInput) (*repository.Campaign, error) {
 	ret := _m.Called(c, p)
@@ -44,6 +150,36 @@ func (_m *CampaignRepository) Create(c ctx.CTX, p repository.CreateCampaignInput
 	return r0, r1
 }
 
+// CreateAuditLog provides a mock function with given fields: c, p
+func (_m *CampaignRepository) CreateAuditLog(c ctx.CTX, p repository.CreateAuditLogInput) (*repository.AuditLog, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateAuditLog")
+	}
+
+	var r0 *repository.AuditLog
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CreateAuditLogInput) (*repository.AuditLog, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.CreateAuditLogInput) *repository.AuditLog); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.AuditLog)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.CreateAuditLogInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateCouponReservation provides a mock function with given fields: c, p
 func (_m *CampaignRepository) CreateCouponReservation(c ctx.CTX, p repository.CreateCouponReservationInput) (*repository.CouponReservation, error) {
 	ret := _m.Called(c, p)
@@ -74,6 +210,66 @@ func (_m *CampaignRepository) CreateCouponReservation(c ctx.CTX, p repository.Cr
 	return r0, r1
 }
 
+// Get provides a mock function with given fields: c, p
+func (_m *CampaignRepository) Get(c ctx.CTX, p repository.GetCampaignInput) (*repository.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Get")
+	}
+
+	var r0 *repository.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignInput) (*repository.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignInput) *repository.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.GetCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByScheduleKey provides a mock function with given fields: c, p
+func (_m *CampaignRepository) GetByScheduleKey(c ctx.CTX, p repository.GetCampaignByScheduleKeyInput) (*repository.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetByScheduleKey")
+	}
+
+	var r0 *repository.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignByScheduleKeyInput) (*repository.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignByScheduleKeyInput) *repository.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.GetCampaignByScheduleKeyInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCouponReservation provides a mock function with given fields: c, p
 func (_m *CampaignRepository) GetCouponReservation(c ctx.CTX, p repository.GetCouponReservationInput) (*repository.CouponReservation, error) {
 	ret := _m.Called(c, p)
@@ -134,6 +330,282 @@ func (_m *CampaignRepository) GetLatest(c ctx.CTX, p repository.GetLatestCampaig
 	return r0, r1
 }
 
+// GetStats provides a mock function with given fields: c, p
+func (_m *CampaignRepository) GetStats(c ctx.CTX, p repository.GetCampaignStatsInput) (*repository.CampaignStats, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetStats")
+	}
+
+	var r0 *repository.CampaignStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignStatsInput) (*repository.CampaignStats, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.GetCampaignStatsInput) *repository.CampaignStats); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.CampaignStats)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.GetCampaignStatsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// List provides a mock function with given fields: c, p
+func (_m *CampaignRepository) List(c ctx.CTX, p repository.ListCampaignsInput) ([]repository.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 []repository.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListCampaignsInput) ([]repository.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListCampaignsInput) []repository.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repository.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ListCampaignsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditLogs provides a mock function with given fields: c, p
+func (_m *CampaignRepository) ListAuditLogs(c ctx.CTX, p repository.ListAuditLogsInput) ([]repository.AuditLog, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditLogs")
+	}
+
+	var r0 []repository.AuditLog
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListAuditLogsInput) ([]repository.AuditLog, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListAuditLogsInput) []repository.AuditLog); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repository.AuditLog)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ListAuditLogsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCouponReservations provides a mock function with given fields: c, p
+func (_m *CampaignRepository) ListCouponReservations(c ctx.CTX, p repository.ListCouponReservationsInput) ([]repository.CouponReservation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListCouponReservations")
+	}
+
+	var r0 []repository.CouponReservation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListCouponReservationsInput) ([]repository.CouponReservation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListCouponReservationsInput) []repository.CouponReservation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repository.CouponReservation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ListCouponReservationsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUserCouponReservations provides a mock function with given fields: c, p
+func (_m *CampaignRepository) ListUserCouponReservations(c ctx.CTX, p repository.ListUserCouponReservationsInput) ([]repository.CouponReservation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListUserCouponReservations")
+	}
+
+	var r0 []repository.CouponReservation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListUserCouponReservationsInput) ([]repository.CouponReservation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ListUserCouponReservationsInput) []repository.CouponReservation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repository.CouponReservation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ListUserCouponReservationsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: c
+func (_m *CampaignRepository) Ping(c ctx.CTX) error {
+	ret := _m.Called(c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX) error); ok {
+		r0 = rf(c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReallocateCoupons provides a mock function with given fields: c, p
+func (_m *CampaignRepository) ReallocateCoupons(c ctx.CTX, p repository.ReallocateCouponsInput) ([]repository.CouponReallocation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReallocateCoupons")
+	}
+
+	var r0 []repository.CouponReallocation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ReallocateCouponsInput) ([]repository.CouponReallocation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ReallocateCouponsInput) []repository.CouponReallocation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repository.CouponReallocation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.ReallocateCouponsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RedeemCouponReservation provides a mock function with given fields: c, p
+func (_m *CampaignRepository) RedeemCouponReservation(c ctx.CTX, p repository.RedeemCouponReservationInput) (*repository.CouponReservation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RedeemCouponReservation")
+	}
+
+	var r0 *repository.CouponReservation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.RedeemCouponReservationInput) (*repository.CouponReservation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.RedeemCouponReservationInput) *repository.CouponReservation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.CouponReservation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.RedeemCouponReservationInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ScanCouponReservations provides a mock function with given fields: c, p, fn
+func (_m *CampaignRepository) ScanCouponReservations(c ctx.CTX, p repository.ScanCouponReservationsInput, fn func(*repository.CouponReservation) error) error {
+	ret := _m.Called(c, p, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ScanCouponReservations")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.ScanCouponReservationsInput, func(*repository.CouponReservation) error) error); ok {
+		r0 = rf(c, p, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Update provides a mock function with given fields: c, p
+func (_m *CampaignRepository) Update(c ctx.CTX, p repository.UpdateCampaignInput) (*repository.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Update")
+	}
+
+	var r0 *repository.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.UpdateCampaignInput) (*repository.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, repository.UpdateCampaignInput) *repository.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*repository.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, repository.UpdateCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewCampaignRepository creates a new instance of CampaignRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCampaignRepository(t interface {
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// rateLimitMaxAttempts is the number of times a bucket created or refilled by another replica is taken again
+	rateLimitMaxAttempts = 3
+	// rateLimitSweepInterval deletes the refilled buckets every interval
+	rateLimitSweepInterval = time.Minute
+	// takeRateLimitToken refills the bucket up to @now like ratelimit.Limit.Take and takes a token in one statement,
+	// the concurrent requests of a key can't take the same token.
+	takeRateLimitToken = `UPDATE rate_limit_buckets SET tokens = ` + refilledRateLimitTokens + ` - 1, updated = @now, expires_at = @expires_at
+WHERE key_hash = @key_hash AND ` + refilledRateLimitTokens + ` >= 1`
+	refilledRateLimitTokens = `(CASE WHEN updated >= @now THEN tokens
+WHEN tokens + (@now - updated) * 1.0 / @per_token >= @capacity THEN @capacity
+ELSE tokens + (@now - updated) * 1.0 / @per_token END)`
+)
+
+// RateLimitBucket is a token bucket shared by the replicas, Updated and ExpiresAt are in unix nanoseconds.
+// The key is hashed since it contains user ids and client IPs. The bucket is refilled at ExpiresAt,
+// so it can be deleted like one never taken from.
+type RateLimitBucket struct {
+	KeyHash   string `gorm:"primaryKey"`
+	Tokens    float64
+	Updated   int64
+	ExpiresAt int64 `gorm:"index"`
+}
+
+type rateLimitStore struct {
+	db *gorm.DB
+}
+
+// NewRateLimitStore keeps the rate limit buckets in the database, so every replica
+// takes tokens from the same buckets. The table is migrated by Migrate and only here if cfg.AutoMigrate is set.
+// The refilled buckets are deleted in the background every rateLimitSweepInterval until c is done.
+func NewRateLimitStore(c ctx.CTX, db *gorm.DB, cfg Config) (ratelimit.Store, error) {
+	if cfg.AutoMigrate {
+		if err := db.AutoMigrate(RateLimitBucket{}); err != nil {
+			return nil, err
+		}
+	}
+	s := &rateLimitStore{
+		db: db,
+	}
+	go s.run(c)
+	return s, nil
+}
+
+func (r *rateLimitStore) Take(c ctx.CTX, key string, l ratelimit.Limit) (bool, time.Duration, error) {
+	keyHash := hashKey(key)
+
+	for attempt := 0; attempt < rateLimitMaxAttempts; attempt++ {
+		now := time.Now()
+
+		result := r.db.WithContext(c).Exec(takeRateLimitToken,
+			sql.Named("key_hash", keyHash),
+			sql.Named("now", now.UnixNano()),
+			sql.Named("expires_at", now.Add(l.Period).UnixNano()),
+			sql.Named("per_token", int64(l.Period/time.Duration(l.Count))),
+			sql.Named("capacity", float64(l.Count)),
+		)
+		if err := result.Error; err != nil {
+			c.Errorw("take rate limit token failed", ctx.Err(err))
+			return false, 0, err
+		}
+		if result.RowsAffected == 1 {
+			return true, 0, nil
+		}
+
+		// 沒有更新到 bucket，可能是還沒有 bucket 或是 bucket 已經空了
+		next, _, _ := l.Take(ratelimit.Bucket{}, now)
+		result = r.db.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&RateLimitBucket{
+			KeyHash:   keyHash,
+			Tokens:    next.Tokens,
+			Updated:   now.UnixNano(),
+			ExpiresAt: now.Add(l.Period).UnixNano(),
+		})
+		if err := result.Error; err != nil {
+			c.Errorw("take rate limit token failed", ctx.Err(err))
+			return false, 0, err
+		}
+		if result.RowsAffected == 1 {
+			return true, 0, nil
+		}
+
+		var bucket RateLimitBucket
+		err := r.db.WithContext(c).Where("key_hash = ?", keyHash).Take(&bucket).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// bucket 剛好補滿被刪除，重新拿
+			continue
+		} else if err != nil {
+			c.Errorw("take rate limit token failed", ctx.Err(err))
+			return false, 0, err
+		}
+		if _, ok, wait := l.Take(ratelimit.Bucket{Tokens: bucket.Tokens, Updated: time.Unix(0, bucket.Updated)}, now); !ok {
+			return false, wait, nil
+		}
+		// bucket 在更新之後又補了 token，重新拿
+	}
+
+	// 同一個 key 一直搶不到 token 時不放行，避免同時湧入的請求繞過限制
+	c.Warnw("rate limit bucket contended", "attempts", rateLimitMaxAttempts)
+	return false, l.Period / time.Duration(l.Count), nil
+}
+
+// run sweeps every rateLimitSweepInterval until c is done
+func (r *rateLimitStore) run(c ctx.CTX) {
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case now := <-ticker.C:
+			r.sweep(c, now)
+		}
+	}
+}
+
+// sweep deletes the buckets refilled at now
+func (r *rateLimitStore) sweep(c ctx.CTX, now time.Time) {
+	result := r.db.WithContext(c).Where("expires_at <= ?", now.UnixNano()).Delete(&RateLimitBucket{})
+	if err := result.Error; err != nil {
+		c.Errorw("sweep rate limit buckets failed", ctx.Err(err))
+		return
+	}
+	if result.RowsAffected != 0 {
+		c.Infow("refilled rate limit buckets deleted", "rows", result.RowsAffected)
+	}
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ratelimit"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type rateLimitStoreSuite struct {
+	suite.Suite
+	ctx ctx.CTX
+	db  *gorm.DB
+}
+
+func (s *rateLimitStoreSuite) SetupSuite() {
+	s.ctx = ctx.Background()
+	var err error
+	s.db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+	if err := Migrate(s.db); err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *rateLimitStoreSuite) TearDownSuite() {
+	db, err := s.db.DB()
+	if err != nil {
+		s.ctx.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		s.ctx.Fatal(err)
+	}
+}
+
+func (s *rateLimitStoreSuite) TestTake() {
+	// 兩個 store 模擬兩個 replica，共用同一個 bucket
+	store1, err := NewRateLimitStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	store2, err := NewRateLimitStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	l := ratelimit.Limit{Count: 2, Period: time.Hour}
+
+	ok, _, err := store1.Take(s.ctx, "user:user_id_1", l)
+	s.NoError(err)
+	s.True(ok)
+	ok, _, err = store2.Take(s.ctx, "user:user_id_1", l)
+	s.NoError(err)
+	s.True(ok)
+
+	ok, wait, err := store1.Take(s.ctx, "user:user_id_1", l)
+	s.NoError(err)
+	s.False(ok)
+	s.InDelta(float64(30*time.Minute), float64(wait), float64(time.Second))
+
+	ok, _, err = store2.Take(s.ctx, "user:user_id_2", l)
+	s.NoError(err)
+	s.True(ok)
+
+	// key 以 hash 儲存
+	var n int64
+	s.NoError(s.db.Model(&RateLimitBucket{}).Where("key_hash LIKE ?", "%user_id%").Count(&n).Error)
+	s.Zero(n)
+}
+
+func (s *rateLimitStoreSuite) TestSweep() {
+	store, err := NewRateLimitStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	l := ratelimit.Limit{Count: 1, Period: time.Hour}
+
+	ok, _, err := store.Take(s.ctx, "ip:10.0.0.1", l)
+	s.NoError(err)
+	s.True(ok)
+	// 模擬已經補滿的 bucket
+	_, _, err = store.Take(s.ctx, "ip:10.0.0.2", l)
+	s.NoError(err)
+	s.NoError(s.db.Model(&RateLimitBucket{}).Where("key_hash = ?", hashKey("ip:10.0.0.2")).
+		Update("expires_at", time.Now().Add(-time.Second).UnixNano()).Error)
+
+	// 補滿的 bucket 定期被刪除，還沒補滿的保留
+	store.(*rateLimitStore).sweep(s.ctx, time.Now())
+	var n int64
+	s.NoError(s.db.Model(&RateLimitBucket{}).Where("expires_at <= ?", time.Now().UnixNano()).Count(&n).Error)
+	s.Zero(n)
+	ok, _, err = store.Take(s.ctx, "ip:10.0.0.1", l)
+	s.NoError(err)
+	s.False(ok)
+}
+
+func (s *rateLimitStoreSuite) TestTakeConcurrently() {
+	// 多個連線同時存取同一個資料庫，像是多個 replica
+	dsn := filepath.Join(s.T().TempDir(), "ratelimit.db") + "?_busy_timeout=5000&_journal_mode=WAL"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	s.NoError(err)
+	sqlDB, err := db.DB()
+	s.NoError(err)
+	defer sqlDB.Close()
+	store, err := NewRateLimitStore(s.ctx, db, Config{AutoMigrate: true})
+	s.NoError(err)
+	l := ratelimit.Limit{Count: 5, Period: time.Hour}
+
+	// 同一個用戶同時送出超過限制的請求，只有 5 個通過
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := store.Take(s.ctx, "user:user_id_1", l)
+			s.NoError(err)
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	s.Equal(int64(5), allowed.Load())
+
+	ok, wait, err := store.Take(s.ctx, "user:user_id_1", l)
+	s.NoError(err)
+	s.False(ok)
+	s.Positive(wait)
+}
+
+func (s *rateLimitStoreSuite) TestTakeWithContention() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	s.NoError(err)
+	sqlDB, err := db.DB()
+	s.NoError(err)
+	defer sqlDB.Close()
+	store, err := NewRateLimitStore(s.ctx, db, Config{AutoMigrate: true})
+	s.NoError(err)
+	l := ratelimit.Limit{Count: 5, Period: time.Hour}
+
+	// 每次拿 token 之前 bucket 都被其他 replica 更新，仍然只有 5 個請求通過，之後的請求被擋下而不是放行
+	s.NoError(db.Callback().Raw().Before("gorm:raw").Register("test:contend", func(tx *gorm.DB) {
+		if strings.HasPrefix(tx.Statement.SQL.String(), "UPDATE rate_limit_buckets SET tokens") {
+			tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE rate_limit_buckets SET updated = updated + 1")
+		}
+	}))
+	for i := 0; i < 10; i++ {
+		ok, _, err := store.Take(s.ctx, "user:user_id_1", l)
+		s.NoError(err)
+		s.Equal(i < 5, ok)
+	}
+}
+
+func (s *rateLimitStoreSuite) TestTakeRefilled() {
+	store, err := NewRateLimitStore(s.ctx, s.db, Config{})
+	s.NoError(err)
+	l := ratelimit.Limit{Count: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := store.Take(s.ctx, "user:user_id_3", l)
+		s.NoError(err)
+		s.True(ok)
+	}
+	// 模擬過了半小時補回一個 token
+	s.NoError(s.db.Model(&RateLimitBucket{}).Where("key_hash = ?", hashKey("user:user_id_3")).
+		Update("updated", time.Now().Add(-30*time.Minute).UnixNano()).Error)
+	ok, _, err := store.Take(s.ctx, "user:user_id_3", l)
+	s.NoError(err)
+	s.True(ok)
+	ok, _, err = store.Take(s.ctx, "user:user_id_3", l)
+	s.NoError(err)
+	s.False(ok)
+}
+
+func TestRateLimitStoreSuite(t *testing.T) {
+	suite.Run(t, new(rateLimitStoreSuite))
+}
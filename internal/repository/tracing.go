@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "tracing:span"
+
+// TracingPlugin is a gorm plugin recording every query as a child span of the span in
+// the query's context, register it with db.Use
+type TracingPlugin struct{}
+
+func (TracingPlugin) Name() string {
+	return "tracing"
+}
+
+func (TracingPlugin) Initialize(db *gorm.DB) error {
+	type register func(name string, fn func(*gorm.DB)) error
+
+	cb := db.Callback()
+	for _, p := range []struct {
+		operation     string
+		before, after register
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := p.before("tracing:before_"+p.operation, startQuerySpan(p.operation)); err != nil {
+			return err
+		}
+		if err := p.after("tracing:after_"+p.operation, endQuerySpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		// 只追蹤在請求或排程的 span 底下的查詢
+		if ctx.SpanFromContext(db.Statement.Context) == nil {
+			return
+		}
+		span := ctx.StartChildSpan(db.Statement.Context, "db."+operation, "db.operation", operation, "db.table", db.Statement.Table)
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endQuerySpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(*ctx.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes("db.rows_affected", db.RowsAffected)
+	if db.Error != nil {
+		span.SetError(db.Error.Error())
+	}
+	span.End()
+}
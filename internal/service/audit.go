@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+// systemActor is recorded when the operation isn't performed on behalf of a user or an operator
+const systemActor = "system"
+
+type AuditAction string
+
+const (
+	AuditActionCampaignCreate     AuditAction = "campaign.create"
+	AuditActionCampaignUpdate     AuditAction = "campaign.update"
+	AuditActionCampaignCancel     AuditAction = "campaign.cancel"
+	AuditActionCampaignReallocate AuditAction = "campaign.reallocate"
+	AuditActionReservationCreate  AuditAction = "reservation.create"
+	AuditActionCouponClaim        AuditAction = "coupon.claim"
+	AuditActionCouponRedeem       AuditAction = "coupon.redeem"
+	AuditActionCouponReallocate   AuditAction = "coupon.reallocate"
+)
+
+// AuditLog records who changed what and when, Before and After are JSON snapshots
+type AuditLog struct {
+	ID         uint
+	Created    int64
+	CampaignID uint
+	UserID     string
+	Actor      string
+	Action     AuditAction
+	Before     string
+	After      string
+	RequestID  string
+}
+
+// AuditLogs is a page of audit logs, NextCursor is 0 when there is no more page.
+type AuditLogs struct {
+	AuditLogs  []AuditLog
+	NextCursor uint
+}
+
+// ListAuditLogsInput lists the audit logs of a campaign, a user, or both
+type ListAuditLogsInput struct {
+	CampaignID uint
+	UserID     string
+	Cursor     uint
+	Limit      int
+}
+
+func (s campaignService) ListAuditLogs(c ctx.CTX, p ListAuditLogsInput) (*AuditLogs, error) {
+	c, span := c.StartSpan("campaignService.ListAuditLogs", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	// 多拿一筆來判斷是否還有下一頁
+	logs, err := s.repo.ListAuditLogs(c, repository.ListAuditLogsInput{
+		CampaignID: p.CampaignID,
+		UserID:     p.UserID,
+		Cursor:     p.Cursor,
+		Limit:      p.Limit + 1,
+	})
+	if err != nil {
+		c.Errorw("list audit logs failed", ctx.Err(err))
+		return nil, err
+	}
+
+	res := AuditLogs{}
+	if len(logs) > p.Limit {
+		logs = logs[:p.Limit]
+		res.NextCursor = logs[len(logs)-1].ID
+	}
+	res.AuditLogs = make([]AuditLog, 0, len(logs))
+	for i := range logs {
+		res.AuditLogs = append(res.AuditLogs, toAuditLog(&logs[i]))
+	}
+	return &res, nil
+}
+
+// audit appends an audit log of the change, before and after are marshalled to JSON.
+// The change has already been made, so a failure is only logged.
+func (s campaignService) audit(c ctx.CTX, campaignID uint, userID string, action AuditAction, before, after ctx.M) {
+	actor := c.Actor()
+	if actor == "" {
+		actor = systemActor
+	}
+
+	input := repository.CreateAuditLogInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+		Actor:      actor,
+		Action:     string(action),
+		Before:     marshalAuditValue(before),
+		After:      marshalAuditValue(after),
+		RequestID:  c.RequestID(),
+	}
+	if _, err := s.repo.CreateAuditLog(c, input); err != nil {
+		c.Errorw("audit failed", "action", action, ctx.Err(err))
+	}
+}
+
+func marshalAuditValue(v ctx.M) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func campaignAuditValue(c *repository.Campaign) ctx.M {
+	return ctx.M{
+		"reservation_start_at": c.ReservationStartAt,
+		"reservation_end_at":   c.ReservationEndAt,
+		"grab_start_at":        c.GrabStartAt,
+		"grab_end_at":          c.GrabEndAt,
+		"reallocate_unclaimed": c.ReallocateUnclaimed,
+		"reallocated_at":       c.ReallocatedAt,
+		"cancelled_at":         c.CancelledAt,
+		"schedule_key":         c.ScheduleKey,
+		// seed 在公開前是秘密，只記錄它的 hash
+		"draw_mode": c.DrawMode,
+		"seed_hash": c.SeedHash,
+	}
+}
+
+// 稽核紀錄不存 coupon code，只存狀態
+func reservationAuditValue(r *repository.CouponReservation) ctx.M {
+	return ctx.M{
+		"coupon_status":  couponStatus(r),
+		"claimed_at":     r.ClaimedAt,
+		"redeemed_at":    r.RedeemedAt,
+		"reallocated_at": r.ReallocatedAt,
+	}
+}
+
+func toAuditLog(l *repository.AuditLog) AuditLog {
+	return AuditLog{
+		ID:         l.ID,
+		Created:    l.Created,
+		CampaignID: l.CampaignID,
+		UserID:     l.UserID,
+		Actor:      l.Actor,
+		Action:     AuditAction(l.Action),
+		Before:     l.Before,
+		After:      l.After,
+		RequestID:  l.RequestID,
+	}
+}
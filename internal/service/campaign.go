@@ -2,37 +2,225 @@ package service
 
 import (
 	"errors"
+	"math"
+	"math/rand/v2"
+	"strings"
 	"time"
 
 	"github.com/asymptoter/tonx-take-home-test/internal/repository"
 	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
 	"github.com/google/uuid"
 )
 
 var (
 	newUUIDString = uuid.NewString
 	timeNow       = time.Now
+	randPerm      = rand.Perm
+	newSeed       = lottery.NewSeed
 )
 
+// hashDrawSeed is the public seed of the hash draws whose win ratio isn't 1/n,
+// so they're exactly as likely to win as the ratio and as predictable as the modulo.
+var hashDrawSeed = lottery.Seed(strings.Repeat("00", lottery.SeedSize))
+
 var (
-	ErrNotReservationTime = errors.New("not reservationtime")
+	ErrCampaignNotFound     = errors.New("campaign not found")
+	ErrCampaignCancelled    = errors.New("campaign cancelled")
+	ErrCampaignStarted      = errors.New("campaign already started")
+	ErrInvalidWindow        = errors.New("invalid campaign window")
+	ErrOverlappingWindow    = errors.New("overlapping campaign window")
+	ErrNotReservationTime   = errors.New("not reservationtime")
+	ErrNotGrabTime          = errors.New("not grab time")
+	ErrNotReallocationTime  = errors.New("not reallocation time")
+	ErrReallocationDisabled = errors.New("reallocation disabled")
+	ErrAlreadyReallocated   = errors.New("already reallocated")
+	ErrNotRedeemable        = errors.New("not redeemable")
+	ErrReservationNotFound  = errors.New("reservation not found")
+	ErrNoDrawProof          = errors.New("campaign has no draw proof")
+)
+
+const (
+	// DrawModeHash decides the winners by the sum of the user id runes modulo 1/WinRatio,
+	// or by the keyed draw with a public seed if 1/WinRatio isn't an integer.
+	// It's predictable and only kept for the campaigns created before the keyed draws.
+	DrawModeHash = "hash"
+	// DrawModeKeyed decides the winners by HMAC(seed, campaign_id||user_id) with a random seed
+	// generated for each campaign, the seed is never revealed.
+	DrawModeKeyed = "keyed"
+	// DrawModeCommitReveal is the keyed draw publishing the hash of the seed when the campaign is created,
+	// the seed is revealed after the grab window so anyone can verify the draw.
+	DrawModeCommitReveal = "commit_reveal"
 )
 
+// Config configures the campaigns, the default windows are offsets from the local midnight
+type Config struct {
+	// 優惠券的數量約為預約用戶數量的 WinRatio
+	WinRatio            float64
+	ReservationStart    time.Duration
+	ReservationDuration time.Duration
+	GrabStart           time.Duration
+	GrabDuration        time.Duration
+
+	// 搶購時間結束後的重新分配時間及補搶時間
+	ReallocationDuration time.Duration
+	FollowUpGrabDuration time.Duration
+
+	// DrawMode of the campaigns created afterwards
+	DrawMode string
+}
+
+// DefaultConfig reserves from 22:55 to 22:59 and grabs from 23:00 to 23:01 with 20% winners
+func DefaultConfig() Config {
+	return Config{
+		WinRatio:             0.2,
+		ReservationStart:     22*time.Hour + 55*time.Minute,
+		ReservationDuration:  4 * time.Minute,
+		GrabStart:            23 * time.Hour,
+		GrabDuration:         time.Minute,
+		ReallocationDuration: time.Minute,
+		FollowUpGrabDuration: time.Minute,
+		DrawMode:             DrawModeKeyed,
+	}
+}
+
 type Campaign struct {
-	ID      uint
-	Created int64
+	ID                  uint
+	Created             int64
+	Updated             int64
+	ReservationStartAt  int64
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64
+	ReallocateUnclaimed bool
+	ReallocatedAt       int64
+	CancelledAt         int64
+	ScheduleKey         string
+	DrawMode            string
+	// SeedHash is the commitment to the seed of the commit-reveal draw
+	SeedHash string
+	// EndAt is the end of the last window, the follow-up grab window if the unclaimed coupons are reallocated
+	EndAt int64
 }
 
-type CouponReservation struct {
+// CampaignProof lets anyone verify the commit-reveal draw of a campaign,
+// Seed is empty until RevealAt.
+type CampaignProof struct {
 	CampaignID uint
-	UserID     string
-	CouponCode string
+	SeedHash   string
+	Seed       string
+	WinRatio   float64
+	Threshold  uint64
+	RevealAt   int64
 }
 
+// Campaigns is a page of campaigns, NextCursor is 0 when there is no more page.
+type Campaigns struct {
+	Campaigns  []Campaign
+	NextCursor uint
+}
+
+type CouponStatus string
+
+const (
+	CouponStatusNone      CouponStatus = "none"
+	CouponStatusUnclaimed CouponStatus = "unclaimed"
+	CouponStatusClaimed   CouponStatus = "claimed"
+	CouponStatusRedeemed  CouponStatus = "redeemed"
+	CouponStatusRevoked   CouponStatus = "revoked"
+)
+
+type CouponReservation struct {
+	CampaignID    uint
+	UserID        string
+	CouponCode    string
+	Created       int64
+	ClaimedAt     int64
+	RedeemedAt    int64
+	ReallocatedAt int64
+	WonDraw       bool
+	CouponStatus  CouponStatus
+}
+
+// Won reports whether the user got a coupon
+func (r CouponReservation) Won() bool {
+	return r.CouponCode != ""
+}
+
+// UserCouponReservations is a page of a user's reservations,
+// NextCursor is 0 when there is no more page.
+type UserCouponReservations struct {
+	Reservations []CouponReservation
+	NextCursor   uint
+}
+
+// Reallocation summarizes the reallocation phase of a campaign
+type Reallocation struct {
+	CampaignID  uint
+	Unclaimed   int
+	Reallocated int
+}
+
+type CampaignStats struct {
+	CampaignID            uint
+	Reservations          int64
+	Winners               int64
+	WinRatio              float64
+	TargetWinRatio        float64
+	Claimed               int64
+	Redeemed              int64
+	ReservationsPerMinute []MinuteCount
+}
+
+type MinuteCount struct {
+	Minute int64
+	Count  int64
+}
+
+// CouponClaim is the result of claiming a coupon reservation
+type CouponClaim struct {
+	Reservation    CouponReservation
+	AlreadyClaimed bool
+}
+
+// CreateCampaignInput creates a campaign with the given windows in unix timestamp,
+// each window is [start, end). Zero windows default to today's windows in Config. A campaign is created only once for the same ScheduleKey,
+// later calls return the existing one.
 type CreateCampaignInput struct {
+	ReservationStartAt  int64
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64
+	ReallocateUnclaimed bool
+	ScheduleKey         string
 }
 
+type GetCampaignInput struct {
+	ID uint
+}
+
+// GetLatestCampaignInput returns the campaign created last, or the campaign whose grab window
+// ended last if GrabEnded is set.
 type GetLatestCampaignInput struct {
+	GrabEnded bool
+}
+
+type ListCampaignsInput struct {
+	Cursor uint
+	Limit  int
+}
+
+type UpdateCampaignInput struct {
+	ID                  uint
+	ReservationStartAt  int64
+	ReservationEndAt    int64
+	GrabStartAt         int64
+	GrabEndAt           int64
+	ReallocateUnclaimed bool
+}
+
+type CancelCampaignInput struct {
+	ID uint
 }
 
 type CreateCouponReservationInput struct {
@@ -45,64 +233,364 @@ type GetCouponReservationInput struct {
 	UserID     string
 }
 
+type ClaimCouponReservationInput struct {
+	CampaignID uint
+	UserID     string
+}
+
+type RedeemCouponReservationInput struct {
+	CampaignID uint
+	UserID     string
+}
+
+type GetCampaignProofInput struct {
+	CampaignID uint
+}
+
+type GetCampaignStatsInput struct {
+	CampaignID uint
+}
+
+type ListUserCouponReservationsInput struct {
+	UserID string
+	Cursor uint
+	Limit  int
+}
+
+type ExportCouponReservationsInput struct {
+	CampaignID  uint
+	WinnersOnly bool
+}
+
+// ReallocateCouponsInput reallocates the coupons of a campaign, Force runs the reallocation
+// outside of the reallocation window and again if the campaign is already reallocated.
+type ReallocateCouponsInput struct {
+	CampaignID uint
+	Force      bool
+}
+
 type CampaignService interface {
 	Create(c ctx.CTX, p CreateCampaignInput) (*Campaign, error)
+	Get(c ctx.CTX, p GetCampaignInput) (*Campaign, error)
 	GetLatest(c ctx.CTX, p GetLatestCampaignInput) (*Campaign, error)
+	List(c ctx.CTX, p ListCampaignsInput) (*Campaigns, error)
+	// Update changes the windows of a campaign before its reservation window opens
+	Update(c ctx.CTX, p UpdateCampaignInput) (*Campaign, error)
+	Cancel(c ctx.CTX, p CancelCampaignInput) (*Campaign, error)
+	GetStats(c ctx.CTX, p GetCampaignStatsInput) (*CampaignStats, error)
+	// GetProof returns the commitment of a commit-reveal campaign, and its seed after the grab window
+	GetProof(c ctx.CTX, p GetCampaignProofInput) (*CampaignProof, error)
 
 	CreateCouponReservation(c ctx.CTX, p CreateCouponReservationInput) (*CouponReservation, error)
 	GetCouponReservation(c ctx.CTX, p GetCouponReservationInput) (*CouponReservation, error)
+
+	// ClaimCouponReservation is the grab operation, each user can only claim once
+	// during the grab window. Later claims return the same result with AlreadyClaimed.
+	ClaimCouponReservation(c ctx.CTX, p ClaimCouponReservationInput) (*CouponClaim, error)
+	RedeemCouponReservation(c ctx.CTX, p RedeemCouponReservationInput) (*CouponReservation, error)
+	ListUserCouponReservations(c ctx.CTX, p ListUserCouponReservationsInput) (*UserCouponReservations, error)
+	// ExportCouponReservations streams the reservations of a campaign to fn
+	ExportCouponReservations(c ctx.CTX, p ExportCouponReservationsInput, fn func(CouponReservation) error) error
+
+	// ReallocateCoupons gives the coupons nobody claimed during the grab window
+	// to randomly chosen losers, who can get them in the follow-up grab window.
+	ReallocateCoupons(c ctx.CTX, p ReallocateCouponsInput) (*Reallocation, error)
+
+	// ListAuditLogs lists the audit logs of state changes from the newest one
+	ListAuditLogs(c ctx.CTX, p ListAuditLogsInput) (*AuditLogs, error)
+
+	// GetFairnessReport checks the draw result of a campaign against the win ratio
+	GetFairnessReport(c ctx.CTX, p GetFairnessReportInput) (*FairnessReport, error)
 }
 
 type campaignService struct {
 	repo repository.CampaignRepository
+	cfg  Config
 }
 
-func NewCampaignService(c ctx.CTX, repo repository.CampaignRepository) CampaignService {
+func NewCampaignService(c ctx.CTX, repo repository.CampaignRepository, cfg Config) CampaignService {
 	return campaignService{
 		repo: repo,
+		cfg:  cfg,
 	}
 }
 
 func (s campaignService) Create(c ctx.CTX, p CreateCampaignInput) (*Campaign, error) {
-	res, err := s.repo.Create(c, repository.CreateCampaignInput{})
+	c, span := c.StartSpan("campaignService.Create")
+	defer span.End()
+
+	// 排程重跑時回傳已經建立的 campaign，不會重複建立
+	if p.ScheduleKey != "" {
+		res, err := s.repo.GetByScheduleKey(c, repository.GetCampaignByScheduleKeyInput{ScheduleKey: p.ScheduleKey})
+		if err == nil {
+			c.Infow("campaign already created", "campaign_id", res.ID, "schedule_key", p.ScheduleKey)
+			return s.toCampaign(res), nil
+		} else if err != repository.ErrCampaignNotFound {
+			c.Errorw("create campaign failed", ctx.Err(err))
+			return nil, err
+		}
+	}
+
+	if p.ReservationStartAt == 0 && p.ReservationEndAt == 0 && p.GrabStartAt == 0 && p.GrabEndAt == 0 {
+		// 預設使用 Config 裡每天的預約及搶購時間
+		year, month, day := timeNow().Date()
+		midnight := time.Date(year, month, day, 0, 0, 0, 0, timeNow().Location())
+		p.ReservationStartAt = midnight.Add(s.cfg.ReservationStart).Unix()
+		p.ReservationEndAt = midnight.Add(s.cfg.ReservationStart + s.cfg.ReservationDuration).Unix()
+		p.GrabStartAt = midnight.Add(s.cfg.GrabStart).Unix()
+		p.GrabEndAt = midnight.Add(s.cfg.GrabStart + s.cfg.GrabDuration).Unix()
+	}
+	if err := s.validateWindows(c, 0, p.ReservationStartAt, p.ReservationEndAt, p.GrabStartAt, p.GrabEndAt); err != nil {
+		c.Errorw("create campaign failed", ctx.Err(err))
+		return nil, err
+	}
+
+	input := repository.CreateCampaignInput{
+		ReservationStartAt:  p.ReservationStartAt,
+		ReservationEndAt:    p.ReservationEndAt,
+		GrabStartAt:         p.GrabStartAt,
+		GrabEndAt:           p.GrabEndAt,
+		ReallocateUnclaimed: p.ReallocateUnclaimed,
+		ScheduleKey:         p.ScheduleKey,
+		DrawMode:            s.cfg.DrawMode,
+	}
+	if s.cfg.DrawMode == DrawModeKeyed || s.cfg.DrawMode == DrawModeCommitReveal {
+		// 每個 campaign 在建立時產生新的 seed，之後不能再更換
+		seed, err := newSeed()
+		if err != nil {
+			c.Errorw("create campaign failed", ctx.Err(err))
+			return nil, err
+		}
+		if input.SeedHash, err = lottery.Commit(seed); err != nil {
+			c.Errorw("create campaign failed", ctx.Err(err))
+			return nil, err
+		}
+		input.Seed = seed
+		input.WinRatio = s.cfg.WinRatio
+	}
+	res, err := s.repo.Create(c, input)
 	if err != nil {
-		c.Error(err)
+		c.Errorw("create campaign failed", ctx.Err(err))
 		return nil, err
 	}
-	return &Campaign{
-		ID:      res.ID,
-		Created: res.Created,
-	}, nil
+
+	s.audit(c, res.ID, "", AuditActionCampaignCreate, nil, campaignAuditValue(res))
+	return s.toCampaign(res), nil
+}
+
+func (s campaignService) Get(c ctx.CTX, p GetCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignService.Get", "campaign_id", p.ID)
+	defer span.End()
+
+	res, err := s.getCampaign(c, p.ID)
+	if err != nil {
+		c.Errorw("get campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	return s.toCampaign(res), nil
 }
 
 func (s campaignService) GetLatest(c ctx.CTX, p GetLatestCampaignInput) (*Campaign, error) {
-	res, err := s.repo.GetLatest(c, repository.GetLatestCampaignInput{})
+	c, span := c.StartSpan("campaignService.GetLatest")
+	defer span.End()
+
+	input := repository.GetLatestCampaignInput{}
+	if p.GrabEnded {
+		input.GrabEndedBefore = timeNow().Unix()
+	}
+	res, err := s.repo.GetLatest(c, input)
 	if err != nil {
-		c.Error(err)
+		c.Errorw("get latest campaign failed", ctx.Err(err))
 		return nil, err
 	}
-	return &Campaign{
-		ID:      res.ID,
-		Created: res.Created,
-	}, nil
+	return s.toCampaign(res), nil
+}
+
+func (s campaignService) List(c ctx.CTX, p ListCampaignsInput) (*Campaigns, error) {
+	c, span := c.StartSpan("campaignService.List")
+	defer span.End()
+
+	// 多拿一筆來判斷是否還有下一頁
+	campaigns, err := s.repo.List(c, repository.ListCampaignsInput{
+		Cursor: p.Cursor,
+		Limit:  p.Limit + 1,
+	})
+	if err != nil {
+		c.Errorw("list campaigns failed", ctx.Err(err))
+		return nil, err
+	}
+
+	res := Campaigns{}
+	if len(campaigns) > p.Limit {
+		campaigns = campaigns[:p.Limit]
+		res.NextCursor = campaigns[len(campaigns)-1].ID
+	}
+	res.Campaigns = make([]Campaign, 0, len(campaigns))
+	for i := range campaigns {
+		res.Campaigns = append(res.Campaigns, *s.toCampaign(&campaigns[i]))
+	}
+	return &res, nil
+}
+
+func (s campaignService) Update(c ctx.CTX, p UpdateCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignService.Update", "campaign_id", p.ID)
+	defer span.End()
+
+	c = c.With("campaign_id", p.ID)
+
+	campaign, err := s.getCampaign(c, p.ID)
+	if err != nil {
+		c.Errorw("update campaign failed", ctx.Err(err))
+		return nil, err
+	}
+	if campaign.CancelledAt != 0 {
+		c.Errorw("update campaign failed", ctx.Err(ErrCampaignCancelled))
+		return nil, ErrCampaignCancelled
+	}
+	// 開始預約之後就不能修改，新的時間也不能早於現在
+	now := timeNow().Unix()
+	if campaign.ReservationStartAt <= now {
+		c.Errorw("update campaign failed", ctx.Err(ErrCampaignStarted))
+		return nil, ErrCampaignStarted
+	}
+	if p.ReservationStartAt <= now {
+		c.Errorw("update campaign failed", ctx.Err(ErrInvalidWindow))
+		return nil, ErrInvalidWindow
+	}
+	if err := s.validateWindows(c, p.ID, p.ReservationStartAt, p.ReservationEndAt, p.GrabStartAt, p.GrabEndAt); err != nil {
+		c.Errorw("update campaign failed", ctx.Err(err))
+		return nil, err
+	}
+
+	input := repository.UpdateCampaignInput{
+		ID:                  p.ID,
+		Now:                 now,
+		ReservationStartAt:  p.ReservationStartAt,
+		ReservationEndAt:    p.ReservationEndAt,
+		GrabStartAt:         p.GrabStartAt,
+		GrabEndAt:           p.GrabEndAt,
+		ReallocateUnclaimed: p.ReallocateUnclaimed,
+	}
+	res, err := s.repo.Update(c, input)
+	if err == repository.ErrCampaignStarted {
+		c.Errorw("update campaign failed", ctx.Err(ErrCampaignStarted))
+		return nil, ErrCampaignStarted
+	} else if err != nil {
+		c.Errorw("update campaign failed", ctx.Err(err))
+		return nil, err
+	}
+
+	s.audit(c, p.ID, "", AuditActionCampaignUpdate, campaignAuditValue(campaign), campaignAuditValue(res))
+	return s.toCampaign(res), nil
+}
+
+func (s campaignService) Cancel(c ctx.CTX, p CancelCampaignInput) (*Campaign, error) {
+	c, span := c.StartSpan("campaignService.Cancel", "campaign_id", p.ID)
+	defer span.End()
+
+	c = c.With("campaign_id", p.ID)
+
+	campaign, err := s.getCampaign(c, p.ID)
+	if err != nil {
+		c.Errorw("cancel campaign failed", ctx.Err(err))
+		return nil, err
+	}
+
+	res, err := s.repo.Cancel(c, repository.CancelCampaignInput{ID: p.ID})
+	if err == repository.ErrCampaignNotFound {
+		c.Errorw("cancel campaign failed", ctx.Err(ErrCampaignNotFound))
+		return nil, ErrCampaignNotFound
+	} else if err != nil {
+		c.Errorw("cancel campaign failed", ctx.Err(err))
+		return nil, err
+	}
+
+	// 重複取消不會改變狀態，不需要再記錄
+	if campaign.CancelledAt == 0 {
+		s.audit(c, p.ID, "", AuditActionCampaignCancel, campaignAuditValue(campaign), campaignAuditValue(res))
+	}
+	return s.toCampaign(res), nil
+}
+
+func (s campaignService) GetStats(c ctx.CTX, p GetCampaignStatsInput) (*CampaignStats, error) {
+	c, span := c.StartSpan("campaignService.GetStats", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	campaign, err := s.getCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("get campaign stats failed", ctx.Err(err))
+		return nil, err
+	}
+	res, err := s.repo.GetStats(c, repository.GetCampaignStatsInput{CampaignID: p.CampaignID})
+	if err != nil {
+		c.Errorw("get campaign stats failed", ctx.Err(err))
+		return nil, err
+	}
+
+	stats := CampaignStats{
+		CampaignID:            p.CampaignID,
+		Reservations:          res.Reservations,
+		Winners:               res.Winners,
+		TargetWinRatio:        s.winRatio(campaign),
+		Claimed:               res.Claimed,
+		Redeemed:              res.Redeemed,
+		ReservationsPerMinute: reservationsPerMinute(campaign, res.ReservationsPerMinute),
+	}
+	if res.Reservations != 0 {
+		stats.WinRatio = float64(res.Winners) / float64(res.Reservations)
+	}
+	return &stats, nil
+}
+
+// reservationsPerMinute fills the minutes of the reservation window without reservations with 0,
+// counts is sorted by minute and only has the minutes with reservations.
+func reservationsPerMinute(c *repository.Campaign, counts []repository.MinuteCount) []MinuteCount {
+	res := make([]MinuteCount, 0, len(counts))
+	i := 0
+	for minute := c.ReservationStartAt - c.ReservationStartAt%60; minute < c.ReservationEndAt; minute += 60 {
+		// 視窗之外的 minute 照原樣保留
+		for ; i < len(counts) && counts[i].Minute < minute; i++ {
+			res = append(res, MinuteCount{Minute: counts[i].Minute, Count: counts[i].Count})
+		}
+		count := int64(0)
+		if i < len(counts) && counts[i].Minute == minute {
+			count = counts[i].Count
+			i++
+		}
+		res = append(res, MinuteCount{Minute: minute, Count: count})
+	}
+	for ; i < len(counts); i++ {
+		res = append(res, MinuteCount{Minute: counts[i].Minute, Count: counts[i].Count})
+	}
+	return res
 }
 
 func (s campaignService) CreateCouponReservation(c ctx.CTX, p CreateCouponReservationInput) (*CouponReservation, error) {
-	// 用戶每天只有 22:55:00 到 22:58:59 可以預約
-	hour, min, _ := timeNow().Clock()
-	if hour != 22 || min < 55 || min > 58 {
-		c.With("now", timeNow().String()).Error(ErrNotReservationTime)
-		return nil, ErrNotReservationTime
+	c, span := c.StartSpan("campaignService.CreateCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	campaign, err := s.getOpenCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("create coupon reservation failed", ctx.Err(err))
+		reservationsRejected.WithLabelValues(rejectReason(err)).Inc()
+		return nil, err
 	}
 
-	// 根據 campaign_id 和 user_id 來決定 user 能不能拿到 coupon
-	v := p.CampaignID
-	for _, b := range p.UserID {
-		v += uint(b)
+	// 用戶只有在活動的預約時間可以預約
+	if !isReservationTime(campaign, timeNow()) {
+		c.Errorw("create coupon reservation failed", "now", timeNow().String(), ctx.Err(ErrNotReservationTime))
+		reservationsRejected.WithLabelValues(rejectReason(ErrNotReservationTime)).Inc()
+		return nil, ErrNotReservationTime
 	}
 
+	won, err := s.draw(campaign, p.UserID)
+	if err != nil {
+		c.Errorw("create coupon reservation failed", ctx.Err(err))
+		reservationsRejected.WithLabelValues(rejectReason(err)).Inc()
+		return nil, err
+	}
 	couponCode := ""
-	if v%5 == 0 { // 1/5 的機率可以拿到 coupon
+	if won {
 		couponCode = newUUIDString()
 	}
 
@@ -110,34 +598,437 @@ func (s campaignService) CreateCouponReservation(c ctx.CTX, p CreateCouponReserv
 		CampaignID: p.CampaignID,
 		UserID:     p.UserID,
 		CouponCode: couponCode,
+		WonDraw:    won,
 	}
 	res, err := s.repo.CreateCouponReservation(c, input)
 	if err != nil {
-		c.Error(err)
+		c.Errorw("create coupon reservation failed", ctx.Err(err))
+		reservationsRejected.WithLabelValues(rejectReason(err)).Inc()
 		return nil, err
 	}
 
-	return &CouponReservation{
-		CampaignID: res.CampaignID,
-		UserID:     res.UserID,
-		CouponCode: res.CouponCode,
-	}, nil
+	reservationsAccepted.WithLabelValues().Inc()
+	if couponCode != "" {
+		winnersIssued.WithLabelValues(winnerSourceDraw).Inc()
+	}
+	s.audit(c, p.CampaignID, p.UserID, AuditActionReservationCreate, nil, reservationAuditValue(res))
+	return toCouponReservation(res), nil
 }
 
 func (s campaignService) GetCouponReservation(c ctx.CTX, p GetCouponReservationInput) (*CouponReservation, error) {
+	c, span := c.StartSpan("campaignService.GetCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
 	input := repository.GetCouponReservationInput{
 		CampaignID: p.CampaignID,
 		UserID:     p.UserID,
 	}
 	res, err := s.repo.GetCouponReservation(c, input)
 	if err != nil {
-		c.Error(err)
+		c.Errorw("get coupon reservation failed", ctx.Err(err))
 		return nil, err
 	}
 
-	return &CouponReservation{
-		CampaignID: res.CampaignID,
-		UserID:     res.UserID,
-		CouponCode: res.CouponCode,
+	return toCouponReservation(res), nil
+}
+
+func (s campaignService) ClaimCouponReservation(c ctx.CTX, p ClaimCouponReservationInput) (*CouponClaim, error) {
+	c, span := c.StartSpan("campaignService.ClaimCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	campaign, err := s.getOpenCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("claim coupon reservation failed", ctx.Err(err))
+		return nil, err
+	}
+
+	// 只有在搶購時間或重新分配後的補搶時間可以領取
+	now := timeNow()
+	if !isGrabTime(campaign, now) && !(campaign.ReallocateUnclaimed && s.isFollowUpGrabTime(campaign, now)) {
+		c.Errorw("claim coupon reservation failed", "now", now.String(), ctx.Err(ErrNotGrabTime))
+		return nil, ErrNotGrabTime
+	}
+
+	input := repository.ClaimCouponReservationInput{
+		CampaignID: p.CampaignID,
+		UserID:     p.UserID,
+	}
+	res, err := s.repo.ClaimCouponReservation(c, input)
+	if err == repository.ErrReservationNotFound {
+		c.Errorw("claim coupon reservation failed", ctx.Err(ErrReservationNotFound))
+		return nil, ErrReservationNotFound
+	} else if err != nil {
+		c.Errorw("claim coupon reservation failed", ctx.Err(err))
+		return nil, err
+	}
+
+	if !res.AlreadyClaimed {
+		before := res.Reservation
+		before.ClaimedAt = 0
+		s.audit(c, p.CampaignID, p.UserID, AuditActionCouponClaim, reservationAuditValue(&before), reservationAuditValue(&res.Reservation))
+	}
+
+	return &CouponClaim{
+		Reservation:    *toCouponReservation(&res.Reservation),
+		AlreadyClaimed: res.AlreadyClaimed,
 	}, nil
 }
+
+func (s campaignService) RedeemCouponReservation(c ctx.CTX, p RedeemCouponReservationInput) (*CouponReservation, error) {
+	c, span := c.StartSpan("campaignService.RedeemCouponReservation", "campaign_id", p.CampaignID, "user_id", p.UserID)
+	defer span.End()
+
+	input := repository.RedeemCouponReservationInput{
+		CampaignID: p.CampaignID,
+		UserID:     p.UserID,
+	}
+	res, err := s.repo.RedeemCouponReservation(c, input)
+	if err == repository.ErrNotRedeemable {
+		c.Errorw("redeem coupon reservation failed", ctx.Err(ErrNotRedeemable))
+		return nil, ErrNotRedeemable
+	} else if err != nil {
+		c.Errorw("redeem coupon reservation failed", ctx.Err(err))
+		return nil, err
+	}
+
+	before := *res
+	before.RedeemedAt = 0
+	s.audit(c, p.CampaignID, p.UserID, AuditActionCouponRedeem, reservationAuditValue(&before), reservationAuditValue(res))
+
+	return toCouponReservation(res), nil
+}
+
+func (s campaignService) ListUserCouponReservations(c ctx.CTX, p ListUserCouponReservationsInput) (*UserCouponReservations, error) {
+	c, span := c.StartSpan("campaignService.ListUserCouponReservations", "user_id", p.UserID)
+	defer span.End()
+
+	// 多拿一筆來判斷是否還有下一頁
+	input := repository.ListUserCouponReservationsInput{
+		UserID: p.UserID,
+		Cursor: p.Cursor,
+		Limit:  p.Limit + 1,
+	}
+	reservations, err := s.repo.ListUserCouponReservations(c, input)
+	if err != nil {
+		c.Errorw("list user coupon reservations failed", ctx.Err(err))
+		return nil, err
+	}
+
+	res := UserCouponReservations{}
+	if len(reservations) > p.Limit {
+		reservations = reservations[:p.Limit]
+		res.NextCursor = reservations[len(reservations)-1].CampaignID
+	}
+	res.Reservations = make([]CouponReservation, 0, len(reservations))
+	for i := range reservations {
+		res.Reservations = append(res.Reservations, *toCouponReservation(&reservations[i]))
+	}
+	return &res, nil
+}
+
+func (s campaignService) ExportCouponReservations(c ctx.CTX, p ExportCouponReservationsInput, fn func(CouponReservation) error) error {
+	c, span := c.StartSpan("campaignService.ExportCouponReservations", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	c = c.With("campaign_id", p.CampaignID)
+
+	if _, err := s.getCampaign(c, p.CampaignID); err != nil {
+		c.Errorw("export coupon reservations failed", ctx.Err(err))
+		return err
+	}
+
+	input := repository.ScanCouponReservationsInput{
+		CampaignID:  p.CampaignID,
+		WinnersOnly: p.WinnersOnly,
+	}
+	if err := s.repo.ScanCouponReservations(c, input, func(r *repository.CouponReservation) error {
+		return fn(*toCouponReservation(r))
+	}); err != nil {
+		c.Errorw("export coupon reservations failed", ctx.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (s campaignService) ReallocateCoupons(c ctx.CTX, p ReallocateCouponsInput) (*Reallocation, error) {
+	c, span := c.StartSpan("campaignService.ReallocateCoupons", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	c = c.With("campaign_id", p.CampaignID)
+
+	campaign, err := s.getOpenCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("reallocate coupons failed", ctx.Err(err))
+		return nil, err
+	}
+
+	// 搶購時間結束後，在補搶時間開始前重新分配
+	if !p.Force && !s.isReallocationTime(campaign, timeNow()) {
+		c.Errorw("reallocate coupons failed", "now", timeNow().String(), ctx.Err(ErrNotReallocationTime))
+		return nil, ErrNotReallocationTime
+	}
+	if !campaign.ReallocateUnclaimed {
+		c.Errorw("reallocate coupons failed", ctx.Err(ErrReallocationDisabled))
+		return nil, ErrReallocationDisabled
+	}
+	if !p.Force && campaign.ReallocatedAt != 0 {
+		c.Errorw("reallocate coupons failed", ctx.Err(ErrAlreadyReallocated))
+		return nil, ErrAlreadyReallocated
+	}
+
+	// 只收回抽中且還沒領取的 coupon，重跑時不會再收回上一次重新分配出去的 coupon
+	winner, loser, claimed, reallocated := true, false, false, false
+	unclaimed, err := s.repo.ListCouponReservations(c, repository.ListCouponReservationsInput{
+		CampaignID: p.CampaignID,
+		Winner:     &winner,
+		Claimed:    &claimed,
+		WonDraw:    &winner,
+	})
+	if err != nil {
+		c.Errorw("reallocate coupons failed", ctx.Err(err))
+		return nil, err
+	}
+	// 被收回的中獎者和已經拿到重新分配 coupon 的用戶不會再被挑中
+	losers, err := s.repo.ListCouponReservations(c, repository.ListCouponReservationsInput{
+		CampaignID:  p.CampaignID,
+		Winner:      &loser,
+		WonDraw:     &loser,
+		Reallocated: &reallocated,
+	})
+	if err != nil {
+		c.Errorw("reallocate coupons failed", ctx.Err(err))
+		return nil, err
+	}
+
+	// 從沒拿到 coupon 的用戶中隨機挑選；沒被領取的 coupon 比他們多時，也隨機挑選要重新分配的 coupon，
+	// 不會都是 user_id 排在前面的中獎者
+	unclaimedPerm := randPerm(len(unclaimed))
+	perm := randPerm(len(losers))
+	reallocations := make([]repository.CouponReallocation, 0, min(len(unclaimed), len(losers)))
+	for i := 0; i < len(unclaimed) && i < len(losers); i++ {
+		from := unclaimed[unclaimedPerm[i]]
+		reallocations = append(reallocations, repository.CouponReallocation{
+			FromUserID: from.UserID,
+			ToUserID:   losers[perm[i]].UserID,
+			CouponCode: from.CouponCode,
+		})
+	}
+
+	applied, err := s.repo.ReallocateCoupons(c, repository.ReallocateCouponsInput{
+		CampaignID:    p.CampaignID,
+		Reallocations: reallocations,
+		Rerun:         p.Force,
+	})
+	if err == repository.ErrAlreadyReallocated {
+		c.Errorw("reallocate coupons failed", ctx.Err(ErrAlreadyReallocated))
+		return nil, ErrAlreadyReallocated
+	} else if err != nil {
+		c.Errorw("reallocate coupons failed", ctx.Err(err))
+		return nil, err
+	}
+
+	for _, a := range applied {
+		c.Infow("coupon reallocated", "from_user_id", a.FromUserID, "to_user_id", a.ToUserID)
+		s.audit(c, p.CampaignID, a.FromUserID, AuditActionCouponReallocate,
+			ctx.M{"coupon_status": CouponStatusUnclaimed},
+			ctx.M{"coupon_status": CouponStatusRevoked, "to_user_id": a.ToUserID})
+		s.audit(c, p.CampaignID, a.ToUserID, AuditActionCouponReallocate,
+			ctx.M{"coupon_status": CouponStatusNone},
+			ctx.M{"coupon_status": CouponStatusUnclaimed, "from_user_id": a.FromUserID})
+	}
+	winnersIssued.WithLabelValues(winnerSourceReallocation).Add(float64(len(applied)))
+	c.Infow("reallocation finished", "unclaimed", len(unclaimed), "losers", len(losers), "reallocated", len(applied), "force", p.Force)
+	s.audit(c, p.CampaignID, "", AuditActionCampaignReallocate,
+		ctx.M{"reallocated_at": campaign.ReallocatedAt},
+		ctx.M{"unclaimed": len(unclaimed), "reallocated": len(applied), "force": p.Force})
+
+	return &Reallocation{
+		CampaignID:  p.CampaignID,
+		Unclaimed:   len(unclaimed),
+		Reallocated: len(applied),
+	}, nil
+}
+
+func (s campaignService) GetProof(c ctx.CTX, p GetCampaignProofInput) (*CampaignProof, error) {
+	c, span := c.StartSpan("campaignService.GetProof", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	campaign, err := s.getCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("get campaign proof failed", ctx.Err(err))
+		return nil, err
+	}
+	if campaign.DrawMode != DrawModeCommitReveal {
+		return nil, ErrNoDrawProof
+	}
+
+	res := CampaignProof{
+		CampaignID: campaign.ID,
+		SeedHash:   campaign.SeedHash,
+		WinRatio:   campaign.WinRatio,
+		Threshold:  lottery.Threshold(campaign.WinRatio),
+		RevealAt:   campaign.GrabEndAt,
+	}
+	// 搶購時間結束後才公開 seed，之前公開的話可以預測結果
+	if timeNow().Unix() >= campaign.GrabEndAt {
+		res.Seed = string(campaign.Seed)
+	}
+	return &res, nil
+}
+
+// draw decides whether the user wins the campaign at reservation
+func (s campaignService) draw(campaign *repository.Campaign, userID string) (bool, error) {
+	if campaign.DrawMode == DrawModeKeyed || campaign.DrawMode == DrawModeCommitReveal {
+		return lottery.Won(campaign.Seed, campaign.ID, userID, lottery.Threshold(campaign.WinRatio))
+	}
+
+	// 取餘數只能表示 1/n 的機率，其他的 win ratio 和 keyed draw 一樣和 threshold 比較
+	winRatio := s.winRatio(campaign)
+	n := math.Round(1 / winRatio)
+	if math.Abs(n*winRatio-1) > 1e-9 {
+		return lottery.Won(hashDrawSeed, campaign.ID, userID, lottery.Threshold(winRatio))
+	}
+
+	// 舊的 campaign 根據 campaign_id 和 user_id 來決定 user 能不能拿到 coupon
+	v := campaign.ID
+	for _, b := range userID {
+		v += uint(b)
+	}
+	return v%uint(n) == 0, nil // 1/n 的機率可以拿到 coupon
+}
+
+// winRatio is the win ratio the campaign was drawn with, the campaigns created before the
+// commit-reveal draw didn't record it
+func (s campaignService) winRatio(campaign *repository.Campaign) float64 {
+	if campaign.WinRatio > 0 {
+		return campaign.WinRatio
+	}
+	return s.cfg.WinRatio
+}
+
+func (s campaignService) getCampaign(c ctx.CTX, id uint) (*repository.Campaign, error) {
+	res, err := s.repo.Get(c, repository.GetCampaignInput{ID: id})
+	if err == repository.ErrCampaignNotFound {
+		return nil, ErrCampaignNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s campaignService) getOpenCampaign(c ctx.CTX, id uint) (*repository.Campaign, error) {
+	res, err := s.getCampaign(c, id)
+	if err != nil {
+		return nil, err
+	}
+	if res.CancelledAt != 0 {
+		return nil, ErrCampaignCancelled
+	}
+	return res, nil
+}
+
+// validateWindows checks the windows don't go backwards and don't overlap with other campaigns
+func (s campaignService) validateWindows(c ctx.CTX, id uint, reservationStartAt, reservationEndAt, grabStartAt, grabEndAt int64) error {
+	if reservationStartAt >= reservationEndAt || reservationEndAt > grabStartAt || grabStartAt >= grabEndAt {
+		return ErrInvalidWindow
+	}
+
+	n, err := s.repo.CountOverlapping(c, repository.CountOverlappingCampaignsInput{
+		ExcludeID: id,
+		Start:     reservationStartAt,
+		End:       grabEndAt,
+	})
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return ErrOverlappingWindow
+	}
+	return nil
+}
+
+func inWindow(t time.Time, start, end int64) bool {
+	now := t.Unix()
+	return start <= now && now < end
+}
+
+func isReservationTime(c *repository.Campaign, t time.Time) bool {
+	return inWindow(t, c.ReservationStartAt, c.ReservationEndAt)
+}
+
+func isGrabTime(c *repository.Campaign, t time.Time) bool {
+	return inWindow(t, c.GrabStartAt, c.GrabEndAt)
+}
+
+// 重新分配時間在搶購時間結束後
+func (s campaignService) isReallocationTime(c *repository.Campaign, t time.Time) bool {
+	start := c.GrabEndAt
+	return inWindow(t, start, start+int64(s.cfg.ReallocationDuration/time.Second))
+}
+
+// 補搶時間在重新分配時間結束後
+func (s campaignService) isFollowUpGrabTime(c *repository.Campaign, t time.Time) bool {
+	start := c.GrabEndAt + int64(s.cfg.ReallocationDuration/time.Second)
+	return inWindow(t, start, start+int64(s.cfg.FollowUpGrabDuration/time.Second))
+}
+
+func (s campaignService) toCampaign(c *repository.Campaign) *Campaign {
+	scheduleKey := ""
+	if c.ScheduleKey != nil {
+		scheduleKey = *c.ScheduleKey
+	}
+	drawMode := c.DrawMode
+	if drawMode == "" {
+		drawMode = DrawModeHash
+	}
+	endAt := c.GrabEndAt
+	if c.ReallocateUnclaimed {
+		endAt += int64((s.cfg.ReallocationDuration + s.cfg.FollowUpGrabDuration) / time.Second)
+	}
+	return &Campaign{
+		ID:                  c.ID,
+		Created:             c.Created,
+		Updated:             c.Updated,
+		ReservationStartAt:  c.ReservationStartAt,
+		ReservationEndAt:    c.ReservationEndAt,
+		GrabStartAt:         c.GrabStartAt,
+		GrabEndAt:           c.GrabEndAt,
+		ReallocateUnclaimed: c.ReallocateUnclaimed,
+		ReallocatedAt:       c.ReallocatedAt,
+		CancelledAt:         c.CancelledAt,
+		ScheduleKey:         scheduleKey,
+		DrawMode:            drawMode,
+		SeedHash:            c.SeedHash,
+		EndAt:               endAt,
+	}
+}
+
+func toCouponReservation(r *repository.CouponReservation) *CouponReservation {
+	return &CouponReservation{
+		CampaignID:    r.CampaignID,
+		UserID:        r.UserID,
+		CouponCode:    r.CouponCode,
+		Created:       r.Created,
+		ClaimedAt:     r.ClaimedAt,
+		RedeemedAt:    r.RedeemedAt,
+		ReallocatedAt: r.ReallocatedAt,
+		WonDraw:       r.WonDraw,
+		CouponStatus:  couponStatus(r),
+	}
+}
+
+func couponStatus(r *repository.CouponReservation) CouponStatus {
+	switch {
+	case r.CouponCode == "" && r.ReallocatedAt != 0:
+		// 沒有在搶購時間領取，coupon 被重新分配給其他用戶
+		return CouponStatusRevoked
+	case r.CouponCode == "":
+		return CouponStatusNone
+	case r.RedeemedAt != 0:
+		return CouponStatusRedeemed
+	case r.ClaimedAt != 0:
+		return CouponStatusClaimed
+	default:
+		return CouponStatusUnclaimed
+	}
+}
@@ -1,12 +1,15 @@
 package service
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/asymptoter/tonx-take-home-test/internal/repository"
 	"github.com/asymptoter/tonx-take-home-test/internal/repository/mocks"
 	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+	"github.com/asymptoter/tonx-take-home-test/pkg/lottery"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
@@ -26,7 +29,10 @@ func (s *campaignServiceSuite) SetupSuite() {
 	s.ctx = ctx.Background()
 
 	s.repo = mocks.NewCampaignRepository(s.T())
-	s.service = NewCampaignService(s.ctx, s.repo)
+	s.service = NewCampaignService(s.ctx, s.repo, DefaultConfig())
+
+	// 稽核紀錄由各個測試用 AssertCalled 檢查
+	s.repo.On("CreateAuditLog", mockCTX, mock.Anything).Return(&repository.AuditLog{}, nil).Maybe()
 }
 
 func (s *campaignServiceSuite) TearDownSuite() {
@@ -38,20 +44,218 @@ func (s *campaignServiceSuite) SetupTest() {
 	timeNow = func() time.Time {
 		return time.Date(2024, 8, 26, 22, 55, 0, 0, loc)
 	}
+	newSeed = func() (lottery.Seed, error) {
+		return mockSeed, nil
+	}
+}
+
+// mockCampaign mocks the campaign with the default windows of 2024-08-26
+func (s *campaignServiceSuite) mockCampaign(campaignID uint) *repository.Campaign {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	campaign := &repository.Campaign{
+		ID:                 campaignID,
+		ReservationStartAt: time.Date(2024, 8, 26, 22, 55, 0, 0, loc).Unix(),
+		ReservationEndAt:   time.Date(2024, 8, 26, 22, 59, 0, 0, loc).Unix(),
+		GrabStartAt:        time.Date(2024, 8, 26, 23, 0, 0, 0, loc).Unix(),
+		GrabEndAt:          time.Date(2024, 8, 26, 23, 1, 0, 0, loc).Unix(),
+	}
+	s.repo.On("Get", mockCTX, repository.GetCampaignInput{ID: campaignID}).Return(campaign, nil).Once()
+	return campaign
 }
 
 func (s *campaignServiceSuite) TestCreate() {
 	campaignID := uint(1)
 	now := time.Now().Unix()
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	input := repository.CreateCampaignInput{
+		ReservationStartAt: time.Date(2024, 8, 26, 22, 55, 0, 0, loc).Unix(),
+		ReservationEndAt:   time.Date(2024, 8, 26, 22, 59, 0, 0, loc).Unix(),
+		GrabStartAt:        time.Date(2024, 8, 26, 23, 0, 0, 0, loc).Unix(),
+		GrabEndAt:          time.Date(2024, 8, 26, 23, 1, 0, 0, loc).Unix(),
+		DrawMode:           DrawModeKeyed,
+		WinRatio:           DefaultConfig().WinRatio,
+		SeedHash:           mockSeedHash,
+		Seed:               mockSeed,
+	}
 	mockCampaign := &repository.Campaign{
-		ID:      campaignID,
-		Created: now,
+		ID:                 campaignID,
+		Created:            now,
+		ReservationStartAt: input.ReservationStartAt,
+		ReservationEndAt:   input.ReservationEndAt,
+		GrabStartAt:        input.GrabStartAt,
+		GrabEndAt:          input.GrabEndAt,
 	}
-	s.repo.On("Create", mockCTX, repository.CreateCampaignInput{}).Return(mockCampaign, nil).Once()
+	s.repo.On("CountOverlapping", mockCTX, repository.CountOverlappingCampaignsInput{
+		Start: input.ReservationStartAt,
+		End:   input.GrabEndAt,
+	}).Return(int64(0), nil).Once()
+	s.repo.On("Create", mockCTX, input).Return(mockCampaign, nil).Once()
 	res, err := s.service.Create(s.ctx, CreateCampaignInput{})
 	s.NoError(err)
 	s.Equal(campaignID, res.ID)
 	s.Equal(now, res.Created)
+	s.Equal(input.ReservationStartAt, res.ReservationStartAt)
+}
+
+func (s *campaignServiceSuite) TestCreateWithExistingScheduleKey() {
+	scheduleKey := "daily:2024-08-26:2300"
+	s.repo.On("GetByScheduleKey", mockCTX, repository.GetCampaignByScheduleKeyInput{
+		ScheduleKey: scheduleKey,
+	}).Return(&repository.Campaign{ID: 3, ScheduleKey: &scheduleKey}, nil).Once()
+
+	res, err := s.service.Create(s.ctx, CreateCampaignInput{ScheduleKey: scheduleKey})
+	s.NoError(err)
+	s.Equal(uint(3), res.ID)
+	s.Equal(scheduleKey, res.ScheduleKey)
+}
+
+func (s *campaignServiceSuite) TestCreateWithInvalidWindowError() {
+	_, err := s.service.Create(s.ctx, CreateCampaignInput{
+		ReservationStartAt: 200,
+		ReservationEndAt:   100,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	})
+	s.Equal(ErrInvalidWindow, err)
+}
+
+func (s *campaignServiceSuite) TestCreateWithOverlappingWindowError() {
+	input := CreateCampaignInput{
+		ReservationStartAt: 100,
+		ReservationEndAt:   200,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	}
+	s.repo.On("CountOverlapping", mockCTX, repository.CountOverlappingCampaignsInput{
+		Start: input.ReservationStartAt,
+		End:   input.GrabEndAt,
+	}).Return(int64(1), nil).Once()
+
+	_, err := s.service.Create(s.ctx, input)
+	s.Equal(ErrOverlappingWindow, err)
+}
+
+func (s *campaignServiceSuite) TestUpdate() {
+	campaignID := uint(7)
+	campaign := s.mockCampaign(campaignID)
+	campaign.ReservationStartAt = timeNow().Add(time.Hour).Unix()
+
+	input := UpdateCampaignInput{
+		ID:                 campaignID,
+		ReservationStartAt: timeNow().Add(2 * time.Hour).Unix(),
+		ReservationEndAt:   timeNow().Add(2*time.Hour + 4*time.Minute).Unix(),
+		GrabStartAt:        timeNow().Add(2*time.Hour + 5*time.Minute).Unix(),
+		GrabEndAt:          timeNow().Add(2*time.Hour + 6*time.Minute).Unix(),
+	}
+	s.repo.On("CountOverlapping", mockCTX, repository.CountOverlappingCampaignsInput{
+		ExcludeID: campaignID,
+		Start:     input.ReservationStartAt,
+		End:       input.GrabEndAt,
+	}).Return(int64(0), nil).Once()
+	s.repo.On("Update", mockCTX, repository.UpdateCampaignInput{
+		ID:                 campaignID,
+		Now:                timeNow().Unix(),
+		ReservationStartAt: input.ReservationStartAt,
+		ReservationEndAt:   input.ReservationEndAt,
+		GrabStartAt:        input.GrabStartAt,
+		GrabEndAt:          input.GrabEndAt,
+	}).Return(&repository.Campaign{
+		ID:                 campaignID,
+		ReservationStartAt: input.ReservationStartAt,
+	}, nil).Once()
+
+	res, err := s.service.Update(s.ctx, input)
+	s.NoError(err)
+	s.Equal(input.ReservationStartAt, res.ReservationStartAt)
+}
+
+func (s *campaignServiceSuite) TestUpdateWithStartedCampaignError() {
+	campaignID := uint(8)
+	s.mockCampaign(campaignID)
+
+	_, err := s.service.Update(s.ctx, UpdateCampaignInput{
+		ID:                 campaignID,
+		ReservationStartAt: timeNow().Add(2 * time.Hour).Unix(),
+		ReservationEndAt:   timeNow().Add(3 * time.Hour).Unix(),
+		GrabStartAt:        timeNow().Add(4 * time.Hour).Unix(),
+		GrabEndAt:          timeNow().Add(5 * time.Hour).Unix(),
+	})
+	s.Equal(ErrCampaignStarted, err)
+}
+
+func (s *campaignServiceSuite) TestCancel() {
+	campaignID := uint(9)
+	campaign := s.mockCampaign(campaignID)
+	cancelled := *campaign
+	cancelled.CancelledAt = timeNow().Unix()
+	s.repo.On("Cancel", mockCTX, repository.CancelCampaignInput{ID: campaignID}).Return(&cancelled, nil).Once()
+
+	res, err := s.service.Cancel(s.ctx.WithActor("admin:alice"), CancelCampaignInput{ID: campaignID})
+	s.NoError(err)
+	s.Equal(cancelled.CancelledAt, res.CancelledAt)
+	s.repo.AssertCalled(s.T(), "CreateAuditLog", mockCTX, mock.MatchedBy(func(p repository.CreateAuditLogInput) bool {
+		return p.CampaignID == campaignID &&
+			p.Actor == "admin:alice" &&
+			p.Action == string(AuditActionCampaignCancel) &&
+			strings.Contains(p.Before, `"cancelled_at":0`) &&
+			strings.Contains(p.After, fmt.Sprintf(`"cancelled_at":%d`, cancelled.CancelledAt))
+	}))
+}
+
+func (s *campaignServiceSuite) TestListAuditLogs() {
+	s.repo.On("ListAuditLogs", mockCTX, repository.ListAuditLogsInput{
+		UserID: "user_id_1",
+		Limit:  3,
+	}).Return([]repository.AuditLog{
+		{ID: 5, UserID: "user_id_1", Action: string(AuditActionCouponClaim)},
+		{ID: 4, UserID: "user_id_1", Action: string(AuditActionReservationCreate)},
+		{ID: 2, UserID: "user_id_1", Action: string(AuditActionReservationCreate)},
+	}, nil).Once()
+
+	res, err := s.service.ListAuditLogs(s.ctx, ListAuditLogsInput{UserID: "user_id_1", Limit: 2})
+	s.NoError(err)
+	s.Len(res.AuditLogs, 2)
+	s.Equal(AuditActionCouponClaim, res.AuditLogs[0].Action)
+	s.Equal(uint(4), res.NextCursor)
+}
+
+func (s *campaignServiceSuite) TestList() {
+	s.repo.On("List", mockCTX, repository.ListCampaignsInput{Limit: 3}).Return([]repository.Campaign{
+		{ID: 3}, {ID: 2}, {ID: 1},
+	}, nil).Once()
+
+	res, err := s.service.List(s.ctx, ListCampaignsInput{Limit: 2})
+	s.NoError(err)
+	s.Len(res.Campaigns, 2)
+	s.Equal(uint(2), res.NextCursor)
+}
+
+func (s *campaignServiceSuite) TestCreateCouponReservationWithCancelledCampaignError() {
+	campaignID := uint(9)
+	s.mockCampaign(campaignID).CancelledAt = 1
+	rejected := reservationsRejected.WithLabelValues("campaign_cancelled").Value()
+
+	_, err := s.service.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     "user_id_1",
+	})
+	s.Equal(ErrCampaignCancelled, err)
+	s.Equal(rejected+1, reservationsRejected.WithLabelValues("campaign_cancelled").Value())
+}
+
+func (s *campaignServiceSuite) TestGet() {
+	campaign := s.mockCampaign(14)
+	res, err := s.service.Get(s.ctx, GetCampaignInput{ID: 14})
+	s.NoError(err)
+	s.Equal(campaign.GrabEndAt, res.EndAt)
+
+	// 重新分配時，campaign 在補搶時間後結束
+	s.mockCampaign(14).ReallocateUnclaimed = true
+	res, err = s.service.Get(s.ctx, GetCampaignInput{ID: 14})
+	s.NoError(err)
+	s.Equal(campaign.GrabEndAt+120, res.EndAt)
 }
 
 func (s *campaignServiceSuite) TestGetLatest() {
@@ -70,6 +274,18 @@ func (s *campaignServiceSuite) TestGetLatest() {
 	s.Equal(now, res.Created)
 }
 
+func (s *campaignServiceSuite) TestGetLatestWithGrabEnded() {
+	now := time.Unix(1724684460, 0)
+	timeNow = func() time.Time {
+		return now
+	}
+	s.repo.On("GetLatest", mockCTX, repository.GetLatestCampaignInput{GrabEndedBefore: now.Unix()}).Return(&repository.Campaign{ID: 2}, nil).Once()
+
+	res, err := s.service.GetLatest(s.ctx, GetLatestCampaignInput{GrabEnded: true})
+	s.NoError(err)
+	s.Equal(uint(2), res.ID)
+}
+
 func (s *campaignServiceSuite) TestCreateCouponReservationWithNonemptyCouponCode() {
 	campaignID := uint(1)
 	userID := "user_id_4"
@@ -82,12 +298,17 @@ func (s *campaignServiceSuite) TestCreateCouponReservationWithNonemptyCouponCode
 		UserID:     userID,
 		CouponCode: mockCouponCode,
 	}
+	s.mockCampaign(campaignID)
 	s.repo.On("CreateCouponReservation", mockCTX, repository.CreateCouponReservationInput{
 		CampaignID: campaignID,
 		UserID:     userID,
 		CouponCode: mockCouponCode,
+		WonDraw:    true,
 	}).Return(couponReservation, nil).Once()
 
+	accepted := reservationsAccepted.WithLabelValues().Value()
+	winners := winnersIssued.WithLabelValues(winnerSourceDraw).Value()
+
 	createCouponReservationInput := CreateCouponReservationInput{
 		CampaignID: campaignID,
 		UserID:     userID,
@@ -97,6 +318,8 @@ func (s *campaignServiceSuite) TestCreateCouponReservationWithNonemptyCouponCode
 	s.Equal(campaignID, res.CampaignID)
 	s.Equal(userID, res.UserID)
 	s.Equal(mockCouponCode, res.CouponCode)
+	s.Equal(accepted+1, reservationsAccepted.WithLabelValues().Value())
+	s.Equal(winners+1, winnersIssued.WithLabelValues(winnerSourceDraw).Value())
 }
 
 func (s *campaignServiceSuite) TestCreateCouponReservationWithEmptyCouponCode() {
@@ -111,6 +334,7 @@ func (s *campaignServiceSuite) TestCreateCouponReservationWithEmptyCouponCode()
 		UserID:     userID,
 		CouponCode: mockCouponCode,
 	}
+	s.mockCampaign(campaignID)
 	s.repo.On("CreateCouponReservation", mockCTX, repository.CreateCouponReservationInput{
 		CampaignID: campaignID,
 		UserID:     userID,
@@ -137,6 +361,7 @@ func (s *campaignServiceSuite) TestCreateCouponReservationWithInvalidResercation
 	campaignID := uint(1)
 	userID := "user_id_4"
 
+	s.mockCampaign(campaignID)
 	createCouponReservationInput := CreateCouponReservationInput{
 		CampaignID: campaignID,
 		UserID:     userID,
@@ -170,6 +395,652 @@ func (s *campaignServiceSuite) TestGetCouponReservation() {
 	s.Equal(mockCouponCode, res.CouponCode)
 }
 
+func (s *campaignServiceSuite) TestClaimCouponReservation() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 0, 10, 0, loc)
+	}
+	campaignID := uint(1)
+	userID := "user_id_4"
+	claim := &repository.CouponClaim{
+		Reservation: repository.CouponReservation{
+			CampaignID: campaignID,
+			UserID:     userID,
+			CouponCode: "coupon_code",
+			ClaimedAt:  timeNow().Unix(),
+		},
+	}
+	s.mockCampaign(campaignID)
+	s.repo.On("ClaimCouponReservation", mockCTX, repository.ClaimCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+	}).Return(claim, nil).Once()
+
+	c := s.ctx.WithActor("user:" + userID).WithRequestID("request_id_claim")
+	res, err := s.service.ClaimCouponReservation(c, ClaimCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+	})
+	s.NoError(err)
+	s.False(res.AlreadyClaimed)
+	s.Equal("coupon_code", res.Reservation.CouponCode)
+	s.Equal(claim.Reservation.ClaimedAt, res.Reservation.ClaimedAt)
+	s.repo.AssertCalled(s.T(), "CreateAuditLog", mockCTX, repository.CreateAuditLogInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+		Actor:      "user:" + userID,
+		Action:     string(AuditActionCouponClaim),
+		Before:     `{"claimed_at":0,"coupon_status":"unclaimed","reallocated_at":0,"redeemed_at":0}`,
+		After:      `{"claimed_at":1724684410,"coupon_status":"claimed","reallocated_at":0,"redeemed_at":0}`,
+		RequestID:  "request_id_claim",
+	})
+}
+
+func (s *campaignServiceSuite) TestClaimCouponReservationAlreadyClaimed() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 2, 10, 0, loc)
+	}
+	campaignID := uint(1)
+	userID := "user_id_5"
+	claim := &repository.CouponClaim{
+		Reservation: repository.CouponReservation{
+			CampaignID: campaignID,
+			UserID:     userID,
+			CouponCode: "coupon_code",
+			ClaimedAt:  timeNow().Unix(),
+		},
+		AlreadyClaimed: true,
+	}
+	s.mockCampaign(campaignID).ReallocateUnclaimed = true
+	s.repo.On("ClaimCouponReservation", mockCTX, repository.ClaimCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+	}).Return(claim, nil).Once()
+
+	res, err := s.service.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: campaignID,
+		UserID:     userID,
+	})
+	s.NoError(err)
+	s.True(res.AlreadyClaimed)
+	s.Equal("coupon_code", res.Reservation.CouponCode)
+}
+
+func (s *campaignServiceSuite) TestClaimCouponReservationWithNotFoundError() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 2, 10, 0, loc)
+	}
+	s.mockCampaign(1).ReallocateUnclaimed = true
+	s.repo.On("ClaimCouponReservation", mockCTX, repository.ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_6",
+	}).Return(nil, repository.ErrReservationNotFound).Once()
+
+	_, err = s.service.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_6",
+	})
+	s.Equal(ErrReservationNotFound, err)
+}
+
+func (s *campaignServiceSuite) TestClaimCouponReservationWithInvalidGrabTimeError() {
+	s.mockCampaign(1)
+	_, err := s.service.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_1",
+	})
+	s.Equal(ErrNotGrabTime, err)
+
+	// 沒有重新分配的 campaign 沒有補搶時間
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 2, 10, 0, loc)
+	}
+	s.mockCampaign(1)
+	_, err = s.service.ClaimCouponReservation(s.ctx, ClaimCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_1",
+	})
+	s.Equal(ErrNotGrabTime, err)
+}
+
+func (s *campaignServiceSuite) TestGetStats() {
+	campaignID := uint(1)
+	campaign := s.mockCampaign(campaignID)
+	campaign.WinRatio = 0.25
+	start := campaign.ReservationStartAt
+	s.repo.On("GetStats", mockCTX, repository.GetCampaignStatsInput{CampaignID: campaignID}).Return(&repository.CampaignStats{
+		Reservations: 300,
+		Winners:      57,
+		Claimed:      50,
+		Redeemed:     10,
+		ReservationsPerMinute: []repository.MinuteCount{
+			{Minute: start, Count: 200},
+			{Minute: start + 120, Count: 100},
+		},
+	}, nil).Once()
+
+	res, err := s.service.GetStats(s.ctx, GetCampaignStatsInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(0.19, res.WinRatio)
+	s.Equal(0.25, res.TargetWinRatio)
+	// 預約時間 22:55 ~ 22:59 沒有預約的 minute 補 0
+	s.Equal([]MinuteCount{
+		{Minute: start, Count: 200},
+		{Minute: start + 60, Count: 0},
+		{Minute: start + 120, Count: 100},
+		{Minute: start + 180, Count: 0},
+	}, res.ReservationsPerMinute)
+
+	// 沒有記錄 win ratio 的舊 campaign 使用設定的值
+	s.mockCampaign(2)
+	s.repo.On("GetStats", mockCTX, repository.GetCampaignStatsInput{CampaignID: 2}).Return(&repository.CampaignStats{}, nil).Once()
+	res, err = s.service.GetStats(s.ctx, GetCampaignStatsInput{CampaignID: 2})
+	s.NoError(err)
+	s.Equal(DefaultConfig().WinRatio, res.TargetWinRatio)
+}
+
+func (s *campaignServiceSuite) TestGetStatsWithCampaignNotFoundError() {
+	s.repo.On("Get", mockCTX, repository.GetCampaignInput{ID: 9}).Return(nil, repository.ErrCampaignNotFound).Once()
+
+	_, err := s.service.GetStats(s.ctx, GetCampaignStatsInput{CampaignID: 9})
+	s.Equal(ErrCampaignNotFound, err)
+}
+
+func (s *campaignServiceSuite) TestRedeemCouponReservationWithNotRedeemableError() {
+	input := repository.RedeemCouponReservationInput{
+		CampaignID: 1,
+		UserID:     "user_id_1",
+	}
+	s.repo.On("RedeemCouponReservation", mockCTX, input).Return(nil, repository.ErrNotRedeemable).Once()
+
+	_, err := s.service.RedeemCouponReservation(s.ctx, RedeemCouponReservationInput{
+		CampaignID: input.CampaignID,
+		UserID:     input.UserID,
+	})
+	s.Equal(ErrNotRedeemable, err)
+}
+
+func (s *campaignServiceSuite) TestListUserCouponReservations() {
+	userID := "user_id_1"
+	s.repo.On("ListUserCouponReservations", mockCTX, repository.ListUserCouponReservationsInput{
+		UserID: userID,
+		Limit:  3,
+	}).Return([]repository.CouponReservation{
+		{CampaignID: 3, UserID: userID, CouponCode: "coupon_code", ClaimedAt: 1},
+		{CampaignID: 2, UserID: userID, ReallocatedAt: 1},
+		{CampaignID: 1, UserID: userID},
+	}, nil).Once()
+
+	res, err := s.service.ListUserCouponReservations(s.ctx, ListUserCouponReservationsInput{
+		UserID: userID,
+		Limit:  2,
+	})
+	s.NoError(err)
+	s.Len(res.Reservations, 2)
+	s.Equal(CouponStatusClaimed, res.Reservations[0].CouponStatus)
+	s.Equal(CouponStatusRevoked, res.Reservations[1].CouponStatus)
+	s.Equal(uint(2), res.NextCursor)
+}
+
+func (s *campaignServiceSuite) TestExportCouponReservations() {
+	campaignID := uint(10)
+	s.mockCampaign(campaignID)
+	s.repo.On("ScanCouponReservations", mockCTX, repository.ScanCouponReservationsInput{
+		CampaignID:  campaignID,
+		WinnersOnly: true,
+	}, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(2).(func(*repository.CouponReservation) error)
+		s.NoError(fn(&repository.CouponReservation{CampaignID: campaignID, UserID: "user_id_1", CouponCode: "coupon_code_1"}))
+	}).Return(nil).Once()
+
+	var res []CouponReservation
+	err := s.service.ExportCouponReservations(s.ctx, ExportCouponReservationsInput{
+		CampaignID:  campaignID,
+		WinnersOnly: true,
+	}, func(r CouponReservation) error {
+		res = append(res, r)
+		return nil
+	})
+	s.NoError(err)
+	s.Len(res, 1)
+	s.Equal(CouponStatusUnclaimed, res[0].CouponStatus)
+}
+
+func (s *campaignServiceSuite) TestReallocateCoupons() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 1, 0, 0, loc)
+	}
+	randPerm = func(n int) []int {
+		res := make([]int, n)
+		for i := range res {
+			res[i] = n - 1 - i
+		}
+		return res
+	}
+	campaignID := uint(2)
+	s.mockCampaign(campaignID).ReallocateUnclaimed = true
+
+	winner, loser, claimed := true, false, false
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID: campaignID,
+		Winner:     &winner,
+		Claimed:    &claimed,
+		WonDraw:    &winner,
+	}).Return([]repository.CouponReservation{
+		{CampaignID: campaignID, UserID: "user_id_1", CouponCode: "coupon_code_1"},
+	}, nil).Once()
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID:  campaignID,
+		Winner:      &loser,
+		WonDraw:     &loser,
+		Reallocated: &loser,
+	}).Return([]repository.CouponReservation{
+		{CampaignID: campaignID, UserID: "user_id_2"},
+		{CampaignID: campaignID, UserID: "user_id_3"},
+	}, nil).Once()
+
+	reallocations := []repository.CouponReallocation{
+		{FromUserID: "user_id_1", ToUserID: "user_id_3", CouponCode: "coupon_code_1"},
+	}
+	s.repo.On("ReallocateCoupons", mockCTX, repository.ReallocateCouponsInput{
+		CampaignID:    campaignID,
+		Reallocations: reallocations,
+	}).Return(reallocations, nil).Once()
+
+	res, err := s.service.ReallocateCoupons(s.ctx, ReallocateCouponsInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(1, res.Unclaimed)
+	s.Equal(1, res.Reallocated)
+}
+
+func (s *campaignServiceSuite) TestReallocateCouponsWithMoreUnclaimedThanLosers() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 1, 0, 0, loc)
+	}
+	randPerm = func(n int) []int {
+		res := make([]int, n)
+		for i := range res {
+			res[i] = n - 1 - i
+		}
+		return res
+	}
+	campaignID := uint(2)
+	s.mockCampaign(campaignID).ReallocateUnclaimed = true
+
+	winner, loser, claimed := true, false, false
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID: campaignID,
+		Winner:     &winner,
+		Claimed:    &claimed,
+		WonDraw:    &winner,
+	}).Return([]repository.CouponReservation{
+		{CampaignID: campaignID, UserID: "user_id_1", CouponCode: "coupon_code_1"},
+		{CampaignID: campaignID, UserID: "user_id_2", CouponCode: "coupon_code_2"},
+		{CampaignID: campaignID, UserID: "user_id_3", CouponCode: "coupon_code_3"},
+	}, nil).Once()
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID:  campaignID,
+		Winner:      &loser,
+		WonDraw:     &loser,
+		Reallocated: &loser,
+	}).Return([]repository.CouponReservation{
+		{CampaignID: campaignID, UserID: "user_id_4"},
+		{CampaignID: campaignID, UserID: "user_id_5"},
+	}, nil).Once()
+
+	// 重新分配的 coupon 也是隨機挑選，不是 user_id 排在前面的
+	reallocations := []repository.CouponReallocation{
+		{FromUserID: "user_id_3", ToUserID: "user_id_5", CouponCode: "coupon_code_3"},
+		{FromUserID: "user_id_2", ToUserID: "user_id_4", CouponCode: "coupon_code_2"},
+	}
+	s.repo.On("ReallocateCoupons", mockCTX, repository.ReallocateCouponsInput{
+		CampaignID:    campaignID,
+		Reallocations: reallocations,
+	}).Return(reallocations, nil).Once()
+
+	res, err := s.service.ReallocateCoupons(s.ctx, ReallocateCouponsInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(3, res.Unclaimed)
+	s.Equal(2, res.Reallocated)
+}
+
+func (s *campaignServiceSuite) TestReallocateCouponsWithInvalidReallocationTimeError() {
+	s.mockCampaign(1)
+	_, err := s.service.ReallocateCoupons(s.ctx, ReallocateCouponsInput{CampaignID: 1})
+	s.Equal(ErrNotReallocationTime, err)
+}
+
+func (s *campaignServiceSuite) TestReallocateCouponsWithForce() {
+	campaignID := uint(4)
+	campaign := s.mockCampaign(campaignID)
+	campaign.ReallocateUnclaimed = true
+	campaign.ReallocatedAt = 100
+
+	winner, loser, claimed := true, false, false
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID: campaignID,
+		Winner:     &winner,
+		Claimed:    &claimed,
+		WonDraw:    &winner,
+	}).Return([]repository.CouponReservation{}, nil).Once()
+	s.repo.On("ListCouponReservations", mockCTX, repository.ListCouponReservationsInput{
+		CampaignID:  campaignID,
+		Winner:      &loser,
+		WonDraw:     &loser,
+		Reallocated: &loser,
+	}).Return([]repository.CouponReservation{}, nil).Once()
+	s.repo.On("ReallocateCoupons", mockCTX, repository.ReallocateCouponsInput{
+		CampaignID:    campaignID,
+		Reallocations: []repository.CouponReallocation{},
+		Rerun:         true,
+	}).Return([]repository.CouponReallocation{}, nil).Once()
+
+	res, err := s.service.ReallocateCoupons(s.ctx, ReallocateCouponsInput{CampaignID: campaignID, Force: true})
+	s.NoError(err)
+	s.Equal(campaignID, res.CampaignID)
+	s.Equal(0, res.Reallocated)
+}
+
+func (s *campaignServiceSuite) TestReallocateCouponsWithDisabledCampaignError() {
+	loc, err := time.LoadLocation("Asia/Taipei")
+	s.NoError(err)
+	timeNow = func() time.Time {
+		return time.Date(2024, 8, 26, 23, 1, 0, 0, loc)
+	}
+	campaignID := uint(3)
+	s.mockCampaign(campaignID)
+
+	_, err = s.service.ReallocateCoupons(s.ctx, ReallocateCouponsInput{CampaignID: campaignID})
+	s.Equal(ErrReallocationDisabled, err)
+}
+
+// mockFairnessReservations mocks 1600 reservations over 27 minutes, user ids start with 16 hex digits
+// evenly and every 5th reservation wins unless won is given.
+func (s *campaignServiceSuite) mockFairnessReservations(campaignID uint, won func(i int, userID string) bool) {
+	s.repo.On("ScanCouponReservations", mockCTX, repository.ScanCouponReservationsInput{
+		CampaignID: campaignID,
+	}, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(2).(func(*repository.CouponReservation) error)
+		for i := 0; i < 1600; i++ {
+			r := &repository.CouponReservation{
+				CampaignID: campaignID,
+				UserID:     fmt.Sprintf("%x-user-%d", i%16, i),
+				Created:    1724684100 + int64(i),
+			}
+			if won == nil && i%5 == 0 || won != nil && won(i, r.UserID) {
+				r.CouponCode = fmt.Sprintf("coupon_code_%d", i)
+				r.WonDraw = true
+			}
+			s.NoError(fn(r))
+		}
+	}).Return(nil).Once()
+}
+
+func (s *campaignServiceSuite) TestGetFairnessReport() {
+	campaignID := uint(11)
+	s.mockCampaign(campaignID)
+	s.mockFairnessReservations(campaignID, nil)
+
+	res, err := s.service.GetFairnessReport(s.ctx, GetFairnessReportInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(int64(1600), res.Reservations)
+	s.Equal(int64(320), res.Winners)
+	s.InDelta(320, res.ExpectedWinners, 1e-9)
+	s.Less(res.WinRatioLow, 0.2)
+	s.Greater(res.WinRatioHigh, 0.2)
+	s.False(res.Flagged)
+
+	s.Len(res.Checks, 2)
+	s.Equal(FairnessCheckUserIDPrefix, res.Checks[0].Name)
+	s.Len(res.Checks[0].Groups, 16)
+	s.Equal("0", res.Checks[0].Groups[0].Key)
+	s.Equal(15, res.Checks[0].DegreesOfFreedom)
+	s.InDelta(1, res.Checks[0].PValue, 1e-9)
+	s.Equal(FairnessCheckReservationMinute, res.Checks[1].Name)
+	// 最後一分鐘只有 40 筆預約，期望的中獎數仍有 8 筆，不會併入 other
+	s.Len(res.Checks[1].Groups, 27)
+	s.False(res.Checks[1].Flagged)
+}
+
+func (s *campaignServiceSuite) TestGetFairnessReportWithReallocation() {
+	campaignID := uint(12)
+	s.mockCampaign(campaignID)
+	s.repo.On("ScanCouponReservations", mockCTX, repository.ScanCouponReservationsInput{
+		CampaignID: campaignID,
+	}, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(2).(func(*repository.CouponReservation) error)
+		// 中獎者沒領取，coupon 重新分配給沒中獎的用戶，重跑後又分配給另一個用戶
+		s.NoError(fn(&repository.CouponReservation{UserID: "user_id_1", ReallocatedAt: 1, WonDraw: true}))
+		s.NoError(fn(&repository.CouponReservation{UserID: "user_id_2", ReallocatedAt: 2}))
+		s.NoError(fn(&repository.CouponReservation{UserID: "user_id_3", CouponCode: "coupon_code_1", ReallocatedAt: 2}))
+		s.NoError(fn(&repository.CouponReservation{UserID: "user_id_4"}))
+	}).Return(nil).Once()
+
+	res, err := s.service.GetFairnessReport(s.ctx, GetFairnessReportInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(int64(4), res.Reservations)
+	s.Equal(int64(1), res.Winners)
+}
+
+func (s *campaignServiceSuite) TestGetFairnessReportWithNonASCIIUserID() {
+	campaignID := uint(15)
+	s.mockCampaign(campaignID)
+	s.repo.On("ScanCouponReservations", mockCTX, repository.ScanCouponReservationsInput{
+		CampaignID: campaignID,
+	}, mock.Anything).Run(func(args mock.Arguments) {
+		fn := args.Get(2).(func(*repository.CouponReservation) error)
+		for i := 0; i < 200; i++ {
+			r := &repository.CouponReservation{
+				UserID: fmt.Sprintf("%s-user-%d", []string{"王", "陳"}[i%2], i),
+				// 每分鐘 20 筆預約
+				Created: 1724684100 + int64(i*3),
+			}
+			r.WonDraw = i%5 < 2
+			s.NoError(fn(r))
+		}
+	}).Return(nil).Once()
+
+	res, err := s.service.GetFairnessReport(s.ctx, GetFairnessReportInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.Equal(FairnessCheckUserIDPrefix, res.Checks[0].Name)
+	s.Len(res.Checks[0].Groups, 2)
+	s.Equal("王", res.Checks[0].Groups[0].Key)
+	s.Equal("陳", res.Checks[0].Groups[1].Key)
+}
+
+func (s *campaignServiceSuite) TestGetFairnessReportWithBiasedPrefix() {
+	campaignID := uint(13)
+	s.mockCampaign(campaignID)
+	// user id 開頭為 a 的用戶全部中獎，其他的用戶少中獎讓總數不變
+	s.mockFairnessReservations(campaignID, func(i int, userID string) bool {
+		if strings.HasPrefix(userID, "a") {
+			return true
+		}
+		return i%5 == 0 && i%3 != 0
+	})
+
+	res, err := s.service.GetFairnessReport(s.ctx, GetFairnessReportInput{CampaignID: campaignID})
+	s.NoError(err)
+	s.True(res.Flagged)
+	s.True(res.Checks[0].Flagged)
+	s.Less(res.Checks[0].PValue, 0.01)
+	for _, g := range res.Checks[0].Groups {
+		s.Equal(g.Key == "a", g.Flagged, g.Key)
+	}
+}
+
+func (s *campaignServiceSuite) TestGetFairnessReportWithCampaignNotFoundError() {
+	s.repo.On("Get", mockCTX, repository.GetCampaignInput{ID: 14}).Return(nil, repository.ErrCampaignNotFound).Once()
+
+	_, err := s.service.GetFairnessReport(s.ctx, GetFairnessReportInput{CampaignID: 14})
+	s.Equal(ErrCampaignNotFound, err)
+}
+
+func (s *campaignServiceSuite) TestChiSquareSurvival() {
+	// 卡方分配表的 0.05 及 0.01 臨界值
+	s.InDelta(0.05, chiSquareSurvival(3.841, 1), 1e-4)
+	s.InDelta(0.01, chiSquareSurvival(6.635, 1), 1e-4)
+	s.InDelta(0.05, chiSquareSurvival(18.307, 10), 1e-4)
+	s.InDelta(0.01, chiSquareSurvival(44.314, 25), 1e-4)
+	s.Equal(1.0, chiSquareSurvival(0, 3))
+
+	low, high := wilsonInterval(20, 100, 1.96)
+	s.InDelta(0.1333, low, 1e-4)
+	s.InDelta(0.2888, high, 1e-4)
+}
+
+const (
+	mockSeed lottery.Seed = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	// sha256 of mockSeed
+	mockSeedHash = "630dcd2966c4336691125448bbb25b4ff412a49c732db2c8abc1b8581bd710dd"
+)
+
+func (s *campaignServiceSuite) TestCreateWithCommitReveal() {
+	cfg := DefaultConfig()
+	cfg.DrawMode = DrawModeCommitReveal
+	service := NewCampaignService(s.ctx, s.repo, cfg)
+
+	seedHash, err := lottery.Commit(mockSeed)
+	s.NoError(err)
+	input := repository.CreateCampaignInput{
+		ReservationStartAt: 100,
+		ReservationEndAt:   200,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+		DrawMode:           DrawModeCommitReveal,
+		WinRatio:           cfg.WinRatio,
+		SeedHash:           seedHash,
+		Seed:               mockSeed,
+	}
+	s.repo.On("CountOverlapping", mockCTX, repository.CountOverlappingCampaignsInput{Start: 100, End: 400}).Return(int64(0), nil).Once()
+	s.repo.On("Create", mockCTX, input).Return(&repository.Campaign{
+		ID:       5,
+		DrawMode: DrawModeCommitReveal,
+		WinRatio: cfg.WinRatio,
+		SeedHash: seedHash,
+		Seed:     mockSeed,
+	}, nil).Once()
+
+	res, err := service.Create(s.ctx, CreateCampaignInput{
+		ReservationStartAt: 100,
+		ReservationEndAt:   200,
+		GrabStartAt:        300,
+		GrabEndAt:          400,
+	})
+	s.NoError(err)
+	s.Equal(DrawModeCommitReveal, res.DrawMode)
+	s.Equal(seedHash, res.SeedHash)
+}
+
+func (s *campaignServiceSuite) TestHashDrawWinRatio() {
+	svc := s.service.(campaignService)
+	// 取餘數表示不了 0.3，中獎比例仍然接近 win ratio 而不是 1/3
+	for _, winRatio := range []float64{0.2, 0.3} {
+		campaign := &repository.Campaign{ID: 1, DrawMode: DrawModeHash, WinRatio: winRatio}
+		won := 0
+		for i := 0; i < 10000; i++ {
+			ok, err := svc.draw(campaign, fmt.Sprintf("user_id_%d", i))
+			s.NoError(err)
+			if ok {
+				won++
+			}
+		}
+		s.InDelta(winRatio, float64(won)/10000, 0.02)
+	}
+}
+
+func (s *campaignServiceSuite) TestCreateCouponReservationWithKeyedDraw() {
+	newUUIDString = func() string {
+		return "mock_coupon_code"
+	}
+	// win ratio 為 1 時一定中獎，接近 0 時一定不中獎
+	for _, tc := range []struct {
+		drawMode   string
+		winRatio   float64
+		couponCode string
+	}{
+		{DrawModeKeyed, 1, "mock_coupon_code"},
+		{DrawModeKeyed, 1e-12, ""},
+		{DrawModeCommitReveal, 1, "mock_coupon_code"},
+		{DrawModeCommitReveal, 1e-12, ""},
+		// hash 的 draw 也使用 campaign 的 win ratio
+		{DrawModeHash, 1, "mock_coupon_code"},
+		{DrawModeHash, 1e-12, ""},
+	} {
+		campaign := s.mockCampaign(11)
+		campaign.DrawMode = tc.drawMode
+		campaign.Seed = mockSeed
+		campaign.WinRatio = tc.winRatio
+		s.repo.On("CreateCouponReservation", mockCTX, repository.CreateCouponReservationInput{
+			CampaignID: 11,
+			UserID:     "user_id_1",
+			CouponCode: tc.couponCode,
+			WonDraw:    tc.couponCode != "",
+		}).Return(&repository.CouponReservation{CampaignID: 11, UserID: "user_id_1", CouponCode: tc.couponCode}, nil).Once()
+
+		res, err := s.service.CreateCouponReservation(s.ctx, CreateCouponReservationInput{
+			CampaignID: 11,
+			UserID:     "user_id_1",
+		})
+		s.NoError(err)
+		s.Equal(tc.couponCode, res.CouponCode)
+	}
+}
+
+func (s *campaignServiceSuite) TestGetProof() {
+	seedHash, err := lottery.Commit(mockSeed)
+	s.NoError(err)
+	mockProofCampaign := func() {
+		campaign := s.mockCampaign(12)
+		campaign.DrawMode = DrawModeCommitReveal
+		campaign.WinRatio = 0.5
+		campaign.SeedHash = seedHash
+		campaign.Seed = mockSeed
+	}
+
+	// 搶購時間結束前不公開 seed
+	mockProofCampaign()
+	res, err := s.service.GetProof(s.ctx, GetCampaignProofInput{CampaignID: 12})
+	s.NoError(err)
+	s.Equal(seedHash, res.SeedHash)
+	s.Empty(res.Seed)
+	s.Equal(uint64(1<<63), res.Threshold)
+
+	timeNow = func() time.Time {
+		return time.Unix(res.RevealAt, 0)
+	}
+	mockProofCampaign()
+	res, err = s.service.GetProof(s.ctx, GetCampaignProofInput{CampaignID: 12})
+	s.NoError(err)
+	s.Equal(string(mockSeed), res.Seed)
+	s.True(lottery.Verify(lottery.Seed(res.Seed), res.SeedHash))
+}
+
+func (s *campaignServiceSuite) TestGetProofWithoutCommitRevealError() {
+	// keyed 的 seed 永遠不公開
+	for _, drawMode := range []string{"", DrawModeKeyed} {
+		campaign := s.mockCampaign(13)
+		campaign.DrawMode = drawMode
+		campaign.Seed = mockSeed
+		timeNow = func() time.Time {
+			return time.Unix(campaign.GrabEndAt, 0)
+		}
+		_, err := s.service.GetProof(s.ctx, GetCampaignProofInput{CampaignID: 13})
+		s.Equal(ErrNoDrawProof, err)
+	}
+}
+
 func TestCampaignServiceSuite(t *testing.T) {
 	suite.Run(t, new(campaignServiceSuite))
 }
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/internal/repository"
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+const (
+	// fairnessZ is the z value of the 99% confidence interval of the win ratio
+	fairnessZ = 2.576
+	// fairnessSignificance is the p-value below which a distribution check is flagged
+	fairnessSignificance = 0.01
+	// fairnessGroupZ flags a single group deviating more than this many standard deviations
+	fairnessGroupZ = 3
+	// fairnessMinExpected is the expected winners and losers a group needs to be tested on its own,
+	// smaller groups are pooled into fairnessOtherGroup
+	fairnessMinExpected = 5
+
+	fairnessOtherGroup = "other"
+
+	FairnessCheckUserIDPrefix      = "user_id_prefix"
+	FairnessCheckReservationMinute = "reservation_minute"
+)
+
+// FairnessReport compares the draw result of a campaign with the win ratio it was drawn with, the one
+// in Config for the campaigns created before the ratio was recorded.
+// Winners are the users winning the draw at reservation, including the ones whose coupon was
+// reallocated, and excluding the ones receiving a reallocated coupon.
+type FairnessReport struct {
+	CampaignID      uint
+	Reservations    int64
+	Winners         int64
+	TargetWinRatio  float64
+	ExpectedWinners float64
+	WinRatio        float64
+	// 99% Wilson score interval of the win ratio, flagged if it doesn't contain TargetWinRatio
+	WinRatioLow  float64
+	WinRatioHigh float64
+	Flagged      bool
+	Checks       []FairnessCheck
+}
+
+// FairnessCheck is a chi-square test of whether the win ratio is the same across the groups
+type FairnessCheck struct {
+	Name             string
+	Groups           []FairnessGroup
+	ChiSquare        float64
+	DegreesOfFreedom int
+	PValue           float64
+	Flagged          bool
+}
+
+// FairnessGroup compares the winners of a group with the ones expected by the win ratio of the campaign
+type FairnessGroup struct {
+	Key          string
+	Reservations int64
+	Winners      int64
+	Expected     float64
+	ZScore       float64
+	Flagged      bool
+}
+
+// GetFairnessReportInput groups the user ids by their first PrefixLength runes, 1 if 0
+type GetFairnessReportInput struct {
+	CampaignID   uint
+	PrefixLength int
+}
+
+func (s campaignService) GetFairnessReport(c ctx.CTX, p GetFairnessReportInput) (*FairnessReport, error) {
+	c, span := c.StartSpan("campaignService.GetFairnessReport", "campaign_id", p.CampaignID)
+	defer span.End()
+
+	c = c.With("campaign_id", p.CampaignID)
+
+	campaign, err := s.getCampaign(c, p.CampaignID)
+	if err != nil {
+		c.Errorw("get fairness report failed", ctx.Err(err))
+		return nil, err
+	}
+	winRatio := s.winRatio(campaign)
+
+	prefixLength := p.PrefixLength
+	if prefixLength <= 0 {
+		prefixLength = 1
+	}
+
+	var reservations, winners int64
+	prefixes := map[string]*FairnessGroup{}
+	minutes := map[string]*FairnessGroup{}
+	input := repository.ScanCouponReservationsInput{CampaignID: p.CampaignID}
+	if err := s.repo.ScanCouponReservations(c, input, func(r *repository.CouponReservation) error {
+		won := r.WonDraw
+		reservations++
+		if won {
+			winners++
+		}
+
+		// 以字元切開頭，非 ASCII 的 user id 不會被切成不合法的 UTF-8
+		prefix := r.UserID
+		if runes := []rune(prefix); len(runes) > prefixLength {
+			prefix = string(runes[:prefixLength])
+		}
+		countGroup(prefixes, prefix, won)
+		countGroup(minutes, time.Unix(r.Created-r.Created%60, 0).Format(time.RFC3339), won)
+		return nil
+	}); err != nil {
+		c.Errorw("get fairness report failed", ctx.Err(err))
+		return nil, err
+	}
+
+	res := FairnessReport{
+		CampaignID:      p.CampaignID,
+		Reservations:    reservations,
+		Winners:         winners,
+		TargetWinRatio:  winRatio,
+		ExpectedWinners: float64(reservations) * winRatio,
+	}
+	if reservations != 0 {
+		res.WinRatio = float64(winners) / float64(reservations)
+		res.WinRatioLow, res.WinRatioHigh = wilsonInterval(winners, reservations, fairnessZ)
+		res.Flagged = winRatio < res.WinRatioLow || winRatio > res.WinRatioHigh
+	}
+	res.Checks = []FairnessCheck{
+		fairnessCheck(FairnessCheckUserIDPrefix, prefixes, reservations, winners),
+		fairnessCheck(FairnessCheckReservationMinute, minutes, reservations, winners),
+	}
+	for _, check := range res.Checks {
+		res.Flagged = res.Flagged || check.Flagged
+	}
+
+	if res.Flagged {
+		c.Warnw("unfair draw detected", "reservations", reservations, "winners", winners, "expected_winners", res.ExpectedWinners)
+	}
+	return &res, nil
+}
+
+func countGroup(groups map[string]*FairnessGroup, key string, won bool) {
+	g, ok := groups[key]
+	if !ok {
+		g = &FairnessGroup{Key: key}
+		groups[key] = g
+	}
+	g.Reservations++
+	if won {
+		g.Winners++
+	}
+}
+
+// fairnessCheck tests the groups against the overall win ratio of the campaign rather than the target,
+// so a campaign slightly off the target isn't flagged for every check.
+func fairnessCheck(name string, groups map[string]*FairnessGroup, reservations, winners int64) FairnessCheck {
+	check := FairnessCheck{
+		Name:   name,
+		Groups: []FairnessGroup{},
+		PValue: 1,
+	}
+	if reservations == 0 || winners == 0 || winners == reservations {
+		return check
+	}
+	ratio := float64(winners) / float64(reservations)
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var other FairnessGroup
+	for _, key := range keys {
+		g := groups[key]
+		if expected := float64(g.Reservations) * ratio; min(expected, float64(g.Reservations)-expected) < fairnessMinExpected {
+			other.Reservations += g.Reservations
+			other.Winners += g.Winners
+			continue
+		}
+		check.Groups = append(check.Groups, *g)
+	}
+	if other.Reservations != 0 {
+		other.Key = fairnessOtherGroup
+		check.Groups = append(check.Groups, other)
+	}
+
+	for i := range check.Groups {
+		g := &check.Groups[i]
+		g.Expected = float64(g.Reservations) * ratio
+		variance := g.Expected * (1 - ratio)
+		g.ZScore = (float64(g.Winners) - g.Expected) / math.Sqrt(variance)
+		g.Flagged = math.Abs(g.ZScore) > fairnessGroupZ && g.Key != fairnessOtherGroup
+		// 2xk 列聯表的卡方值，中獎及未中獎兩格合併後等於 z 的平方
+		check.ChiSquare += g.ZScore * g.ZScore
+		check.Flagged = check.Flagged || g.Flagged
+	}
+
+	check.DegreesOfFreedom = len(check.Groups) - 1
+	if check.DegreesOfFreedom > 0 {
+		check.PValue = chiSquareSurvival(check.ChiSquare, check.DegreesOfFreedom)
+		check.Flagged = check.Flagged || check.PValue < fairnessSignificance
+	}
+	return check
+}
+
+// wilsonInterval is the Wilson score interval of the ratio of k successes in n trials
+func wilsonInterval(k, n int64, z float64) (float64, float64) {
+	p := float64(k) / float64(n)
+	z2n := z * z / float64(n)
+	center := (p + z2n/2) / (1 + z2n)
+	margin := z / (1 + z2n) * math.Sqrt(p*(1-p)/float64(n)+z2n/(4*float64(n)))
+	return max(0, center-margin), min(1, center+margin)
+}
+
+// chiSquareSurvival is P(X >= x) of the chi-square distribution with df degrees of freedom
+func chiSquareSurvival(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return upperIncompleteGamma(float64(df)/2, x/2)
+}
+
+// upperIncompleteGamma is the regularized upper incomplete gamma function Q(a, x),
+// computed by the series of P(a, x) for small x and the continued fraction of Q(a, x) otherwise.
+func upperIncompleteGamma(a, x float64) float64 {
+	const (
+		maxIterations = 1000
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(a*math.Log(x) - x - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return max(0, 1-sum*prefix)
+	}
+
+	// Lentz's method
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return min(1, prefix*h)
+}
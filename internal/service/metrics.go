@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/asymptoter/tonx-take-home-test/pkg/metrics"
+)
+
+var (
+	reservationsAccepted = metrics.NewCounterVec("coupon_reservations_accepted_total",
+		"Number of accepted coupon reservations.")
+	reservationsRejected = metrics.NewCounterVec("coupon_reservations_rejected_total",
+		"Number of rejected coupon reservations by reason.", "reason")
+	winnersIssued = metrics.NewCounterVec("coupon_winners_issued_total",
+		"Number of coupons issued to users by source, draw at reservation or reallocation.", "source")
+)
+
+const (
+	winnerSourceDraw         = "draw"
+	winnerSourceReallocation = "reallocation"
+)
+
+// rejectReason is the reason label of a rejected reservation
+func rejectReason(err error) string {
+	switch err {
+	case ErrCampaignNotFound:
+		return "campaign_not_found"
+	case ErrCampaignCancelled:
+		return "campaign_cancelled"
+	case ErrNotReservationTime:
+		return "not_reservation_time"
+	default:
+		return "error"
+	}
+}
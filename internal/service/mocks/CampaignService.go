@@ -14,6 +14,66 @@ type CampaignService struct {
 	mock.Mock
 }
 
+// Cancel provides a mock function with given fields: c, p
+func (_m *CampaignService) Cancel(c ctx.CTX, p service.CancelCampaignInput) (*service.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Cancel")
+	}
+
+	var r0 *service.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.CancelCampaignInput) (*service.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.CancelCampaignInput) *service.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.CancelCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimCouponReservation provides a mock function with given fields: c, p
+func (_m *CampaignService) ClaimCouponReservation(c ctx.CTX, p service.ClaimCouponReservationInput) (*service.CouponClaim, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ClaimCouponReservation")
+	}
+
+	var r0 *service.CouponClaim
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ClaimCouponReservationInput) (*service.CouponClaim, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ClaimCouponReservationInput) *service.CouponClaim); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.CouponClaim)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.ClaimCouponReservationInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Create provides a mock function with given fields: c, p
 func (_m *CampaignService) Create(c ctx.CTX, p service.CreateCampaignInput) (*service.Campaign, error) {
 	ret := _m.Called(c, p)
@@ -74,6 +134,54 @@ func (_m *CampaignService) CreateCouponReservation(c ctx.CTX, p service.CreateCo
 	return r0, r1
 }
 
+// ExportCouponReservations provides a mock function with given fields: c, p, fn
+func (_m *CampaignService) ExportCouponReservations(c ctx.CTX, p service.ExportCouponReservationsInput, fn func(service.CouponReservation) error) error {
+	ret := _m.Called(c, p, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExportCouponReservations")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ExportCouponReservationsInput, func(service.CouponReservation) error) error); ok {
+		r0 = rf(c, p, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Get provides a mock function with given fields: c, p
+func (_m *CampaignService) Get(c ctx.CTX, p service.GetCampaignInput) (*service.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Get")
+	}
+
+	var r0 *service.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignInput) (*service.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignInput) *service.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.GetCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCouponReservation provides a mock function with given fields: c, p
 func (_m *CampaignService) GetCouponReservation(c ctx.CTX, p service.GetCouponReservationInput) (*service.CouponReservation, error) {
 	ret := _m.Called(c, p)
@@ -104,6 +212,36 @@ func (_m *CampaignService) GetCouponReservation(c ctx.CTX, p service.GetCouponRe
 	return r0, r1
 }
 
+// GetFairnessReport provides a mock function with given fields: c, p
+func (_m *CampaignService) GetFairnessReport(c ctx.CTX, p service.GetFairnessReportInput) (*service.FairnessReport, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetFairnessReport")
+	}
+
+	var r0 *service.FairnessReport
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetFairnessReportInput) (*service.FairnessReport, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetFairnessReportInput) *service.FairnessReport); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.FairnessReport)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.GetFairnessReportInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetLatest provides a mock function with given fields: c, p
 func (_m *CampaignService) GetLatest(c ctx.CTX, p service.GetLatestCampaignInput) (*service.Campaign, error) {
 	ret := _m.Called(c, p)
@@ -134,6 +272,246 @@ func (_m *CampaignService) GetLatest(c ctx.CTX, p service.GetLatestCampaignInput
 	return r0, r1
 }
 
+// GetProof provides a mock function with given fields: c, p
+func (_m *CampaignService) GetProof(c ctx.CTX, p service.GetCampaignProofInput) (*service.CampaignProof, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetProof")
+	}
+
+	var r0 *service.CampaignProof
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignProofInput) (*service.CampaignProof, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignProofInput) *service.CampaignProof); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.CampaignProof)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.GetCampaignProofInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStats provides a mock function with given fields: c, p
+func (_m *CampaignService) GetStats(c ctx.CTX, p service.GetCampaignStatsInput) (*service.CampaignStats, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetStats")
+	}
+
+	var r0 *service.CampaignStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignStatsInput) (*service.CampaignStats, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.GetCampaignStatsInput) *service.CampaignStats); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.CampaignStats)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.GetCampaignStatsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// List provides a mock function with given fields: c, p
+func (_m *CampaignService) List(c ctx.CTX, p service.ListCampaignsInput) (*service.Campaigns, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 *service.Campaigns
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListCampaignsInput) (*service.Campaigns, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListCampaignsInput) *service.Campaigns); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Campaigns)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.ListCampaignsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditLogs provides a mock function with given fields: c, p
+func (_m *CampaignService) ListAuditLogs(c ctx.CTX, p service.ListAuditLogsInput) (*service.AuditLogs, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditLogs")
+	}
+
+	var r0 *service.AuditLogs
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListAuditLogsInput) (*service.AuditLogs, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListAuditLogsInput) *service.AuditLogs); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.AuditLogs)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.ListAuditLogsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUserCouponReservations provides a mock function with given fields: c, p
+func (_m *CampaignService) ListUserCouponReservations(c ctx.CTX, p service.ListUserCouponReservationsInput) (*service.UserCouponReservations, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListUserCouponReservations")
+	}
+
+	var r0 *service.UserCouponReservations
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListUserCouponReservationsInput) (*service.UserCouponReservations, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ListUserCouponReservationsInput) *service.UserCouponReservations); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.UserCouponReservations)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.ListUserCouponReservationsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReallocateCoupons provides a mock function with given fields: c, p
+func (_m *CampaignService) ReallocateCoupons(c ctx.CTX, p service.ReallocateCouponsInput) (*service.Reallocation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReallocateCoupons")
+	}
+
+	var r0 *service.Reallocation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ReallocateCouponsInput) (*service.Reallocation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.ReallocateCouponsInput) *service.Reallocation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Reallocation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.ReallocateCouponsInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RedeemCouponReservation provides a mock function with given fields: c, p
+func (_m *CampaignService) RedeemCouponReservation(c ctx.CTX, p service.RedeemCouponReservationInput) (*service.CouponReservation, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RedeemCouponReservation")
+	}
+
+	var r0 *service.CouponReservation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.RedeemCouponReservationInput) (*service.CouponReservation, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.RedeemCouponReservationInput) *service.CouponReservation); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.CouponReservation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.RedeemCouponReservationInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Update provides a mock function with given fields: c, p
+func (_m *CampaignService) Update(c ctx.CTX, p service.UpdateCampaignInput) (*service.Campaign, error) {
+	ret := _m.Called(c, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Update")
+	}
+
+	var r0 *service.Campaign
+	var r1 error
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.UpdateCampaignInput) (*service.Campaign, error)); ok {
+		return rf(c, p)
+	}
+	if rf, ok := ret.Get(0).(func(ctx.CTX, service.UpdateCampaignInput) *service.Campaign); ok {
+		r0 = rf(c, p)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Campaign)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(ctx.CTX, service.UpdateCampaignInput) error); ok {
+		r1 = rf(c, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewCampaignService creates a new instance of CampaignService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCampaignService(t interface {
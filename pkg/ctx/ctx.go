@@ -2,6 +2,8 @@ package ctx
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"go.uber.org/zap"
 )
@@ -13,44 +15,150 @@ type CTX struct {
 	Logger *zap.SugaredLogger
 }
 
+// Background returns an empty CTX logging with the process-wide logger, see SetLogger
 func Background() CTX {
-	logger, _ := zap.NewProduction()
 	return CTX{
 		Context: context.Background(),
-		Logger:  logger.Sugar(),
+		Logger:  logger.Load(),
 	}
 }
 
 func With(parent CTX, fields ...any) CTX {
-	return CTX{
-		Context: parent.Context,
-		Logger:  parent.Logger.With(fields...),
-	}
+	return parent.With(fields...)
 }
 
+// With returns a copy of c logging with fields, which are key-value pairs, zap.Fields or Ms
 func (c CTX) With(fields ...any) CTX {
 	return CTX{
 		Context: c.Context,
-		Logger:  c.Logger.With(fields...),
+		Logger:  c.Logger.With(flatten(fields)...),
 	}
 }
 
 func (c CTX) Debug(args ...any) {
-	c.Logger.Debug(args)
+	c.logger().Debug(args...)
 }
 
 func (c CTX) Info(args ...any) {
-	c.Logger.Info(args)
+	c.logger().Info(args...)
 }
 
 func (c CTX) Warn(args ...any) {
-	c.Logger.Warn(args)
+	c.logger().Warn(args...)
 }
 
+// Error logs args and marks the span of c as failed
 func (c CTX) Error(args ...any) {
-	c.Logger.Error(args)
+	c.logger().Error(args...)
+	SpanFromContext(c.Context).SetError(fmt.Sprint(args...))
 }
 
 func (c CTX) Fatal(args ...any) {
-	c.Logger.Fatal(args)
+	c.logger().Fatal(args...)
+}
+
+// Debugw logs msg with fields, which are key-value pairs, zap.Fields or Ms
+func (c CTX) Debugw(msg string, fields ...any) {
+	c.logger().Debugw(msg, flatten(fields)...)
+}
+
+// Infow logs msg with fields, which are key-value pairs, zap.Fields or Ms
+func (c CTX) Infow(msg string, fields ...any) {
+	c.logger().Infow(msg, flatten(fields)...)
+}
+
+// Warnw logs msg with fields, which are key-value pairs, zap.Fields or Ms
+func (c CTX) Warnw(msg string, fields ...any) {
+	c.logger().Warnw(msg, flatten(fields)...)
+}
+
+// Errorw logs msg with fields, which are key-value pairs, zap.Fields or Ms,
+// and marks the span of c as failed.
+func (c CTX) Errorw(msg string, fields ...any) {
+	c.logger().Errorw(msg, flatten(fields)...)
+	SpanFromContext(c.Context).SetError(msg)
+}
+
+// logger adds the ids of the current span, they aren't added by StartSpan
+// so the nested spans don't repeat the fields.
+func (c CTX) logger() *zap.SugaredLogger {
+	if span := SpanFromContext(c.Context); span != nil {
+		sc := span.span.SpanContext()
+		return c.Logger.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	return c.Logger
+}
+
+// flatten expands the Ms in fields into key-value pairs sorted by key
+func flatten(fields []any) []any {
+	n := 0
+	for _, f := range fields {
+		if m, ok := f.(M); ok {
+			n += 2 * len(m)
+		} else {
+			n++
+		}
+	}
+	if n == len(fields) {
+		return fields
+	}
+
+	res := make([]any, 0, n)
+	for _, f := range fields {
+		m, ok := f.(M)
+		if !ok {
+			res = append(res, f)
+			continue
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res = append(res, k, m[k])
+		}
+	}
+	return res
+}
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor returns a copy of c carrying who performs the operation, e.g. "user:<id>" or "admin:<name>"
+func (c CTX) WithActor(actor string) CTX {
+	return CTX{
+		Context: context.WithValue(c.Context, actorKey{}, actor),
+		Logger:  c.Logger,
+	}
+}
+
+// Actor returns the actor set by WithActor, empty if not set
+func (c CTX) Actor() string {
+	actor, _ := c.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithRequestID returns a copy of c carrying the id of the request being served
+func (c CTX) WithRequestID(requestID string) CTX {
+	return CTX{
+		Context: context.WithValue(c.Context, requestIDKey{}, requestID),
+		Logger:  c.Logger.With("request_id", requestID),
+	}
+}
+
+// RequestID returns the request id set by WithRequestID, empty if not set
+func (c CTX) RequestID() string {
+	requestID, _ := c.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithContext returns a copy of c using parent as its context.Context,
+// so the cancellation of parent is seen through c.
+func (c CTX) WithContext(parent context.Context) CTX {
+	return CTX{
+		Context: parent,
+		Logger:  c.Logger,
+	}
 }
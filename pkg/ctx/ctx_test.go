@@ -1,10 +1,83 @@
 package ctx
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+
+	"go.uber.org/zap/zapcore"
 )
 
 func TestCTX_With(t *testing.T) {
 	c := Background()
 	c.With("key1", "value1", "key2", "value2").Info("OK")
 }
+
+func TestCTX_WithActor(t *testing.T) {
+	c := Background()
+	if c.Actor() != "" || c.RequestID() != "" {
+		t.Fatal("expect empty actor and request id")
+	}
+
+	c = c.WithActor("admin:alice").WithRequestID("request_id").With("key1", "value1")
+	if c.Actor() != "admin:alice" {
+		t.Fatalf("unexpected actor %q", c.Actor())
+	}
+	if c.RequestID() != "request_id" {
+		t.Fatalf("unexpected request id %q", c.RequestID())
+	}
+}
+
+func TestCTX_WithContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	c := Background().WithActor("admin:alice").WithContext(parent)
+	cancel()
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("expect cancelled context")
+	}
+}
+
+func TestCTX_Errorw(t *testing.T) {
+	c, logs := newObserved(zapcore.DebugLevel)
+	c.With(M{"campaign_id": 1, "user_id": "user_id"}).Errorw("claim failed", "attempt", 2, Err(errors.New("boom")))
+	c.Error(errors.New("plain"))
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 logs, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if entries[0].Message != "claim failed" || fields["campaign_id"] != int64(1) || fields["user_id"] != "user_id" ||
+		fields["attempt"] != int64(2) || fields["error"] != "boom" {
+		t.Fatalf("unexpected log %q %v", entries[0].Message, fields)
+	}
+	if _, ok := fields["error_chain"]; ok {
+		t.Fatal("expect no error chain for an unwrapped error")
+	}
+	// 參數不再被包成一個 slice
+	if entries[1].Message != "plain" {
+		t.Fatalf("unexpected message %q", entries[1].Message)
+	}
+}
+
+func TestErr(t *testing.T) {
+	base := errors.New("record not found")
+	err := errors.Join(fmt.Errorf("get campaign: %w", base), errors.New("audit failed"))
+
+	c, logs := newObserved(zapcore.DebugLevel)
+	c.Warnw("failed", Err(err), Err(nil))
+
+	fields := logs.All()[0].ContextMap()
+	chain, _ := fields["error_chain"].([]any)
+	expected := []any{"get campaign: record not found", "record not found", "audit failed"}
+	if fmt.Sprint(chain) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected error chain %v", fields["error_chain"])
+	}
+	if fields["error"] != err.Error() {
+		t.Fatalf("unexpected error %v", fields["error"])
+	}
+}
@@ -0,0 +1,59 @@
+package ctx
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Err is the field of err, logged as "error" with the messages of the wrapped errors
+// in "error_chain" if err wraps any, e.g. created with fmt.Errorf("...: %w", err) or errors.Join.
+func Err(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+	return zap.Inline(errorChain{err})
+}
+
+type errorChain struct {
+	err error
+}
+
+func (e errorChain) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("error", e.err.Error())
+
+	chain := unwrapAll(e.err)
+	if len(chain) == 0 {
+		return nil
+	}
+	return enc.AddArray("error_chain", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		for _, err := range chain {
+			enc.AppendString(err.Error())
+		}
+		return nil
+	}))
+}
+
+// unwrapAll returns the errors wrapped by err depth-first, not including err
+func unwrapAll(err error) []error {
+	var wrapped []error
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		wrapped = e.Unwrap()
+	default:
+		if u := errors.Unwrap(err); u != nil {
+			wrapped = []error{u}
+		}
+	}
+
+	var res []error
+	for _, w := range wrapped {
+		if w == nil {
+			continue
+		}
+		res = append(res, w)
+		res = append(res, unwrapAll(w)...)
+	}
+	return res
+}
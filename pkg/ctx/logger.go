@@ -0,0 +1,106 @@
+package ctx
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogConfig configures the process-wide logger
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string
+	// Encoding is json or console
+	Encoding string
+	// SamplingInitial entries with the same level and message are logged per second,
+	// then every SamplingThereafter-th one. Sampling is disabled if SamplingInitial is 0.
+	SamplingInitial    int
+	SamplingThereafter int
+	// File is written instead of stderr if set, it's rotated by lumberjack when it exceeds MaxSizeMB (100 if 0),
+	// keeping at most MaxBackups rotated files for MaxAgeDays days, 0 means no limit.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// DefaultLogConfig logs JSON at info level to stderr, sampled like zap.NewProduction
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		Level:              "info",
+		Encoding:           "json",
+		SamplingInitial:    100,
+		SamplingThereafter: 100,
+		MaxSizeMB:          100,
+	}
+}
+
+// logger is shared by every CTX created by Background
+var logger atomic.Pointer[zap.SugaredLogger]
+
+func init() {
+	l, err := NewLogger(DefaultLogConfig())
+	if err != nil {
+		panic(err)
+	}
+	logger.Store(l.Sugar())
+}
+
+// NewLogger builds a logger from cfg
+func NewLogger(cfg LogConfig) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	switch cfg.Encoding {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		return nil, fmt.Errorf("unknown log encoding %q", cfg.Encoding)
+	}
+
+	var out zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	if cfg.File != "" {
+		f := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+		}
+		// 寫入空的內容只會開啟檔案，無法寫入時在啟動時就失敗
+		if _, err := f.Write(nil); err != nil {
+			return nil, err
+		}
+		out = zapcore.AddSync(f)
+	}
+
+	core := zapcore.NewCore(encoder, out, level)
+	if cfg.SamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}
+	// CTX wraps the logger, skip it so the caller is the code calling CTX
+	return zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
+
+// SetLogger replaces the logger of the CTXs created by Background afterwards,
+// the returned function restores the previous one.
+func SetLogger(l *zap.Logger) func() {
+	prev := logger.Swap(l.Sugar())
+	return func() {
+		logger.Store(prev)
+	}
+}
+
+// Sync flushes the buffered logs of the process-wide logger
+func Sync() error {
+	return logger.Load().Sync()
+}
@@ -0,0 +1,157 @@
+package ctx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewLogger(t *testing.T) {
+	for _, cfg := range []LogConfig{
+		{Level: "verbose", Encoding: "json"},
+		{Level: "info", Encoding: "xml"},
+	} {
+		if _, err := NewLogger(cfg); err == nil {
+			t.Fatalf("expect error for %+v", cfg)
+		}
+	}
+
+	cfg := DefaultLogConfig()
+	cfg.Encoding = "console"
+	if _, err := NewLogger(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewLoggerWithFile(t *testing.T) {
+	cfg := DefaultLogConfig()
+	cfg.Level = "warn"
+	cfg.File = filepath.Join(t.TempDir(), "logs", "app.log")
+	l, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("dropped")
+	l.Warn("kept")
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "dropped") || !strings.Contains(string(b), `"msg":"kept"`) {
+		t.Fatalf("unexpected logs %s", b)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	restore := SetLogger(zap.New(core))
+
+	Background().With("key1", "value1").Info("OK")
+	restore()
+	Background().Info("not observed")
+
+	if logs.Len() != 1 {
+		t.Fatalf("expect 1 log, got %d", logs.Len())
+	}
+	entry := logs.All()[0]
+	if entry.ContextMap()["key1"] != "value1" {
+		t.Fatalf("unexpected fields %v", entry.ContextMap())
+	}
+}
+
+// newObserved returns a CTX recording its logs at or above level
+func newObserved(level zapcore.Level) (CTX, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	return CTX{
+		Context: Background().Context,
+		Logger:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+	}, logs
+}
+
+func TestObservedLogger(t *testing.T) {
+	c, logs := newObserved(zapcore.WarnLevel)
+	c.Info("dropped")
+	c.WithRequestID("request_id").Warn("kept")
+
+	if logs.Len() != 1 {
+		t.Fatalf("expect 1 log, got %d", logs.Len())
+	}
+	if id := logs.All()[0].ContextMap()["request_id"]; id != "request_id" {
+		t.Fatalf("unexpected request id %v", id)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// 其他檔名相近的檔案不算在輪替的檔案中
+	other := filepath.Join(dir, "app.log.bak")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultLogConfig()
+	cfg.SamplingInitial = 0
+	cfg.File = path
+	cfg.MaxSizeMB = 1
+	cfg.MaxBackups = 1
+	l, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := strings.Repeat("x", 1<<10)
+	for i := 0; i < 3<<10; i++ {
+		l.Info(msg)
+		if i == 1<<9 {
+			// 檔案被刪掉時重新建立，繼續寫入
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// lumberjack 在背景刪除多餘的備份
+	var backups []string
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		backups, _ = filepath.Glob(filepath.Join(dir, "app-*.log"))
+		if len(backups) == 1 {
+			break
+		}
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expect 1 backup, got %v", backups)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 || info.Size() > 1<<20 {
+		t.Fatalf("unexpected size %d", info.Size())
+	}
+}
+
+func TestLogFileWithInvalidPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultLogConfig()
+	// 上層是檔案而不是目錄
+	cfg.File = filepath.Join(path, "app.log")
+	if _, err := NewLogger(cfg); err == nil {
+		t.Fatal("expect the open error")
+	}
+}
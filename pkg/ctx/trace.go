@@ -0,0 +1,180 @@
+package ctx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans
+const tracerName = "github.com/asymptoter/tonx-take-home-test"
+
+// tracerProvider starts the spans of the process, they have ids for the logs but are dropped by default
+var tracerProvider atomic.Pointer[sdktrace.TracerProvider]
+
+func init() {
+	tracerProvider.Store(sdktrace.NewTracerProvider())
+}
+
+// SetSpanExporter exports the spans ended afterwards to e synchronously, attrs describe the resource
+// producing them, e.g. semconv.ServiceName. The returned function restores the previous exporter.
+func SetSpanExporter(e sdktrace.SpanExporter, attrs ...attribute.KeyValue) func() {
+	prev := tracerProvider.Swap(sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(e),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+	))
+	return func() {
+		tracerProvider.Store(prev)
+	}
+}
+
+// FileExporter appends the spans to a file as JSON, one span per line
+type FileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileExporter{Exporter: exporter, file: file}, nil
+}
+
+// Close closes the file, the spans ended afterwards are dropped
+func (e *FileExporter) Close() error {
+	if err := e.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
+
+// Span is an operation within a trace, it's exported when End is called
+type Span struct {
+	span   trace.Span
+	name   string
+	failed atomic.Bool
+}
+
+type spanKey struct{}
+
+// StartSpan starts a child span of the span in c, or a root span of a new trace if there is none.
+// attrs are key-value pairs. The returned CTX carries the span and logs its trace_id and span_id.
+func (c CTX) StartSpan(name string, attrs ...any) (CTX, *Span) {
+	span := StartChildSpan(c.Context, name, attrs...)
+	return CTX{
+		Context: context.WithValue(trace.ContextWithSpan(c.Context, span.span), spanKey{}, span),
+		Logger:  c.Logger,
+	}, span
+}
+
+// StartChildSpan starts a span like StartSpan without carrying it, for code outside of a CTX
+// such as database callbacks.
+func StartChildSpan(parent context.Context, name string, attrs ...any) *Span {
+	_, span := tracerProvider.Load().Tracer(tracerName).Start(parent, name, trace.WithAttributes(toAttributes(attrs)...))
+	return &Span{span: span, name: name}
+}
+
+// SpanFromContext returns the span started by StartSpan, nil if there is none
+func SpanFromContext(c context.Context) *Span {
+	if c == nil {
+		return nil
+	}
+	span, _ := c.Value(spanKey{}).(*Span)
+	return span
+}
+
+// TraceID returns the trace id of the span in c, empty if there is none
+func (c CTX) TraceID() string {
+	if span := SpanFromContext(c.Context); span != nil {
+		return span.span.SpanContext().TraceID().String()
+	}
+	return ""
+}
+
+// Name returns the name of s
+func (s *Span) Name() string {
+	return s.name
+}
+
+// SpanID returns the id of s
+func (s *Span) SpanID() trace.SpanID {
+	return s.span.SpanContext().SpanID()
+}
+
+// SetAttributes adds key-value pairs to s
+func (s *Span) SetAttributes(attrs ...any) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(toAttributes(attrs)...)
+}
+
+// SetError marks s as failed, only the first error is kept
+func (s *Span) SetError(msg string) {
+	if s == nil || !s.failed.CompareAndSwap(false, true) {
+		return
+	}
+	s.span.SetStatus(codes.Error, msg)
+}
+
+// End exports s, calling it more than once has no effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+func toAttributes(kv []any) []attribute.KeyValue {
+	res := make([]attribute.KeyValue, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
+		}
+		res = append(res, toAttribute(key, kv[i+1]))
+	}
+	return res
+}
+
+func toAttribute(key string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case uint:
+		return attribute.Int64(key, int64(v))
+	case uint32:
+		return attribute.Int64(key, int64(v))
+	case uint64:
+		return attribute.Int64(key, int64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	case fmt.Stringer:
+		return attribute.Stringer(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
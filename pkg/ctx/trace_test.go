@@ -0,0 +1,128 @@
+package ctx
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStartSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer SetSpanExporter(exporter)()
+
+	c, logs := newObserved(zapcore.InfoLevel)
+	c, root := c.StartSpan("root", "campaign_id", uint(1))
+	child, span := c.StartSpan("child", "user_id", "user_id")
+	child.Errorw("claim failed", Err(errors.New("boom")))
+	child.Errorw("claim failed again")
+	span.SetAttributes("rows_affected", int64(1))
+	span.End()
+	span.End()
+	root.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	childData, rootData := spans[0], spans[1]
+	if childData.SpanContext.TraceID() != rootData.SpanContext.TraceID() ||
+		childData.Parent.SpanID() != rootData.SpanContext.SpanID() || rootData.Parent.IsValid() {
+		t.Fatalf("unexpected span ids %+v %+v", childData, rootData)
+	}
+	if childData.Status.Code != codes.Error || childData.Status.Description != "claim failed" || rootData.Status.Code != codes.Unset {
+		t.Fatalf("unexpected status %+v %+v", childData.Status, rootData.Status)
+	}
+	if len(childData.Attributes) != 2 || childData.Attributes[1] != attribute.Int64("rows_affected", 1) {
+		t.Fatalf("unexpected attributes %v", childData.Attributes)
+	}
+	if rootData.Attributes[0] != attribute.Int64("campaign_id", 1) {
+		t.Fatalf("unexpected attributes %v", rootData.Attributes)
+	}
+	if c.TraceID() != rootData.SpanContext.TraceID().String() {
+		t.Fatalf("unexpected trace id %q", c.TraceID())
+	}
+
+	// 每一行 log 都帶有 trace_id 和 span_id
+	fields := logs.All()[0].ContextMap()
+	if fields["trace_id"] != childData.SpanContext.TraceID().String() || fields["span_id"] != childData.SpanContext.SpanID().String() {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetSpanExporter(exporter, semconv.ServiceName("coupon"))()
+
+	c, root := Background().StartSpan("root")
+	_, span := c.StartSpan("child", "campaign_id", uint(1), "winner", true)
+	span.SetError("boom")
+	span.End()
+	root.End()
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 只解析需要檢查的欄位
+	type keyValue struct {
+		Key   string
+		Value struct {
+			Type  string
+			Value any
+		}
+	}
+	type exportedSpan struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ TraceID, SpanID string }
+		Status      sdktrace.Status
+		Attributes  []keyValue
+		Resource    []keyValue
+	}
+	var spans []exportedSpan
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for decoder.More() {
+		var span exportedSpan
+		if err := decoder.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+
+	child, root0 := spans[0], spans[1]
+	if child.Name != "child" || child.Parent.SpanID != root0.SpanContext.SpanID || child.SpanContext.TraceID != root0.SpanContext.TraceID {
+		t.Fatalf("unexpected spans %+v %+v", child, root0)
+	}
+	if child.Status.Code != codes.Error || child.Status.Description != "boom" || root0.Status.Code != codes.Unset {
+		t.Fatalf("unexpected status %+v %+v", child.Status, root0.Status)
+	}
+	if len(child.Attributes) != 2 || child.Attributes[0].Value.Type != "INT64" || child.Attributes[0].Value.Value != float64(1) ||
+		child.Attributes[1].Key != "winner" || child.Attributes[1].Value.Value != true {
+		t.Fatalf("unexpected attributes %+v", child.Attributes)
+	}
+	if len(child.Resource) != 1 || child.Resource[0].Key != "service.name" || child.Resource[0].Value.Value != "coupon" {
+		t.Fatalf("unexpected resource %+v", child.Resource)
+	}
+}
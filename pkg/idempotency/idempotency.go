@@ -0,0 +1,119 @@
+// Package idempotency keeps the responses of the requests sent with an Idempotency-Key,
+// so a retried request gets the saved response instead of being processed again.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+var (
+	timeNow = time.Now
+)
+
+// Record is the request sent with a key, Status is 0 until its response is saved
+type Record struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Done reports whether the response of the request is saved
+func (r Record) Done() bool {
+	return r.Status != 0
+}
+
+// Expired reports whether the key of r can be used again at now
+func (r Record) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Fingerprint identifies a request by its method, path with the query and body,
+// a key reused with another fingerprint is rejected
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Store keeps the records, it must be safe for concurrent use
+type Store interface {
+	// Begin saves r as the request of key if the key isn't used or has expired, and reports true.
+	// Otherwise it returns the record of the previous request and false.
+	Begin(c ctx.CTX, key string, r Record) (Record, bool, error)
+	// Complete saves the response in r for the request begun with key
+	Complete(c ctx.CTX, key string, r Record) error
+	// Release drops the request begun with key before its response is saved, so it can be sent again
+	Release(c ctx.CTX, key string) error
+}
+
+const (
+	// memoryStoreSweepInterval drops the expired records every interval to bound the memory
+	memoryStoreSweepInterval = time.Minute
+)
+
+// MemoryStore keeps the records in memory, a request retried on another replica is processed again
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]Record{},
+		swept:   timeNow(),
+	}
+}
+
+func (s *MemoryStore) Begin(c ctx.CTX, key string, r Record) (Record, bool, error) {
+	now := timeNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= memoryStoreSweepInterval {
+		for k, v := range s.records {
+			if v.Expired(now) {
+				delete(s.records, k)
+			}
+		}
+		s.swept = now
+	}
+
+	if saved, ok := s.records[key]; ok && !saved.Expired(now) {
+		return saved, false, nil
+	}
+	s.records[key] = r
+	return r, true, nil
+}
+
+func (s *MemoryStore) Complete(c ctx.CTX, key string, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = r
+	return nil
+}
+
+func (s *MemoryStore) Release(c ctx.CTX, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.records[key].Done() {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// Len returns the number of records kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("POST", "/campaigns/1/reservations", nil)
+	if a != Fingerprint("POST", "/campaigns/1/reservations", []byte{}) {
+		t.Fatal("fingerprint of the same request changed")
+	}
+	for _, b := range []string{
+		Fingerprint("PUT", "/campaigns/1/reservations", nil),
+		Fingerprint("POST", "/campaigns/2/reservations", nil),
+		Fingerprint("POST", "/campaigns/1/reservations", []byte("{}")),
+	} {
+		if a == b {
+			t.Fatal("different requests have the same fingerprint")
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(100, 0)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	c := ctx.Background()
+	s := NewMemoryStore()
+	r := Record{Fingerprint: "a", ExpiresAt: now.Add(time.Minute)}
+
+	if _, ok, err := s.Begin(c, "user:a:key", r); err != nil || !ok {
+		t.Fatalf("first request isn't begun: %v", err)
+	}
+	// 處理中的請求回傳尚未完成的紀錄
+	saved, ok, err := s.Begin(c, "user:a:key", Record{Fingerprint: "b", ExpiresAt: now.Add(time.Minute)})
+	if err != nil || ok || saved.Fingerprint != "a" || saved.Done() {
+		t.Fatalf("unexpected record %+v, %v: %v", saved, ok, err)
+	}
+
+	r.Status, r.Body = 200, []byte("{}")
+	if err := s.Complete(c, "user:a:key", r); err != nil {
+		t.Fatal(err)
+	}
+	if saved, ok, err = s.Begin(c, "user:a:key", r); err != nil || ok || !saved.Done() || string(saved.Body) != "{}" {
+		t.Fatalf("unexpected record %+v, %v: %v", saved, ok, err)
+	}
+
+	// 已經完成的請求不會被釋放
+	if err := s.Release(c, "user:a:key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Begin(c, "user:a:key", r); err != nil || ok {
+		t.Fatalf("completed key is released: %v", err)
+	}
+
+	// 釋放的 key 可以再使用
+	if _, ok, err := s.Begin(c, "user:b:key", Record{ExpiresAt: now.Add(time.Hour)}); err != nil || !ok {
+		t.Fatalf("request of another key isn't begun: %v", err)
+	}
+	if err := s.Release(c, "user:b:key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Begin(c, "user:b:key", Record{ExpiresAt: now.Add(time.Hour)}); err != nil || !ok {
+		t.Fatalf("released key isn't begun: %v", err)
+	}
+
+	// 過期的紀錄會被取代及清除
+	now = now.Add(time.Minute)
+	if _, ok, err := s.Begin(c, "user:a:key", Record{ExpiresAt: now.Add(time.Minute)}); err != nil || !ok {
+		t.Fatalf("expired key isn't begun: %v", err)
+	}
+	now = now.Add(memoryStoreSweepInterval)
+	if _, ok, err := s.Begin(c, "user:c:key", Record{ExpiresAt: now.Add(time.Minute)}); err != nil || !ok {
+		t.Fatalf("request after sweep isn't begun: %v", err)
+	}
+	if n := s.Len(); n != 2 {
+		t.Fatalf("unexpected number of records %d", n)
+	}
+}
@@ -0,0 +1,107 @@
+// Package lottery implements the keyed draw with a secret seed per campaign. When the seed is
+// revealed after the draw, anyone holding it can recompute who won:
+//
+//	commitment = hex(SHA-256(seed))
+//	score      = first 8 bytes of HMAC-SHA256(seed, uint64be(campaign_id) || user_id) as uint64be
+//	won        = score < threshold, threshold = floor(win_ratio * 2^64)
+package lottery
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+)
+
+// SeedSize is the size of the seeds in bytes
+const SeedSize = 32
+
+var (
+	ErrInvalidSeed = errors.New("invalid seed")
+)
+
+const redacted = "[redacted]"
+
+// Seed is the secret key of the draw in hex. It's redacted when formatted or marshaled,
+// so it never ends up in logs, convert it with string(seed) to reveal it.
+type Seed string
+
+func (s Seed) String() string {
+	return redacted
+}
+
+func (s Seed) GoString() string {
+	return redacted
+}
+
+func (s Seed) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// NewSeed returns a random seed from crypto/rand
+func NewSeed() (Seed, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return Seed(hex.EncodeToString(seed)), nil
+}
+
+// Commit returns the commitment to seed published before the draw
+func Commit(seed Seed) (string, error) {
+	b, err := decodeSeed(seed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify reports whether seed is the one committed to by commitment
+func Verify(seed Seed, commitment string) bool {
+	c, err := Commit(seed)
+	return err == nil && hmac.Equal([]byte(c), []byte(commitment))
+}
+
+// Threshold is the score below which a user wins, so a user wins with probability winRatio
+func Threshold(winRatio float64) uint64 {
+	if winRatio >= 1 {
+		return math.MaxUint64
+	}
+	if winRatio <= 0 {
+		return 0
+	}
+	return uint64(math.Ldexp(winRatio, 64))
+}
+
+// Score is the uniformly distributed score of the user in the campaign
+func Score(seed Seed, campaignID uint, userID string) (uint64, error) {
+	key, err := decodeSeed(seed)
+	if err != nil {
+		return 0, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(campaignID)))
+	mac.Write([]byte(userID))
+	return binary.BigEndian.Uint64(mac.Sum(nil)), nil
+}
+
+// Won reports whether the user wins the campaign drawn with seed
+func Won(seed Seed, campaignID uint, userID string, threshold uint64) (bool, error) {
+	score, err := Score(seed, campaignID, userID)
+	if err != nil {
+		return false, err
+	}
+	return score < threshold, nil
+}
+
+func decodeSeed(seed Seed) ([]byte, error) {
+	b, err := hex.DecodeString(string(seed))
+	if err != nil || len(b) != SeedSize {
+		return nil, ErrInvalidSeed
+	}
+	return b, nil
+}
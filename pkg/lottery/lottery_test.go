@@ -0,0 +1,101 @@
+package lottery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+const testSeed Seed = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestCommit(t *testing.T) {
+	commitment, err := Commit(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of the 32 bytes 0x00..0x1f
+	if commitment != "630dcd2966c4336691125448bbb25b4ff412a49c732db2c8abc1b8581bd710dd" {
+		t.Fatalf("unexpected commitment %s", commitment)
+	}
+	if !Verify(testSeed, commitment) {
+		t.Fatal("seed doesn't match its commitment")
+	}
+	if Verify(Seed(strings.Replace(string(testSeed), "00", "ff", 1)), commitment) {
+		t.Fatal("another seed matches the commitment")
+	}
+
+	for _, seed := range []Seed{"", "zz", "0001"} {
+		if _, err := Commit(seed); err != ErrInvalidSeed {
+			t.Fatalf("unexpected error %v of seed %q", err, seed)
+		}
+	}
+}
+
+func TestNewSeed(t *testing.T) {
+	a, err := NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2*SeedSize || a == b {
+		t.Fatalf("unexpected seeds %s %s", a, b)
+	}
+}
+
+func TestSeedRedacted(t *testing.T) {
+	b, err := json.Marshal(struct{ Seed Seed }{testSeed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{fmt.Sprint(testSeed), fmt.Sprintf("%#v", testSeed), fmt.Sprintf("%+v", struct{ Seed Seed }{testSeed}), string(b)} {
+		if strings.Contains(s, string(testSeed)) {
+			t.Fatalf("seed isn't redacted in %s", s)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	if v := Threshold(0.5); v != 1<<63 {
+		t.Fatalf("unexpected threshold %d", v)
+	}
+	if v := Threshold(1); v != math.MaxUint64 {
+		t.Fatalf("unexpected threshold %d", v)
+	}
+	if v := Threshold(0); v != 0 {
+		t.Fatalf("unexpected threshold %d", v)
+	}
+}
+
+func TestWon(t *testing.T) {
+	// 分數固定，驗證方可以重現
+	score, err := Score(testSeed, 1, "user_id_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := Score(testSeed, 1, "user_id_1")
+	other, _ := Score(testSeed, 2, "user_id_1")
+	if score != again || score == other {
+		t.Fatalf("unexpected scores %d %d %d", score, again, other)
+	}
+
+	// 中獎比例接近 win ratio
+	winners := 0
+	threshold := Threshold(0.2)
+	for i := 0; i < 10000; i++ {
+		won, err := Won(testSeed, 1, fmt.Sprintf("user_id_%d", i), threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if won {
+			winners++
+		}
+	}
+	if winners < 1800 || winners > 2200 {
+		t.Fatalf("unexpected winners %d", winners)
+	}
+}
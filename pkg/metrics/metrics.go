@@ -0,0 +1,94 @@
+// Package metrics registers the counters and histograms of the app to a Prometheus registry,
+// which also collects the Go runtime and process metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefBuckets are the default histogram buckets in seconds
+var DefBuckets = prometheus.DefBuckets
+
+// Default is the registry the New* functions register to
+var Default = NewRegistry()
+
+// NewRegistry returns a registry collecting the Go runtime and process metrics
+func NewRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return r
+}
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	prometheus.Counter
+}
+
+// Value returns the current value, e.g. to assert it in the tests
+func (c Counter) Value() float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounterVec registers a counter partitioned by labels to the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	Default.MustRegister(c)
+	return &CounterVec{vec: c}
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{c.vec.WithLabelValues(values...)}
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	prometheus.Observer
+	metric prometheus.Metric
+}
+
+// Count returns the number of observations
+func (h Histogram) Count() uint64 {
+	var m dto.Metric
+	if err := h.metric.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+type HistogramVec struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogramVec registers a histogram partitioned by labels to the default registry,
+// buckets are the sorted upper bounds, DefBuckets if nil.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	Default.MustRegister(h)
+	return &HistogramVec{vec: h}
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) Histogram {
+	o := h.vec.WithLabelValues(values...)
+	return Histogram{Observer: o, metric: o.(prometheus.Metric)}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.", "route", "status")
+	c.WithLabelValues("/a", "200").Inc()
+	c.WithLabelValues("/a", "200").Add(2)
+	c.WithLabelValues(`/"b"`, "500").Inc()
+
+	if v := c.WithLabelValues("/a", "200").Value(); v != 3 {
+		t.Fatalf("unexpected value %v", v)
+	}
+
+	out := render(t)
+	for _, line := range []string{
+		"# HELP test_requests_total Requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="/a",status="200"} 3`,
+		`test_requests_total{route="/\"b\"",status="500"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "route")
+	h.WithLabelValues("/a").Observe(0.05)
+	h.WithLabelValues("/a").Observe(0.5)
+	h.WithLabelValues("/a").Observe(2)
+
+	if n := h.WithLabelValues("/a").Count(); n != 3 {
+		t.Fatalf("unexpected count %d", n)
+	}
+
+	out := render(t)
+	for _, line := range []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{route="/a",le="0.1"} 1`,
+		`test_duration_seconds_bucket{route="/a",le="1"} 2`,
+		`test_duration_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`test_duration_seconds_sum{route="/a"} 2.55`,
+		`test_duration_seconds_count{route="/a"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestDuplicateMetric(t *testing.T) {
+	NewCounterVec("test_duplicate_total", "Duplicate.")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic on duplicate metric")
+		}
+	}()
+	NewCounterVec("test_duplicate_total", "Duplicate.")
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	out := render(t)
+	for _, name := range []string{"go_goroutines", "go_memstats_heap_alloc_bytes", "process_start_time_seconds"} {
+		if !strings.Contains(out, "# TYPE "+name+" ") {
+			t.Fatalf("missing %s in\n%s", name, out)
+		}
+	}
+}
+
+func render(t *testing.T) string {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return w.Body.String()
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+var (
+	timeNow = time.Now
+)
+
+// Limit allows bursts of Count requests, refilling the bucket over Period.
+// The zero Limit allows everything.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit parses a limit written as "5/1s" or "30/1m", an empty string is the zero Limit
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, e.g. 5/1s", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, count must be positive", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, period must be a positive duration", s)
+	}
+	return Limit{Count: n, Period: d}, nil
+}
+
+func (l Limit) String() string {
+	if l.IsZero() {
+		return ""
+	}
+	return strconv.Itoa(l.Count) + "/" + l.Period.String()
+}
+
+func (l Limit) IsZero() bool {
+	return l.Count == 0
+}
+
+// Bucket is the state of a token bucket, the zero Bucket is full
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills b up to now and takes a token from it. It returns the new state of b,
+// and how long to wait for the next token if b is empty.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, bool, time.Duration) {
+	capacity := float64(l.Count)
+	perToken := l.Period / time.Duration(l.Count)
+
+	tokens := capacity
+	if !b.Updated.IsZero() {
+		elapsed := max(now.Sub(b.Updated), 0)
+		tokens = min(capacity, b.Tokens+float64(elapsed)/float64(perToken))
+	}
+	if tokens < 1 {
+		wait := time.Duration(math.Ceil((1 - tokens) * float64(perToken)))
+		return Bucket{Tokens: tokens, Updated: now}, false, wait
+	}
+	return Bucket{Tokens: tokens - 1, Updated: now}, true, 0
+}
+
+// full reports whether b is refilled by now, so dropping it doesn't change anything
+func (l Limit) full(b Bucket, now time.Time) bool {
+	return now.Sub(b.Updated) >= l.Period
+}
+
+// Store keeps the buckets, it must be safe for concurrent use
+type Store interface {
+	// Take takes a token from the bucket of key. If the bucket is empty, it reports false
+	// and how long to wait before retrying.
+	Take(c ctx.CTX, key string, l Limit) (bool, time.Duration, error)
+}
+
+const (
+	// memoryStoreSweepInterval drops the refilled buckets every interval to bound the memory
+	memoryStoreSweepInterval = time.Minute
+)
+
+type memoryBucket struct {
+	Bucket
+	limit Limit
+}
+
+// MemoryStore keeps the buckets in memory, each replica limits the requests it receives on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*memoryBucket{},
+		swept:   timeNow(),
+	}
+}
+
+func (s *MemoryStore) Take(c ctx.CTX, key string, l Limit) (bool, time.Duration, error) {
+	now := timeNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= memoryStoreSweepInterval {
+		for k, b := range s.buckets {
+			if b.limit.full(b.Bucket, now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		s.buckets[key] = b
+	}
+	var allowed bool
+	var wait time.Duration
+	b.Bucket, allowed, wait = l.Take(b.Bucket, now)
+	b.limit = l
+	return allowed, wait, nil
+}
+
+// Len returns the number of buckets kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
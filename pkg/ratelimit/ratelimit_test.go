@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asymptoter/tonx-take-home-test/pkg/ctx"
+)
+
+func TestParseLimit(t *testing.T) {
+	for s, want := range map[string]Limit{
+		"":      {},
+		"5/1s":  {Count: 5, Period: time.Second},
+		"30/1m": {Count: 30, Period: time.Minute},
+	} {
+		l, err := ParseLimit(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		if l != want {
+			t.Fatalf("parse %q: unexpected limit %+v", s, l)
+		}
+		if back, err := ParseLimit(l.String()); err != nil || back != l {
+			t.Fatalf("unexpected string %q of %q", l.String(), s)
+		}
+	}
+
+	for _, s := range []string{"5", "0/1s", "-1/1s", "5/0s", "5/s", "a/1s"} {
+		if _, err := ParseLimit(s); err == nil {
+			t.Fatalf("parse %q: expected error", s)
+		}
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	l := Limit{Count: 2, Period: time.Second}
+	now := time.Unix(100, 0)
+
+	var b Bucket
+	var ok bool
+	var wait time.Duration
+	for i := 0; i < 2; i++ {
+		if b, ok, _ = l.Take(b, now); !ok {
+			t.Fatalf("request %d of the burst is limited", i)
+		}
+	}
+	if b, ok, wait = l.Take(b, now); ok {
+		t.Fatal("request beyond the burst is allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("unexpected wait %v", wait)
+	}
+
+	// 一個 token 補充需要 500ms
+	if _, ok, wait = l.Take(b, now.Add(200*time.Millisecond)); ok || wait != 300*time.Millisecond {
+		t.Fatalf("unexpected result %v, wait %v", ok, wait)
+	}
+	if b, ok, _ = l.Take(b, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("refilled request is limited")
+	}
+	// 補充的 token 不會超過 Count
+	b, _, _ = l.Take(b, now.Add(time.Hour))
+	if b.Tokens != 1 {
+		t.Fatalf("unexpected tokens %v", b.Tokens)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(100, 0)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	c := ctx.Background()
+	s := NewMemoryStore()
+	l := Limit{Count: 1, Period: time.Second}
+
+	if ok, _, err := s.Take(c, "user:a", l); err != nil || !ok {
+		t.Fatalf("first request is limited: %v", err)
+	}
+	if ok, wait, err := s.Take(c, "user:a", l); err != nil || ok || wait != time.Second {
+		t.Fatalf("unexpected result %v, wait %v: %v", ok, wait, err)
+	}
+	// 不同的 key 有各自的 bucket
+	if ok, _, err := s.Take(c, "user:b", l); err != nil || !ok {
+		t.Fatalf("request of another key is limited: %v", err)
+	}
+
+	// 已經補滿的 bucket 會被清除
+	now = now.Add(memoryStoreSweepInterval)
+	if ok, _, err := s.Take(c, "user:c", l); err != nil || !ok {
+		t.Fatalf("request after sweep is limited: %v", err)
+	}
+	if n := s.Len(); n != 1 {
+		t.Fatalf("unexpected number of buckets %d", n)
+	}
+}